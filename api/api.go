@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"regexp"
 	"strings"
 	"sync"
@@ -24,6 +25,7 @@ import (
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/appstate"
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
@@ -36,13 +38,15 @@ type Api struct {
 	cw                  *wa.AppDatabase
 	waClient            *whatsmeow.Client
 	messageStore        *store.MessageStore
-	imageCache          *cache.ImageCache
+	mediaCache          *cache.MediaCache
+	downloads           *downloadManager
 	us                  *socket.UnixSocket
 	waContainer         *sqlstore.Container
 	eventHandlerID      uint32
 	eventHandlerSet     bool
 	startupErr          error
 	loginCancel         context.CancelFunc
+	loginByPhone        bool
 	lifecycleMu         sync.Mutex
 	loginMu             sync.Mutex
 	eventMu             sync.RWMutex
@@ -51,7 +55,22 @@ type Api struct {
 	shuttingDown        bool
 	windowFocused       atomic.Bool
 	groupRepairInFlight atomic.Bool
+	prefetching         atomic.Bool
 	appStateResync      atomic.Bool
+	presence            *presenceTracker
+	contacts            *contactCache
+	overrides           *overrideCache
+	connection          *connectionTracker
+	proxyErr            error
+	httpClient          atomic.Pointer[http.Client]
+	historyRequests     sync.Map // chat JID -> oldest message ID last requested
+	uploads             sync.Map // client temp ID -> context.CancelFunc
+	saves               sync.Map // chat JID -> context.CancelFunc
+	history             *historyWorker
+
+	// sessionGen counts session resets, so a LoggedOut handled late can
+	// tell the session was already replaced.
+	sessionGen atomic.Uint64
 }
 
 // repairGroupNames heals whats4linux_groups rows that are missing or were
@@ -77,21 +96,9 @@ func (a *Api) repairGroupNames() {
 		if err != nil || gi == nil || gi.GroupName.Name == "" {
 			continue
 		}
-		parentJID := ""
-		if !gi.LinkedParentJID.IsEmpty() {
-			parentJID = gi.LinkedParentJID.String()
-		}
-		if err := a.cw.StoreGroup(wa.Group{
-			JID:              cm.JID.String(),
-			Name:             gi.GroupName.Name,
-			Topic:            gi.GroupTopic.Topic,
-			OwnerJID:         gi.OwnerJID.String(),
-			ParticipantCount: len(gi.Participants),
-			ParentJID:        parentJID,
-			ParentName:       a.cw.ParentCommunityName(parentJID),
-			IsParent:         gi.IsParent,
-			IsDefaultSub:     gi.IsDefaultSubGroup,
-		}); err != nil {
+		g := a.groupFromInfo(gi)
+		g.JID = cm.JID.String()
+		if err := a.cw.StoreGroup(g); err != nil {
 			log.Println("repairGroupNames: failed to persist group:", cm.JID.String(), err)
 			continue
 		}
@@ -143,7 +150,7 @@ func (a *Api) SetWindowFocused(focused bool) {
 // notifyIncoming raises a desktop notification for an incoming message when the
 // window isn't focused.
 func (a *Api) notifyIncoming(v *events.Message, parsedHTML string) {
-	title := v.Info.PushName
+	title := a.displayNameOf(v.Info.Sender, v.Info.PushName)
 	if title == "" {
 		title = "New message"
 	}
@@ -158,7 +165,14 @@ func (a *Api) notifyIncoming(v *events.Message, parsedHTML string) {
 
 // NewApi creates a new Api application struct
 func New() *Api {
-	return &Api{}
+	a := &Api{}
+	a.presence = newPresenceTracker(typingTimeout, a.emitTyping)
+	a.contacts = newContactCache()
+	a.overrides = &overrideCache{}
+	a.connection = newConnectionTracker(a.emitConnection)
+	a.downloads = newDownloadManager(maxParallelDownloads, a.startBackground, a.runDownload, a.emitDownloadProgress)
+	a.history = newHistoryWorker(a.startBackground, a.processHistorySync)
+	return a
 }
 
 func (a *Api) startBackground(task func()) bool {
@@ -218,7 +232,14 @@ func (a *Api) Shutdown(ctx context.Context) {
 	// background task it launched before closing their stores.
 	a.eventMu.Lock()
 	a.eventMu.Unlock()
+	if a.downloads != nil {
+		a.downloads.cancelAll()
+	}
+	a.cancelSaves()
 	a.backgroundTasks.Wait()
+	if a.presence != nil {
+		a.presence.Stop()
+	}
 
 	if err := a.closeResources(); err != nil {
 		log.Println("shutdown cleanup failed:", err)
@@ -236,9 +257,9 @@ func (a *Api) closeResources() error {
 		closeErr = errors.Join(closeErr, a.messageStore.Close())
 		a.messageStore = nil
 	}
-	if a.imageCache != nil {
-		closeErr = errors.Join(closeErr, a.imageCache.Close())
-		a.imageCache = nil
+	if a.mediaCache != nil {
+		closeErr = errors.Join(closeErr, a.mediaCache.Close())
+		a.mediaCache = nil
 	}
 	if a.cw != nil {
 		closeErr = errors.Join(closeErr, a.cw.Close())
@@ -277,6 +298,7 @@ func (a *Api) Startup(ctx context.Context) {
 		return
 	}
 	a.us.SetCommandHandler(a.trayCommandHandler)
+	runtime.OnFileDrop(ctx, a.onFileDrop)
 	socketServer := a.us
 	go func() {
 		err := socketServer.ListenAndServe()
@@ -308,103 +330,265 @@ func (a *Api) Startup(ctx context.Context) {
 		a.failStartup(fmt.Errorf("upgrade WhatsApp session database: %w", err))
 		return
 	}
-	a.waClient = wa.NewClient(ctx, container)
+	a.waClient, err = a.newClient(container)
+	if err != nil {
+		a.failStartup(fmt.Errorf("create WhatsApp client: %w", err))
+		return
+	}
 	a.messageStore, err = store.NewMessageStore()
 	if err != nil {
 		a.failStartup(fmt.Errorf("open message store: %w", err))
 		return
 	}
-	a.imageCache, err = cache.NewImageCache()
+	a.mediaCache, err = cache.NewMediaCache(mediaCacheQuotas())
 	if err != nil {
-		a.failStartup(fmt.Errorf("open image cache: %w", err))
+		a.failStartup(fmt.Errorf("open media cache: %w", err))
 		return
 	}
+	go a.watchMetered()
 }
 
-func (a *Api) Login() error {
-	a.loginMu.Lock()
-	defer a.loginMu.Unlock()
+// newClient creates a WhatsApp client that uses the configured proxy and
+// reports reconnect failures on the connection state.
+func (a *Api) newClient(container *sqlstore.Container) (*whatsmeow.Client, error) {
+	client, err := wa.NewClient(a.ctx, container)
+	if err != nil {
+		return nil, err
+	}
+	client.AutoReconnectHook = a.autoReconnectFailed
+	if err := a.configureProxy(client); err != nil {
+		log.Println(err)
+	}
+	return client, nil
+}
 
+// prepareLogin checks that the client is usable and registers the event
+// handler. Must be called with loginMu held.
+func (a *Api) prepareLogin() (*whatsmeow.Client, error) {
 	if a.isShuttingDown() {
-		return context.Canceled
+		return nil, context.Canceled
 	}
 	a.lifecycleMu.Lock()
+	defer a.lifecycleMu.Unlock()
 	if a.startupErr != nil {
-		err := a.startupErr
-		a.lifecycleMu.Unlock()
-		return err
+		return nil, a.startupErr
+	}
+	if a.proxyErr != nil {
+		return nil, a.proxyErr
 	}
 	if a.waClient == nil {
-		a.lifecycleMu.Unlock()
-		return errors.New("WhatsApp client is not ready")
+		return nil, errors.New("WhatsApp client is not ready")
 	}
 	if !a.eventHandlerSet {
 		a.eventHandlerID = a.waClient.AddEventHandler(a.mainEventHandler)
 		a.eventHandlerSet = true
 	}
-	client := a.waClient
-	a.lifecycleMu.Unlock()
+	return a.waClient, nil
+}
 
-	if client.Store.ID == nil {
-		loginCtx, cancel := context.WithCancel(a.ctx)
+// newLoginContext returns a context that Shutdown (or a login started in the
+// other mode) can cancel, and the func that releases it.
+func (a *Api) newLoginContext(byPhone bool) (context.Context, func()) {
+	loginCtx, cancel := context.WithCancel(a.ctx)
+	a.lifecycleMu.Lock()
+	a.loginCancel = cancel
+	a.loginByPhone = byPhone
+	a.lifecycleMu.Unlock()
+	return loginCtx, func() {
+		cancel()
 		a.lifecycleMu.Lock()
-		a.loginCancel = cancel
+		a.loginCancel = nil
+		a.loginByPhone = false
 		a.lifecycleMu.Unlock()
-		defer func() {
-			cancel()
-			a.lifecycleMu.Lock()
-			a.loginCancel = nil
-			a.lifecycleMu.Unlock()
-		}()
-
-		qrChan, err := client.GetQRChannel(loginCtx)
-		if err != nil {
-			return fmt.Errorf("create QR login channel: %w", err)
-		}
-		if a.isShuttingDown() {
-			return context.Canceled
-		}
-		err = client.Connect()
-		if err != nil {
-			return err
-		}
-		for {
-			select {
-			case <-loginCtx.Done():
-				return loginCtx.Err()
-			case evt, ok := <-qrChan:
-				if !ok {
-					return nil
-				}
-				if evt.Event == "code" {
-					runtime.EventsEmit(a.ctx, "wa:qr", evt.Code)
-				} else {
-					runtime.EventsEmit(a.ctx, "wa:status", evt.Event)
-				}
+	}
+}
+
+// cancelPendingLogin aborts a login still waiting for the phone so the user
+// can switch between QR and pairing-code login. With onlyPhone set, a
+// pending QR login is left alone (a repeated Login call just waits for it).
+func (a *Api) cancelPendingLogin(onlyPhone bool) {
+	a.lifecycleMu.Lock()
+	cancel := a.loginCancel
+	if onlyPhone && !a.loginByPhone {
+		cancel = nil
+	}
+	a.lifecycleMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// connectForPairing opens the QR channel and connects an unpaired client.
+func (a *Api) connectForPairing(loginCtx context.Context, client *whatsmeow.Client) (<-chan whatsmeow.QRChannelItem, error) {
+	// A cancelled login leaves the unpaired websocket open; GetQRChannel
+	// requires a fresh connection.
+	if client.IsConnected() {
+		client.Disconnect()
+	}
+	qrChan, err := client.GetQRChannel(loginCtx)
+	if err != nil {
+		return nil, fmt.Errorf("create QR login channel: %w", err)
+	}
+	if a.isShuttingDown() {
+		return nil, context.Canceled
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	return qrChan, nil
+}
+
+// watchLogin forwards QR channel items until pairing finishes: codes go to
+// onCode, everything else ("success", "timeout", ...) to wa:status.
+func (a *Api) watchLogin(loginCtx context.Context, qrChan <-chan whatsmeow.QRChannelItem, onCode func(string)) error {
+	for {
+		select {
+		case <-loginCtx.Done():
+			return loginCtx.Err()
+		case evt, ok := <-qrChan:
+			if !ok {
+				return nil
+			}
+			if evt.Event == whatsmeow.QRChannelEventCode {
+				onCode(evt.Code)
+			} else {
+				runtime.EventsEmit(a.ctx, "wa:status", evt.Event)
 			}
 		}
-	} else {
-		// Already logged in, connect before announcing readiness.
-		err := client.Connect()
+	}
+}
+
+func (a *Api) Login() error {
+	a.cancelPendingLogin(true)
+	a.loginMu.Lock()
+	defer a.loginMu.Unlock()
+
+	client, err := a.prepareLogin()
+	if err != nil {
+		return err
+	}
+
+	if client.Store.ID == nil {
+		loginCtx, done := a.newLoginContext(false)
+		defer done()
+
+		qrChan, err := a.connectForPairing(loginCtx, client)
 		if err != nil {
 			return err
 		}
-		if a.isShuttingDown() {
-			return context.Canceled
+		return a.watchLogin(loginCtx, qrChan, func(code string) {
+			runtime.EventsEmit(a.ctx, "wa:qr", code)
+		})
+	}
+	// Already logged in, connect before announcing readiness.
+	a.connection.Connecting("")
+	if err := client.Connect(); err != nil {
+		reason := "could not connect"
+		if store.GetProxyURL() != "" {
+			reason = "could not connect through the proxy"
 		}
-		runtime.EventsEmit(a.ctx, "wa:status", "logged_in")
+		a.connection.Offline(reason, err, true)
+		return err
 	}
+	if a.isShuttingDown() {
+		return context.Canceled
+	}
+	runtime.EventsEmit(a.ctx, "wa:status", "logged_in")
 	return nil
 }
 
+// pairingClientName is shown in the phone's linked devices list. WhatsApp
+// only accepts "Browser (OS)" names here.
+const pairingClientName = "Chrome (Linux)"
+
+// LoginWithPhoneNumber links the app by phone number instead of a QR scan. It
+// returns the 8-character code to enter on the phone; pairing progress then
+// arrives on wa:status like a QR login ("success", "timeout", ...).
+func (a *Api) LoginWithPhoneNumber(phone string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(phone) < 7 || len(phone) > 15 {
+		return "", errors.New("enter the phone number in international format, including the country code")
+	}
+
+	a.cancelPendingLogin(false)
+	a.loginMu.Lock()
+	client, err := a.prepareLogin()
+	if err != nil {
+		a.loginMu.Unlock()
+		return "", err
+	}
+	if client.Store.ID != nil {
+		a.loginMu.Unlock()
+		return "", errors.New("already logged in")
+	}
+
+	loginCtx, done := a.newLoginContext(true)
+	fail := func(err error) (string, error) {
+		done()
+		a.loginMu.Unlock()
+		return "", err
+	}
+	qrChan, err := a.connectForPairing(loginCtx, client)
+	if err != nil {
+		return fail(err)
+	}
+
+	// The first QR item means the websocket is ready for pairing.
+	runtime.EventsEmit(a.ctx, "wa:status", "pairing")
+	select {
+	case <-loginCtx.Done():
+		return fail(loginCtx.Err())
+	case evt, ok := <-qrChan:
+		if !ok {
+			return fail(errors.New("login channel closed before pairing started"))
+		}
+		if evt.Event != whatsmeow.QRChannelEventCode {
+			runtime.EventsEmit(a.ctx, "wa:status", evt.Event)
+			return fail(fmt.Errorf("pairing failed: %s", evt.Event))
+		}
+	}
+	code, err := client.PairPhone(loginCtx, phone, true, whatsmeow.PairClientChrome, pairingClientName)
+	if err != nil {
+		return fail(fmt.Errorf("request pairing code: %w", err))
+	}
+	runtime.EventsEmit(a.ctx, "wa:status", "pair_code")
+
+	// Keep loginMu until pairing finishes, like Login, so Shutdown waits
+	// for it. Further QR codes are irrelevant here.
+	go func() {
+		defer a.loginMu.Unlock()
+		defer done()
+		if err := a.watchLogin(loginCtx, qrChan, func(string) {}); err != nil && !errors.Is(err, context.Canceled) {
+			log.Println("phone number login failed:", err)
+		}
+	}()
+	return code, nil
+}
+
 func (a *Api) mainEventHandler(evt any) {
 	a.eventMu.RLock()
 	defer a.eventMu.RUnlock()
 	if a.isShuttingDown() {
 		return
 	}
+	if a.connection != nil {
+		a.handleConnectionEvent(evt)
+	}
 	switch v := evt.(type) {
 	case *events.Message:
+		// Direct messages from blocked contacts are dropped. Group messages
+		// from them are still stored, but neither notify nor bump the chat
+		// list.
+		blocked := a.isBlockedSender(&v.Info)
+		if blocked && !v.Info.IsGroup {
+			return
+		}
+
 		parsedHTML := a.processMessageText(v.Message)
 
 		// Handle message edits: re-parse the edited content
@@ -415,10 +599,15 @@ func (a *Api) mainEventHandler(evt any) {
 			}
 		}
 
-		messageID := a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, v, parsedHTML)
+		var messageID string
+		if blocked {
+			messageID = a.messageStore.ProcessBlockedMessageEvent(a.ctx, a.waClient.Store.LIDs, v, parsedHTML)
+		} else {
+			messageID = a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, v, parsedHTML)
+		}
 
 		// If a message was processed (inserted or updated), emit the decoded message from DB
-		if messageID != "" {
+		if messageID != "" && !blocked {
 			updatedMsg, err := a.messageStore.GetDecodedMessage(v.Info.Chat.String(), messageID)
 			if err == nil {
 				runtime.EventsEmit(a.ctx, "wa:new_message", map[string]any{
@@ -434,17 +623,21 @@ func (a *Api) mainEventHandler(evt any) {
 			}
 		}
 
+		if messageID != "" && !blocked {
+			a.startBackground(func() { a.autoDownload(messageID) })
+		}
+
 		// Raise a desktop notification for genuine incoming messages (not our
 		// own, not reactions, not channel/broadcast posts) while backgrounded.
 		// Respects the global notification switch and per-chat mutes
 		// (including mutes synced from the phone).
 		isFeed := v.Info.Chat.Server == types.NewsletterServer || v.Info.Chat.Server == types.BroadcastServer
-		if messageID != "" && !v.Info.IsFromMe && !isFeed && v.Message.GetReactionMessage() == nil && !a.windowFocused.Load() &&
+		if messageID != "" && !v.Info.IsFromMe && !isFeed && !blocked && v.Message.GetReactionMessage() == nil && !a.windowFocused.Load() &&
 			store.GetNotificationsEnabled() && !a.messageStore.IsChatMuted(v.Info.Chat.String()) {
 			a.startBackground(func() { a.notifyIncoming(v, parsedHTML) })
 		}
 
-		if reaction := v.Message.GetReactionMessage(); reaction != nil {
+		if reaction := v.Message.GetReactionMessage(); reaction != nil && !blocked {
 			a.startBackground(func() {
 				targetID := reaction.GetKey().GetID()
 				targetMsg, err := a.messageStore.GetMessageWithMedia(v.Info.Chat.String(), targetID)
@@ -473,6 +666,15 @@ func (a *Api) mainEventHandler(evt any) {
 			})
 		}
 
+	case *events.PushName:
+		a.invalidateContact(v.JID, v.JIDAlt)
+	case *events.Contact:
+		a.invalidateContact(v.JID)
+	case *events.BusinessName:
+		a.invalidateContact(v.JID)
+	case *events.AppStateSyncComplete:
+		// A full sync stores the whole address book at once.
+		a.reloadContacts()
 	case *events.Picture:
 		a.startBackground(func() { _, _ = a.GetCachedAvatar(v.JID.String(), true) })
 
@@ -500,6 +702,8 @@ func (a *Api) mainEventHandler(evt any) {
 		a.startBackground(a.repairGroupNames)
 		// Recover archive/pin/mute sync if the local app state is corrupted.
 		a.startBackground(a.resyncAppState)
+		a.startBackground(a.syncBlocklist)
+		a.startBackground(a.prefetchRecentMedia)
 		if err := a.waClient.SendPresence(a.ctx, types.PresenceAvailable); err != nil {
 			log.Println("failed to send available presence:", err)
 		}
@@ -512,9 +716,12 @@ func (a *Api) mainEventHandler(evt any) {
 			runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
 		}
 	case *events.HistorySync:
-		// whatsmeow delivers past conversations here after linking. Reuse the
-		// same storage path as live messages so chats/history populate the UI.
-		a.processHistorySync(v)
+		// whatsmeow delivers past conversations here after linking. Store
+		// them in the background: whatsmeow dispatches events one at a
+		// time, so a large batch here would hold up live messages.
+		if a.history != nil {
+			a.history.add(v)
+		}
 	case *events.Archive:
 		// Chat archived/unarchived from another device (or app state sync).
 		if err := a.messageStore.SetChatArchived(v.JID.String(), v.Action.GetArchived(), v.Timestamp.Unix()); err != nil {
@@ -527,9 +734,65 @@ func (a *Api) mainEventHandler(evt any) {
 			log.Println("Failed to store chat pin:", err)
 		}
 		runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	case *events.NewsletterJoin:
+		// Followed from another device.
+		if err := a.cw.StoreNewsletter(wa.NewsletterFromMetadata(&v.NewsletterMetadata)); err != nil {
+			log.Println("Failed to cache joined channel:", err)
+		}
+		runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	case *events.NewsletterLeave:
+		if err := a.cw.DeleteNewsletter(v.ID.String()); err != nil {
+			log.Println("Failed to drop left channel from cache:", err)
+		}
+		runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	case *events.NewsletterMuteChange:
+		a.storeChannelMute(v.ID, v.Mute == types.NewsletterMuteOn)
+	case *events.ChatPresence:
+		a.handleChatPresence(v)
+	case *events.Presence:
+		a.handlePresence(v)
+	case *events.Blocklist:
+		a.handleBlocklistEvent(v)
+	case *events.PrivacySettings:
+		runtime.EventsEmit(a.ctx, "wa:privacy_update", privacySettingsFrom(v.NewSettings))
+	case *events.CallOffer:
+		// 1:1 call; a <video> child marks video calls.
+		_, video := v.Data.GetOptionalChildByTag("video")
+		a.handleCallOffer(v.BasicCallMeta, video)
+	case *events.CallOfferNotice:
+		// Group call.
+		a.handleCallOffer(v.BasicCallMeta, v.Media == "video")
+	case *events.CallAccept:
+		// Picked up on another device.
+		if err := a.messageStore.MarkCallAccepted(v.CallID, v.Timestamp.Unix()); err != nil {
+			log.Println("Failed to mark call accepted:", err)
+		}
+	case *events.CallReject:
+		a.handleCallEnd(v.CallID, v.Timestamp, "rejected", true)
+	case *events.CallTerminate:
+		a.handleCallEnd(v.CallID, v.Timestamp, v.Reason, false)
+	case *events.LoggedOut:
+		a.handleLoggedOut(v)
+	case *events.StreamReplaced:
+		a.handleStreamReplaced()
+	case *events.TemporaryBan:
+		a.handleTemporaryBan(v)
 	case *events.Disconnected:
 		a.waClient.SendPresence(a.ctx, types.PresenceUnavailable)
+	case *events.MarkChatAsRead:
+		// Read / marked unread on another device.
+		if err := a.messageStore.SetChatRead(v.JID.String(), v.Action.GetRead()); err != nil {
+			log.Println("Failed to store chat read state:", err)
+		}
+		runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
 	case *events.Receipt:
+		if v.IsFromMe && (v.Type == types.ReceiptTypeRead || v.Type == types.ReceiptTypeReadSelf) {
+			// Our own read receipt: the chat was read on another device.
+			if err := a.messageStore.SetChatRead(v.Chat.String(), true); err != nil {
+				log.Println("Failed to store chat read state:", err)
+			}
+			runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+		}
 		runtime.EventsEmit(a.ctx, "wa:message_receipt", map[string]any{
 			"chatId": v.Chat.String(),
 			"status": v.Type.GoString(),
@@ -544,19 +807,29 @@ func (a *Api) mainEventHandler(evt any) {
 // event. WhatsApp sends these in several batches after a device is linked
 // (bootstrap, recent, full). Each conversation's WebMessageInfo entries are
 // converted into the same *events.Message shape that live messages use, then
-// persisted through the existing MessageStore so the chat list and history
-// render exactly like incoming messages do.
+// written in bulk transactions so the chat list and history render exactly
+// like incoming messages do. The history worker runs it for one batch at a
+// time, in order.
 func (a *Api) processHistorySync(v *events.HistorySync) {
+	// whatsmeow stores a batch's push names without a PushName event for
+	// each.
+	if len(v.Data.GetPushnames()) > 0 {
+		a.reloadContacts()
+	}
 	conversations := v.Data.GetConversations()
 	if len(conversations) == 0 {
+		a.emitHistorySyncProgress(v.Data, 0, nil)
 		return
 	}
 	stored := 0
+	chats := make([]string, 0, len(conversations))
 	for _, conv := range conversations {
 		chatJID, err := types.ParseJID(conv.GetID())
 		if err != nil {
 			continue
 		}
+		chats = append(chats, chatJID.String())
+		msgs := make([]store.HistoryMessage, 0, len(conv.GetMessages()))
 		for _, histMsg := range conv.GetMessages() {
 			webMsg := histMsg.GetMessage()
 			if webMsg == nil {
@@ -572,12 +845,25 @@ func (a *Api) processHistorySync(v *events.HistorySync) {
 			if parsedMsg.Message == nil {
 				continue
 			}
-			parsedHTML := a.processMessageText(parsedMsg.Message)
-			if a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, parsedMsg, parsedHTML) != "" {
-				stored++
-			}
+			msgs = append(msgs, store.HistoryMessage{
+				Event:      parsedMsg,
+				ParsedHTML: a.processMessageText(parsedMsg.Message),
+			})
+		}
+		chat := store.HistoryChat{Name: conv.GetName(), Unread: -1}
+		// On-demand batches are older messages; their unread count isn't
+		// the chat's current one.
+		if conv.UnreadCount != nil && v.Data.GetSyncType() != waHistorySync.HistorySync_ON_DEMAND {
+			chat.Unread = int(conv.GetUnreadCount())
 		}
+		stored += a.messageStore.IngestHistoryConversation(a.ctx, a.waClient.Store.LIDs, msgs, chat)
 	}
-	log.Printf("History sync: stored %d messages from %d conversations", stored, len(conversations))
+	log.Printf("History sync (%s #%d): stored %d messages from %d conversations",
+		v.Data.GetSyncType(), v.Data.GetChunkOrder(), stored, len(conversations))
+	a.emitHistorySyncProgress(v.Data, stored, chats)
 	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	// On-demand batches are older messages the user scrolled back to.
+	if v.Data.GetSyncType() != waHistorySync.HistorySync_ON_DEMAND {
+		a.startBackground(a.prefetchRecentMedia)
+	}
 }
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// The prefetcher looks at media sent in the last prefetchWindow, at most
+// prefetchLimit messages of it.
+const (
+	prefetchWindow = 48 * time.Hour
+	prefetchLimit  = 200
+)
+
+var errAutoDownloadPaused = errors.New("auto-download paused on a metered connection")
+
+// autoDownloadType is the rule that applies to a type of media: stickers
+// count as images. Other media has no rule and isn't auto-downloaded.
+func autoDownloadType(mediaType mtypes.MediaType) string {
+	switch mediaType {
+	case mtypes.MediaTypeImage, mtypes.MediaTypeSticker:
+		return "image"
+	case mtypes.MediaTypeAudio:
+		return "audio"
+	case mtypes.MediaTypeVideo:
+		return "video"
+	case mtypes.MediaTypeDocument:
+		return "document"
+	}
+	return ""
+}
+
+// autoDownloadAllowed reports whether policy downloads msg's media without
+// being asked. Media of unknown size isn't held to the size limit.
+func autoDownloadAllowed(policy store.AutoDownload, msg *store.ExtendedMessage) bool {
+	if msg == nil || msg.Media == nil {
+		return false
+	}
+	rule, ok := policy.Rules[autoDownloadType(msg.Media.GetMediaGeneralType())]
+	if !ok {
+		return false
+	}
+	var allowed bool
+	switch msg.Info.Chat.Server {
+	case types.DefaultUserServer, types.HiddenUserServer:
+		allowed = rule.Contacts
+	case types.GroupServer:
+		allowed = rule.Groups
+	case types.NewsletterServer:
+		allowed = rule.Channels
+	}
+	return allowed && (rule.MaxSizeMB == 0 || msg.Media.GetFileLength() <= uint64(rule.MaxSizeMB)<<20)
+}
+
+// autoDownloadPaused reports whether policy holds off on the current
+// connection.
+func autoDownloadPaused(policy store.AutoDownload) bool {
+	return policy.PauseOnMetered && misc.IsMetered()
+}
+
+// GetAutoDownloadSettings returns which media is downloaded as it arrives,
+// by media type ("image", "audio", "video" and "document") and chat kind.
+func (a *Api) GetAutoDownloadSettings() store.AutoDownload {
+	return store.GetAutoDownload()
+}
+
+// SetAutoDownloadSettings changes which media is downloaded as it arrives.
+// Media types left out aren't auto-downloaded.
+func (a *Api) SetAutoDownloadSettings(policy store.AutoDownload) error {
+	for mediaType, rule := range policy.Rules {
+		if _, ok := store.DefaultAutoDownload().Rules[mediaType]; !ok {
+			return fmt.Errorf("unknown media type %q", mediaType)
+		}
+		if rule.MaxSizeMB < 0 {
+			return fmt.Errorf("negative size limit for %s", mediaType)
+		}
+	}
+	if err := store.SetAutoDownload(policy); err != nil {
+		return fmt.Errorf("failed to save auto-download settings: %w", err)
+	}
+	// The new rules may allow more, or no longer pause.
+	a.startBackground(a.prefetchRecentMedia)
+	return nil
+}
+
+// watchMetered prefetches again when the connection stops being metered,
+// which also resumes the held auto-downloads.
+func (a *Api) watchMetered() {
+	err := misc.WatchMetered(a.ctx, func(metered bool) {
+		if !metered {
+			a.startBackground(a.prefetchRecentMedia)
+		}
+	})
+	if err != nil {
+		log.Println("Not watching for metered connections:", err)
+	}
+}
+
+// autoDownload queues the media of a new message when the rules allow it.
+func (a *Api) autoDownload(messageID string) {
+	if a.messageStore == nil || a.mediaCache == nil {
+		return
+	}
+	msg, err := a.messageStore.GetMessageWithMediaByID(messageID)
+	if err != nil || msg.Media == nil {
+		return
+	}
+	policy := store.GetAutoDownload()
+	if !autoDownloadAllowed(policy, msg) || autoDownloadPaused(policy) {
+		return
+	}
+	if meta, err := a.mediaCache.Get(messageID); err != nil || meta != nil {
+		return
+	}
+	if _, err := a.queueMedia(msg, true); err != nil {
+		log.Println("Failed to queue auto-download:", err)
+	}
+}
+
+// prefetchRecentMedia resumes the auto-downloads held on a metered
+// connection and queues the uncached media of recent history that the rules
+// allow, except downloads that already failed or were cancelled. It runs
+// after connecting, after each history sync batch and once the connection
+// is no longer metered.
+func (a *Api) prefetchRecentMedia() {
+	if !a.prefetching.CompareAndSwap(false, true) {
+		return
+	}
+	defer a.prefetching.Store(false)
+	if a.messageStore == nil || a.mediaCache == nil || a.downloads == nil {
+		return
+	}
+	policy := store.GetAutoDownload()
+	if autoDownloadPaused(policy) {
+		log.Println("Prefetch skipped:", errAutoDownloadPaused)
+		return
+	}
+	a.downloads.resume()
+
+	ids, err := a.messageStore.RecentMediaMessageIDs(time.Now().Add(-prefetchWindow), prefetchLimit)
+	if err != nil {
+		log.Println("Prefetch: failed to list recent media:", err)
+		return
+	}
+	cached, err := a.mediaCache.GetMany(ids)
+	if err != nil {
+		log.Println("Prefetch: failed to check the media cache:", err)
+		return
+	}
+	queued := 0
+	for _, id := range ids {
+		// Media that failed, e.g. expired on the server, would only fail
+		// again; it is retried when asked for.
+		if cached[id] != nil || a.downloads.hasEnded(id) {
+			continue
+		}
+		msg, err := a.messageStore.GetMessageWithMediaByID(id)
+		if err != nil || !autoDownloadAllowed(policy, msg) {
+			continue
+		}
+		if _, err := a.queueMedia(msg, true); err != nil {
+			log.Println("Prefetch: failed to queue media:", err)
+			return
+		}
+		queued++
+	}
+	if queued > 0 {
+		log.Printf("Prefetch: queued %d recent media downloads", queued)
+	}
+}
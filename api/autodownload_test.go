@@ -0,0 +1,48 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestAutoDownloadAllowed(t *testing.T) {
+	policy := store.DefaultAutoDownload()
+	message := func(chat string, mediaType mtypes.MediaType, size uint64) *store.ExtendedMessage {
+		jid, _ := types.ParseJID(chat)
+		return &store.ExtendedMessage{
+			Info:  types.MessageInfo{MessageSource: types.MessageSource{Chat: jid}},
+			Media: wa.NewMedia("/path", nil, nil, nil, "", "", "", size, 0, 0, mediaType),
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		msg  *store.ExtendedMessage
+		want bool
+	}{
+		{"image from a contact", message("1@s.whatsapp.net", mtypes.MediaTypeImage, 1<<20), true},
+		{"sticker in a group", message("1@g.us", mtypes.MediaTypeSticker, 50<<10), true},
+		{"image in a channel", message("1@newsletter", mtypes.MediaTypeImage, 1<<20), true},
+		{"voice note in a channel", message("1@newsletter", mtypes.MediaTypeAudio, 1<<10), false},
+		{"video from a contact", message("1@s.whatsapp.net", mtypes.MediaTypeVideo, 1<<20), false},
+		{"image over the size limit", message("1@s.whatsapp.net", mtypes.MediaTypeImage, 17<<20), false},
+		{"image of unknown size", message("1@s.whatsapp.net", mtypes.MediaTypeImage, 0), true},
+		{"status update", message("status@broadcast", mtypes.MediaTypeImage, 1<<20), false},
+		{"no media", &store.ExtendedMessage{}, false},
+	} {
+		if got := autoDownloadAllowed(policy, tc.msg); got != tc.want {
+			t.Errorf("%s: allowed = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// No limit takes any size.
+	rule := policy.Rules["image"]
+	rule.MaxSizeMB = 0
+	policy.Rules["image"] = rule
+	if !autoDownloadAllowed(policy, message("1@s.whatsapp.net", mtypes.MediaTypeImage, 1<<30)) {
+		t.Error("image not allowed without a size limit")
+	}
+}
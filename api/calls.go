@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gen2brain/beeep"
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// defaultCallLogLimit is the page size GetCallLog uses when none is given.
+const defaultCallLogLimit = 100
+
+// callerName picks a display name for a caller for notifications.
+func (a *Api) callerName(jid types.JID) string {
+	return a.displayNameOf(jid, "")
+}
+
+// handleCallOffer records an incoming call, tells the frontend it is ringing
+// and raises a desktop notification. Calls can't be answered here; they can
+// only be rejected via RejectCall or picked up on the phone.
+func (a *Api) handleCallOffer(meta types.BasicCallMeta, video bool) {
+	creator := meta.CallCreator
+	if creator.IsEmpty() {
+		creator = meta.From
+	}
+	caller := canonicalUserJID(a.ctx, a.waClient, creator.ToNonAD())
+	if own := a.waClient.Store.ID; own != nil && caller.User == own.User {
+		// Calls placed from our phone; only incoming calls are logged.
+		return
+	}
+	chat := caller
+	if !meta.GroupJID.IsEmpty() {
+		chat = meta.GroupJID
+	}
+
+	entry := store.CallLogEntry{
+		CallID:     meta.CallID,
+		ChatJID:    chat.String(),
+		CallerJID:  caller.String(),
+		CreatorJID: creator.ToNonAD().String(),
+		IsVideo:    video,
+		StartedAt:  meta.Timestamp.Unix(),
+	}
+	if !meta.GroupJID.IsEmpty() {
+		entry.GroupJID = meta.GroupJID.String()
+	}
+	if err := a.messageStore.RecordCallOffer(entry); err != nil {
+		log.Println("Failed to record call offer:", err)
+		return
+	}
+
+	runtime.EventsEmit(a.ctx, "wa:call", map[string]any{
+		"callId":  entry.CallID,
+		"chatId":  entry.ChatJID,
+		"from":    entry.CallerJID,
+		"isVideo": video,
+		"isGroup": entry.GroupJID != "",
+		"status":  "ringing",
+	})
+
+	if !store.GetNotificationsEnabled() || a.messageStore.IsChatMuted(entry.ChatJID) {
+		return
+	}
+	a.startBackground(func() {
+		body := "Incoming voice call"
+		if video {
+			body = "Incoming video call"
+		}
+		if err := beeep.Notify(a.callerName(caller), body, ""); err != nil {
+			log.Println("notify failed:", err)
+		}
+	})
+}
+
+// handleCallEnd closes a call in the log and adds it to the chat timeline.
+func (a *Api) handleCallEnd(callID string, endedAt time.Time, reason string, rejected bool) {
+	entry, err := a.messageStore.FinishCall(callID, endedAt.Unix(), reason, rejected)
+	if err != nil {
+		log.Println("Failed to finish call:", err)
+		return
+	}
+	if entry == nil {
+		return
+	}
+	a.emitCallFinished(entry)
+}
+
+func (a *Api) emitCallFinished(entry *store.CallLogEntry) {
+	status := "ended"
+	switch {
+	case entry.Rejected:
+		status = "rejected"
+	case entry.Missed:
+		status = "missed"
+	}
+	runtime.EventsEmit(a.ctx, "wa:call", map[string]any{
+		"callId":   entry.CallID,
+		"chatId":   entry.ChatJID,
+		"from":     entry.CallerJID,
+		"isVideo":  entry.IsVideo,
+		"isGroup":  entry.GroupJID != "",
+		"status":   status,
+		"duration": entry.Duration,
+	})
+	if msg, err := a.messageStore.GetDecodedMessage(entry.ChatJID, store.CallTimelineID(entry.CallID)); err == nil {
+		runtime.EventsEmit(a.ctx, "wa:new_message", map[string]any{
+			"chatId":      entry.ChatJID,
+			"message":     msg,
+			"messageText": store.CallSummary(entry),
+			"timestamp":   entry.StartedAt,
+			"isFromMe":    false,
+		})
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+}
+
+// RejectCall declines a ringing incoming call.
+func (a *Api) RejectCall(callID string) error {
+	entry, err := a.messageStore.GetCall(callID)
+	if err != nil {
+		return fmt.Errorf("unknown call %s: %w", callID, err)
+	}
+	if entry.EndedAt != 0 {
+		return fmt.Errorf("call %s already ended", callID)
+	}
+	creator, err := types.ParseJID(entry.CreatorJID)
+	if err != nil {
+		return err
+	}
+	if err := a.waClient.RejectCall(a.ctx, creator, callID); err != nil {
+		return fmt.Errorf("failed to reject call: %w", err)
+	}
+	a.handleCallEnd(callID, time.Now(), "rejected", true)
+	return nil
+}
+
+// GetCallLog returns incoming calls, newest first.
+func (a *Api) GetCallLog(limit, offset int) ([]store.CallLogEntry, error) {
+	if limit <= 0 {
+		limit = defaultCallLogLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return a.messageStore.GetCallLog(limit, offset)
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// defaultChannelFetchCount is how many posts FetchChannelMessages requests
+// when the caller doesn't specify a count.
+const defaultChannelFetchCount = 50
+
+// Channel is a followed channel (newsletter) with its cached metadata.
+type Channel struct {
+	JID             string `json:"jid"`
+	Name            string `json:"name"`
+	Description     string `json:"description,omitempty"`
+	InviteCode      string `json:"invite_code,omitempty"`
+	SubscriberCount int    `json:"subscriber_count"`
+	Verified        bool   `json:"verified"`
+	Muted           bool   `json:"muted"`
+	Role            string `json:"role,omitempty"`
+}
+
+func channelFromCache(n wa.Newsletter) Channel {
+	return Channel{
+		JID:             n.JID,
+		Name:            n.Name,
+		Description:     n.Description,
+		InviteCode:      n.InviteCode,
+		SubscriberCount: n.SubscriberCount,
+		Verified:        n.Verified,
+		Muted:           n.Muted,
+		Role:            n.Role,
+	}
+}
+
+func parseChannelJID(jidStr string) (types.JID, error) {
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return types.EmptyJID, err
+	}
+	if jid.Server != types.NewsletterServer {
+		return types.EmptyJID, fmt.Errorf("%s is not a channel", jidStr)
+	}
+	return jid, nil
+}
+
+// GetChannelList returns the followed Channels (newsletter feeds). Names come
+// from the local newsletter cache, so this never touches the network; followed
+// channels without stored posts are listed too.
+func (a *Api) GetChannelList() ([]ChatElement, error) {
+	cmList := a.messageStore.GetChannelList()
+	latest := make(map[string]store.ChatMessage, len(cmList))
+	for _, cm := range cmList {
+		latest[cm.JID.String()] = cm
+	}
+
+	newsletters, err := a.cw.FetchNewsletters()
+	if err != nil {
+		log.Println("GetChannelList: newsletter cache lookup failed, using fallback:", err)
+	}
+
+	ce := make([]ChatElement, 0, len(newsletters)+len(cmList))
+	for _, n := range newsletters {
+		cm := latest[n.JID]
+		delete(latest, n.JID)
+		name := n.Name
+		if name == "" {
+			name = strings.TrimSuffix(n.JID, "@"+types.NewsletterServer)
+		}
+		ce = append(ce, ChatElement{
+			LatestMessage: cm.MessageText,
+			LatestTS:      cm.MessageTime,
+			Sender:        cm.Sender,
+			UnreadCount:   cm.Unread,
+			Muted:         cm.Muted(),
+			Contact:       Contact{JID: n.JID, FullName: name},
+		})
+	}
+	// Until the cache has been filled once (first connect), fall back to the
+	// channels we have posts for so the view isn't empty.
+	if len(newsletters) == 0 {
+		for _, cm := range cmList {
+			ce = append(ce, ChatElement{
+				LatestMessage: cm.MessageText,
+				LatestTS:      cm.MessageTime,
+				Sender:        cm.Sender,
+				UnreadCount:   cm.Unread,
+				Muted:         cm.Muted(),
+				Contact:       Contact{JID: cm.JID.String(), FullName: cm.JID.User},
+			})
+		}
+	}
+
+	sort.SliceStable(ce, func(i, j int) bool { return ce[i].LatestTS > ce[j].LatestTS })
+	return ce, nil
+}
+
+// GetChannelInfo returns a channel's metadata, from the local cache when
+// possible and from the server otherwise (e.g. a channel not followed yet).
+func (a *Api) GetChannelInfo(jidStr string) (Channel, error) {
+	if n, err := a.cw.FetchNewsletter(jidStr); err == nil {
+		return channelFromCache(*n), nil
+	}
+	jid, err := parseChannelJID(jidStr)
+	if err != nil {
+		return Channel{}, err
+	}
+	meta, err := a.waClient.GetNewsletterInfo(a.ctx, jid)
+	if err != nil {
+		return Channel{}, fmt.Errorf("failed to get channel info: %w", err)
+	}
+	return channelFromCache(wa.NewsletterFromMetadata(meta)), nil
+}
+
+// FollowChannel follows a channel given either its JID or an invite link/code
+// (https://whatsapp.com/channel/...), and caches its metadata.
+func (a *Api) FollowChannel(jidOrInvite string) (Channel, error) {
+	jidOrInvite = strings.TrimSpace(jidOrInvite)
+	var meta *types.NewsletterMetadata
+	var err error
+	if strings.HasSuffix(jidOrInvite, "@"+types.NewsletterServer) {
+		jid, perr := parseChannelJID(jidOrInvite)
+		if perr != nil {
+			return Channel{}, perr
+		}
+		meta, err = a.waClient.GetNewsletterInfo(a.ctx, jid)
+	} else {
+		meta, err = a.waClient.GetNewsletterInfoWithInvite(a.ctx, jidOrInvite)
+	}
+	if err != nil {
+		return Channel{}, fmt.Errorf("failed to resolve channel: %w", err)
+	}
+
+	if err := a.waClient.FollowNewsletter(a.ctx, meta.ID); err != nil {
+		return Channel{}, fmt.Errorf("failed to follow channel: %w", err)
+	}
+
+	n := wa.NewsletterFromMetadata(meta)
+	if n.Role == "" {
+		// Invite lookups carry no viewer metadata.
+		n.Role = string(types.NewsletterRoleSubscriber)
+	}
+	if err := a.cw.StoreNewsletter(n); err != nil {
+		log.Println("FollowChannel: cache update failed:", err)
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return channelFromCache(n), nil
+}
+
+// UnfollowChannel stops following a channel and drops it from the cache.
+// Stored posts are kept, like messages of a left group.
+func (a *Api) UnfollowChannel(jidStr string) error {
+	jid, err := parseChannelJID(jidStr)
+	if err != nil {
+		return err
+	}
+	if err := a.waClient.UnfollowNewsletter(a.ctx, jid); err != nil {
+		return fmt.Errorf("failed to unfollow channel: %w", err)
+	}
+	if err := a.cw.DeleteNewsletter(jid.String()); err != nil {
+		log.Println("UnfollowChannel: cache update failed:", err)
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return nil
+}
+
+// SetChannelMuted mutes or unmutes a channel on the server and mirrors the
+// state into the cache and the local mute table used for notifications.
+func (a *Api) SetChannelMuted(jidStr string, muted bool) error {
+	jid, err := parseChannelJID(jidStr)
+	if err != nil {
+		return err
+	}
+	if err := a.waClient.NewsletterToggleMute(a.ctx, jid, muted); err != nil {
+		return fmt.Errorf("failed to toggle channel mute: %w", err)
+	}
+	a.storeChannelMute(jid, muted)
+	return nil
+}
+
+// storeChannelMute persists a channel mute change made here or on another
+// device and notifies the frontend.
+func (a *Api) storeChannelMute(jid types.JID, muted bool) {
+	if err := a.cw.SetNewsletterMuted(jid.String(), muted); err != nil {
+		log.Println("Failed to store channel mute in cache:", err)
+	}
+	var mutedUntil int64
+	if muted {
+		mutedUntil = -1
+	}
+	if err := a.messageStore.SetChatMuted(jid.String(), mutedUntil); err != nil {
+		log.Println("Failed to persist channel mute state:", err)
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_mute_update", map[string]any{
+		"chatId": jid.String(),
+		"muted":  muted,
+	})
+}
+
+// FetchChannelMessages backfills up to count posts older than the oldest
+// stored one (or the newest posts when nothing is stored yet) and stores them
+// through the regular message path. Returns how many posts were stored.
+func (a *Api) FetchChannelMessages(jidStr string, count int) (int, error) {
+	jid, err := parseChannelJID(jidStr)
+	if err != nil {
+		return 0, err
+	}
+	if count <= 0 {
+		count = defaultChannelFetchCount
+	}
+	msgs, err := a.waClient.GetNewsletterMessages(a.ctx, jid, &whatsmeow.GetNewsletterMessagesParams{
+		Count:  count,
+		Before: a.messageStore.OldestNewsletterServerID(jid.String()),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch channel messages: %w", err)
+	}
+
+	stored := 0
+	for _, nm := range msgs {
+		msg := store.UnwrapMessage(nm.Message)
+		if msg == nil {
+			continue
+		}
+		id := nm.MessageID
+		if id == "" {
+			id = strconv.Itoa(nm.MessageServerID)
+		}
+		evt := &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+				ID:            id,
+				ServerID:      nm.MessageServerID,
+				Type:          nm.Type,
+				Timestamp:     nm.Timestamp,
+			},
+			Message: msg,
+		}
+		parsedHTML := a.processMessageText(msg)
+		if a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, evt, parsedHTML) != "" {
+			stored++
+		}
+	}
+	if stored > 0 {
+		runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	}
+	return stored, nil
+}
+
+// SendChannelReaction reacts to a channel post. Channel reactions address the
+// post by its server ID rather than the message ID; an empty emoji removes the
+// reaction.
+func (a *Api) SendChannelReaction(chatJID, messageID, emoji string) error {
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("not logged in")
+	}
+	jid, err := parseChannelJID(chatJID)
+	if err != nil {
+		return err
+	}
+	serverID, err := a.messageStore.GetNewsletterServerID(messageID)
+	if err != nil {
+		return fmt.Errorf("unknown server ID for channel message %s: %w", messageID, err)
+	}
+	if err := a.waClient.NewsletterSendReaction(a.ctx, jid, serverID, emoji, ""); err != nil {
+		return err
+	}
+	// Persist our own reaction locally so it survives a reload.
+	_ = a.messageStore.AddReactionToMessage(messageID, emoji, a.waClient.Store.ID.String())
+	return nil
+}
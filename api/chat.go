@@ -1,9 +1,12 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/lugvitc/whats4linux/internal/wa"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"go.mau.fi/whatsmeow/appstate"
 	"go.mau.fi/whatsmeow/types"
@@ -16,6 +19,8 @@ type ChatElement struct {
 	Pinned        bool  `json:"pinned"`
 	PinnedAt      int64 `json:"pinned_at"`
 	Archived      bool  `json:"archived"`
+	UnreadCount   int   `json:"unread_count"`
+	Muted         bool  `json:"muted"`
 	Contact
 
 	// Community linkage (populated for groups that belong to a community).
@@ -66,33 +71,81 @@ func (a *Api) ToggleChatArchive(jidStr string, archived bool) error {
 	return nil
 }
 
+// GetChatList returns the whole chat list, newest first.
 func (a *Api) GetChatList() ([]ChatElement, error) {
-	cmList := a.messageStore.GetChatList()
-	pinnedChats := a.messageStore.GetPinnedChats()
-	archivedChats := a.messageStore.GetArchivedChats()
+	return a.chatElements(a.messageStore.GetChatList()), nil
+}
+
+// GetChatListPage returns limit chats of the chat list starting at offset,
+// newest first, for lists that load as they scroll.
+func (a *Api) GetChatListPage(limit, offset int) ([]ChatElement, error) {
+	if limit <= 0 || offset < 0 {
+		return nil, fmt.Errorf("invalid page: limit %d, offset %d", limit, offset)
+	}
+	return a.chatElements(a.messageStore.GetChatListPage(limit, offset)), nil
+}
+
+// chatElements resolves the names of a chat list page. Contacts and groups
+// are looked up in one batch each rather than once per chat.
+func (a *Api) chatElements(cmList []store.ChatMessage) []ChatElement {
+	var users []types.JID
+	hasGroups := false
+	for _, cm := range cmList {
+		if cm.JID.Server == types.GroupServer {
+			hasGroups = true
+			// Group previews name the sender.
+			if !cm.FromMe {
+				if sender, err := types.ParseJID(cm.SenderJID); err == nil {
+					users = append(users, sender.ToNonAD())
+				}
+			}
+			continue
+		}
+		users = append(users, cm.JID)
+	}
+	contacts := a.contactInfos(users)
+	overrides := a.contactOverrides()
+
+	// Local-only on purpose: this runs at startup before the client has
+	// connected, so it must never touch the network. Empty names are healed
+	// asynchronously by repairGroupNames after Connected.
+	groups := make(map[string]wa.Group)
+	if hasGroups {
+		all, err := a.cw.FetchGroups()
+		if err != nil {
+			log.Println("GetChatList: group lookup failed, using fallback:", err)
+		}
+		for _, g := range all {
+			groups[g.JID] = g
+		}
+	}
+
 	ce := make([]ChatElement, len(cmList))
 	for i, cm := range cmList {
 		var fc Contact
 		var parentJID, parentName string
 		var isCommunityGroup, isCommunityParent, isDefaultSub bool
+		sender := cm.Sender
 
 		if cm.JID.Server == types.GroupServer {
-			// Local-only on purpose: this runs at startup before the client
-			// has connected, so it must never touch the network. Empty names
-			// are healed asynchronously by repairGroupNames after Connected.
 			name := ""
-			if groupInfo, err := a.cw.FetchGroup(cm.JID.String()); err == nil {
+			if groupInfo, ok := groups[cm.JID.String()]; ok {
 				name = groupInfo.Name
 				parentJID = groupInfo.ParentJID
 				parentName = groupInfo.ParentName
 				if parentName == "" && parentJID != "" {
-					parentName = a.cw.ParentCommunityName(parentJID)
+					if parent, ok := groups[parentJID]; ok && parent.Name != "" {
+						parentName = parent.Name
+					} else {
+						parentName = a.cw.ParentCommunityName(parentJID)
+					}
 				}
 				isCommunityGroup = parentJID != ""
 				isCommunityParent = groupInfo.IsParent
 				isDefaultSub = groupInfo.IsDefaultSub
-			} else {
-				log.Println("GetChatList: group lookup failed, using fallback:", cm.JID.String(), err)
+			}
+			if name == "" {
+				name = cm.DisplayName
 			}
 			if name == "" {
 				// A single unknown/left group must not blank the whole chat
@@ -100,37 +153,44 @@ func (a *Api) GetChatList() ([]ChatElement, error) {
 				name = cm.JID.User
 			}
 			fc = Contact{
-				JID:      cm.JID.String(),
-				FullName: name,
+				JID:         cm.JID.String(),
+				FullName:    name,
+				DisplayName: name,
 			}
-		} else {
-			contact, err := a.waClient.Store.Contacts.GetContact(a.ctx, cm.JID)
-			if err != nil {
-				// Same here: degrade to the JID rather than failing everything.
-				log.Println("GetChatList: contact lookup failed, using fallback:", cm.JID.String(), err)
-				fc = Contact{
-					JID:      cm.JID.String(),
-					PushName: cm.JID.User,
-				}
-			} else {
-				fc = Contact{
-					JID:        cm.JID.String(),
-					Short:      contact.FirstName,
-					FullName:   contact.FullName,
-					PushName:   contact.PushName,
-					IsBusiness: contact.BusinessName != "",
+			if senderJID, err := types.ParseJID(cm.SenderJID); err == nil && !cm.FromMe {
+				info := contacts[senderJID.ToNonAD()]
+				if info.PushName == "" {
+					info.PushName = cm.SenderPushName
 				}
+				user := a.userJID(senderJID)
+				sender = displayName(user, info, overrides[user.String()].Nickname)
+			}
+		} else {
+			// A contact we know nothing about still renders under the name
+			// WhatsApp gave the chat, or its number.
+			info := contacts[cm.JID]
+			if info.PushName == "" {
+				info.PushName = cm.DisplayName
+			}
+			user := a.userJID(cm.JID)
+			fc = Contact{
+				JID:         cm.JID.String(),
+				Short:       info.FirstName,
+				FullName:    info.FullName,
+				PushName:    info.PushName,
+				IsBusiness:  info.BusinessName != "",
+				DisplayName: displayName(user, info, overrides[user.String()].Nickname),
 			}
 		}
-		pinnedAt, pinned := pinnedChats[cm.JID.String()]
-		_, archived := archivedChats[cm.JID.String()]
 		ce[i] = ChatElement{
 			LatestMessage:     cm.MessageText,
 			LatestTS:          cm.MessageTime,
-			Sender:            cm.Sender,
-			Pinned:            pinned,
-			PinnedAt:          pinnedAt,
-			Archived:          archived,
+			Sender:            sender,
+			Pinned:            cm.PinnedAt != 0,
+			PinnedAt:          cm.PinnedAt,
+			Archived:          cm.ArchivedAt != 0,
+			UnreadCount:       cm.Unread,
+			Muted:             cm.Muted(),
 			Contact:           fc,
 			ParentJID:         parentJID,
 			ParentName:        parentName,
@@ -139,27 +199,7 @@ func (a *Api) GetChatList() ([]ChatElement, error) {
 			IsDefaultSubGroup: isDefaultSub,
 		}
 	}
-	return ce, nil
-}
-
-// GetChannelList returns the followed Channels (newsletter feeds), named via
-// their newsletter metadata.
-func (a *Api) GetChannelList() ([]ChatElement, error) {
-	cmList := a.messageStore.GetChannelList()
-	ce := make([]ChatElement, len(cmList))
-	for i, cm := range cmList {
-		name := cm.JID.User
-		if info, err := a.waClient.GetNewsletterInfo(a.ctx, cm.JID); err == nil && info != nil && info.ThreadMeta.Name.Text != "" {
-			name = info.ThreadMeta.Name.Text
-		}
-		ce[i] = ChatElement{
-			LatestMessage: cm.MessageText,
-			LatestTS:      cm.MessageTime,
-			Sender:        cm.Sender,
-			Contact:       Contact{JID: cm.JID.String(), FullName: name},
-		}
-	}
-	return ce, nil
+	return ce
 }
 
 func (a *Api) SendChatPresence(jid string, cp types.ChatPresence, cpm types.ChatPresenceMedia) error {
@@ -6,6 +6,9 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types"
 )
 
@@ -280,3 +283,253 @@ func (a *Api) communityDetailsFromJoined(details CommunityDetails, parent types.
 	}
 	return details, nil
 }
+
+// parseGroupJID parses a group/community JID, rejecting user JIDs.
+func parseGroupJID(jidStr string) (types.JID, error) {
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return types.JID{}, fmt.Errorf("invalid JID: %w", err)
+	}
+	if jid.Server != types.GroupServer {
+		return types.JID{}, fmt.Errorf("JID is not a group/community JID")
+	}
+	return jid, nil
+}
+
+// groupFromInfo converts live group info into a whats4linux_groups row.
+func (a *Api) groupFromInfo(gi *types.GroupInfo) wa.Group {
+	parentJID := ""
+	if !gi.LinkedParentJID.IsEmpty() {
+		parentJID = gi.LinkedParentJID.String()
+	}
+	return wa.Group{
+		JID:              gi.JID.String(),
+		Name:             gi.GroupName.Name,
+		Topic:            gi.GroupTopic.Topic,
+		OwnerJID:         gi.OwnerJID.String(),
+		ParticipantCount: len(gi.Participants),
+		ParentJID:        parentJID,
+		ParentName:       a.cw.ParentCommunityName(parentJID),
+		IsParent:         gi.IsParent,
+		IsDefaultSub:     gi.IsDefaultSubGroup,
+	}
+}
+
+// cacheGroupLink records child as linked to parent in the group cache. Rows
+// that aren't cached yet are inserted from live group info (or from the
+// fallback when that fails) so communitiesFromCache counts them immediately.
+func (a *Api) cacheGroupLink(child, parent types.JID, fallback wa.Group) {
+	if a.cw == nil {
+		return
+	}
+	parentName := a.cw.ParentCommunityName(parent.String())
+	updated, err := a.cw.SetGroupParent(child.String(), parent.String(), parentName)
+	if err != nil {
+		log.Println("cacheGroupLink: failed to update group parent:", child.String(), err)
+		return
+	}
+	if updated {
+		return
+	}
+	g := fallback
+	if gi, err := a.waClient.GetGroupInfo(a.ctx, child); err == nil && gi != nil {
+		g = a.groupFromInfo(gi)
+	}
+	g.JID = child.String()
+	g.ParentJID = parent.String()
+	g.ParentName = parentName
+	if err := a.cw.StoreGroup(g); err != nil {
+		log.Println("cacheGroupLink: failed to store group:", child.String(), err)
+	}
+}
+
+// CreateCommunity creates a new community. The server creates the linked
+// announcement group automatically; both are stored in the group cache.
+func (a *Api) CreateCommunity(name, description string) (CommunitySummary, error) {
+	if a.waClient == nil {
+		return CommunitySummary{}, fmt.Errorf("client not ready")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return CommunitySummary{}, fmt.Errorf("a community needs a name")
+	}
+
+	info, err := a.waClient.CreateGroup(a.ctx, whatsmeow.ReqCreateGroup{
+		Name:        name,
+		GroupParent: types.GroupParent{IsParent: true},
+	})
+	if err != nil {
+		return CommunitySummary{}, fmt.Errorf("failed to create community: %w", err)
+	}
+	description = strings.TrimSpace(description)
+	if description != "" {
+		if err := a.waClient.SetGroupTopic(a.ctx, info.JID, "", "", description); err != nil {
+			log.Println("CreateCommunity: failed to set description:", info.JID.String(), err)
+			description = ""
+		}
+	}
+
+	if a.cw != nil {
+		parent := a.groupFromInfo(info)
+		parent.Name = name
+		parent.Topic = description
+		parent.IsParent = true
+		if err := a.cw.StoreGroup(parent); err != nil {
+			log.Println("CreateCommunity: failed to store community:", info.JID.String(), err)
+		}
+		if subGroups, err := a.waClient.GetSubGroups(a.ctx, info.JID); err == nil {
+			for _, sg := range subGroups {
+				if sg == nil {
+					continue
+				}
+				a.cacheGroupLink(sg.JID, info.JID, wa.Group{
+					Name:         sg.Name,
+					IsDefaultSub: sg.IsDefaultSubGroup,
+				})
+			}
+		} else {
+			log.Println("CreateCommunity: GetSubGroups failed:", info.JID.String(), err)
+		}
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+
+	return CommunitySummary{
+		JID:   info.JID.String(),
+		Name:  name,
+		Topic: description,
+	}, nil
+}
+
+// LinkGroupToCommunity links an existing group (which we must admin) into a
+// community.
+func (a *Api) LinkGroupToCommunity(communityJID, groupJID string) error {
+	if a.waClient == nil {
+		return fmt.Errorf("client not ready")
+	}
+	parent, err := parseGroupJID(communityJID)
+	if err != nil {
+		return err
+	}
+	child, err := parseGroupJID(groupJID)
+	if err != nil {
+		return err
+	}
+	if err := a.waClient.LinkGroup(a.ctx, parent, child); err != nil {
+		return fmt.Errorf("failed to link group: %w", err)
+	}
+	a.cacheGroupLink(child, parent, wa.Group{})
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return nil
+}
+
+// UnlinkGroup removes a group from a community. The group itself stays.
+func (a *Api) UnlinkGroup(communityJID, groupJID string) error {
+	if a.waClient == nil {
+		return fmt.Errorf("client not ready")
+	}
+	parent, err := parseGroupJID(communityJID)
+	if err != nil {
+		return err
+	}
+	child, err := parseGroupJID(groupJID)
+	if err != nil {
+		return err
+	}
+	if err := a.waClient.UnlinkGroup(a.ctx, parent, child); err != nil {
+		return fmt.Errorf("failed to unlink group: %w", err)
+	}
+	if a.cw != nil {
+		if _, err := a.cw.SetGroupParent(child.String(), "", ""); err != nil {
+			log.Println("UnlinkGroup: failed to update group cache:", groupJID, err)
+		}
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return nil
+}
+
+// CreateSubGroup creates a new group directly inside a community.
+func (a *Api) CreateSubGroup(communityJID, name string, participants []string) (CommunityGroup, error) {
+	if a.waClient == nil {
+		return CommunityGroup{}, fmt.Errorf("client not ready")
+	}
+	parent, err := parseGroupJID(communityJID)
+	if err != nil {
+		return CommunityGroup{}, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return CommunityGroup{}, fmt.Errorf("a group needs a name")
+	}
+	members := make([]types.JID, 0, len(participants))
+	for _, p := range participants {
+		jid, err := types.ParseJID(p)
+		if err != nil {
+			return CommunityGroup{}, fmt.Errorf("invalid participant %q: %w", p, err)
+		}
+		members = append(members, jid)
+	}
+
+	info, err := a.waClient.CreateGroup(a.ctx, whatsmeow.ReqCreateGroup{
+		Name:              name,
+		Participants:      members,
+		GroupLinkedParent: types.GroupLinkedParent{LinkedParentJID: parent},
+	})
+	if err != nil {
+		return CommunityGroup{}, fmt.Errorf("failed to create group: %w", err)
+	}
+	if a.cw != nil {
+		g := a.groupFromInfo(info)
+		g.Name = name
+		g.ParentJID = parent.String()
+		g.ParentName = a.cw.ParentCommunityName(g.ParentJID)
+		if err := a.cw.StoreGroup(g); err != nil {
+			log.Println("CreateSubGroup: failed to store group:", info.JID.String(), err)
+		}
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+
+	return CommunityGroup{JID: info.JID.String(), Name: name}, nil
+}
+
+// announcementGroupJID resolves a community's announcement group, preferring
+// the group cache and falling back to the server's sub-group list.
+func (a *Api) announcementGroupJID(parent types.JID) (types.JID, error) {
+	if a.cw != nil {
+		if g, err := a.cw.FetchAnnouncementGroup(parent.String()); err == nil {
+			if jid, err := types.ParseJID(g.JID); err == nil {
+				return jid, nil
+			}
+		}
+	}
+	subGroups, err := a.waClient.GetSubGroups(a.ctx, parent)
+	if err != nil {
+		return types.JID{}, fmt.Errorf("failed to fetch community groups: %w", err)
+	}
+	for _, sg := range subGroups {
+		if sg != nil && sg.IsDefaultSubGroup {
+			a.cacheGroupLink(sg.JID, parent, wa.Group{Name: sg.Name, IsDefaultSub: true})
+			return sg.JID, nil
+		}
+	}
+	return types.JID{}, fmt.Errorf("community has no announcement group")
+}
+
+// SendCommunityAnnouncement posts a text message to the community's
+// announcement group. Only community admins are allowed to post there.
+func (a *Api) SendCommunityAnnouncement(communityJID, text string) (string, error) {
+	if a.waClient == nil {
+		return "", fmt.Errorf("client not ready")
+	}
+	parent, err := parseGroupJID(communityJID)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("announcement is empty")
+	}
+	announcement, err := a.announcementGroupJID(parent)
+	if err != nil {
+		return "", err
+	}
+	return a.SendMessage(announcement.String(), MessageContent{Type: "text", Text: text})
+}
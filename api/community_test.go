@@ -61,3 +61,76 @@ func TestGetCommunityListReturnsPopulatedCache(t *testing.T) {
 		t.Fatalf("unexpected community: %+v", communities[0])
 	}
 }
+
+func TestGroupParentUpdatesKeepCommunityCacheConsistent(t *testing.T) {
+	originalConfigDir := misc.ConfigDir
+	misc.ConfigDir = t.TempDir()
+	t.Cleanup(func() { misc.ConfigDir = originalConfigDir })
+
+	db, err := sql.Open("sqlite3", misc.GetSQLiteAddress("app.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(query.CreateGroupsTable); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	appDB, err := wa.NewAppDatabase(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = appDB.Close() })
+	for _, g := range []wa.Group{
+		{JID: "community@g.us", Name: "Test community", IsParent: true},
+		{JID: "announce@g.us", Name: "Test community", ParentJID: "community@g.us", IsDefaultSub: true},
+		{JID: "group@g.us", Name: "Test group"},
+	} {
+		if err := appDB.StoreGroup(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &Api{cw: appDB, waClient: &whatsmeow.Client{}}
+	groupCount := func() int {
+		t.Helper()
+		communities, err := a.communitiesFromCache()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(communities) != 1 {
+			t.Fatalf("got %d communities, want 1", len(communities))
+		}
+		return communities[0].GroupCount
+	}
+
+	if got := groupCount(); got != 1 {
+		t.Fatalf("group count before link = %d, want 1", got)
+	}
+	updated, err := appDB.SetGroupParent("group@g.us", "community@g.us", "Test community")
+	if err != nil || !updated {
+		t.Fatalf("SetGroupParent = %v, %v; want true, nil", updated, err)
+	}
+	if got := groupCount(); got != 2 {
+		t.Fatalf("group count after link = %d, want 2", got)
+	}
+	if _, err := appDB.SetGroupParent("group@g.us", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := groupCount(); got != 1 {
+		t.Fatalf("group count after unlink = %d, want 1", got)
+	}
+	if updated, _ := appDB.SetGroupParent("missing@g.us", "community@g.us", ""); updated {
+		t.Fatal("SetGroupParent reported an update for an uncached group")
+	}
+
+	announcement, err := appDB.FetchAnnouncementGroup("community@g.us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if announcement.JID != "announce@g.us" {
+		t.Fatalf("announcement group = %s, want announce@g.us", announcement.JID)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Connection states reported on wa:connection.
+const (
+	ConnectionConnecting = "connecting"
+	ConnectionSyncing    = "syncing"
+	ConnectionOnline     = "online"
+	ConnectionOffline    = "offline"
+)
+
+// ConnectionState is the current state of the WhatsApp connection.
+type ConnectionState struct {
+	State string `json:"state"`
+	// Reason says why the connection is offline (or reconnecting).
+	Reason string `json:"reason,omitempty"`
+	// SyncDone and SyncTotal count the events missed while offline that the
+	// server is replaying; only set while syncing.
+	SyncDone  int `json:"sync_done,omitempty"`
+	SyncTotal int `json:"sync_total,omitempty"`
+	// ReconnectAttempts counts failed or dropped connections since the last
+	// successful one.
+	ReconnectAttempts int    `json:"reconnect_attempts"`
+	LastError         string `json:"last_error,omitempty"`
+	LastErrorAt       int64  `json:"last_error_at,omitempty"`
+	// Since is when the connection entered this state, in unix seconds.
+	Since int64 `json:"since"`
+}
+
+// connectionTracker is the single owner of the connection state. Every
+// transition is reported through onChange.
+type connectionTracker struct {
+	mu       sync.Mutex
+	state    ConnectionState
+	onChange func(ConnectionState)
+}
+
+func newConnectionTracker(onChange func(ConnectionState)) *connectionTracker {
+	return &connectionTracker{
+		state:    ConnectionState{State: ConnectionOffline, Reason: "not connected", Since: time.Now().Unix()},
+		onChange: onChange,
+	}
+}
+
+// update applies fn to the state and reports the result when fn returns true.
+func (ct *connectionTracker) update(fn func(s *ConnectionState) bool) {
+	ct.mu.Lock()
+	prev := ct.state.State
+	if !fn(&ct.state) {
+		ct.mu.Unlock()
+		return
+	}
+	if ct.state.State != prev {
+		ct.state.Since = time.Now().Unix()
+	}
+	if ct.state.State != ConnectionSyncing {
+		ct.state.SyncDone, ct.state.SyncTotal = 0, 0
+	}
+	s := ct.state
+	ct.mu.Unlock()
+
+	ct.onChange(s)
+}
+
+func (ct *connectionTracker) State() ConnectionState {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.state
+}
+
+func (ct *connectionTracker) Connecting(reason string) {
+	ct.update(func(s *ConnectionState) bool {
+		s.State, s.Reason = ConnectionConnecting, reason
+		return true
+	})
+}
+
+func (ct *connectionTracker) Online() {
+	ct.update(func(s *ConnectionState) bool {
+		s.State, s.Reason = ConnectionOnline, ""
+		s.ReconnectAttempts = 0
+		return true
+	})
+}
+
+// Offline records a lost or refused connection. A non-nil err is kept as the
+// last error; retrying counts it as a reconnect attempt.
+func (ct *connectionTracker) Offline(reason string, err error, retrying bool) {
+	ct.update(func(s *ConnectionState) bool {
+		s.State, s.Reason = ConnectionOffline, reason
+		if err != nil {
+			s.LastError = err.Error()
+			s.LastErrorAt = time.Now().Unix()
+		}
+		if retrying {
+			s.ReconnectAttempts++
+		}
+		return true
+	})
+}
+
+// SyncStarted switches to syncing when the server announces missed events.
+func (ct *connectionTracker) SyncStarted(total int) {
+	if total <= 0 {
+		return
+	}
+	ct.update(func(s *ConnectionState) bool {
+		s.State, s.Reason = ConnectionSyncing, ""
+		s.SyncDone, s.SyncTotal = 0, total
+		return true
+	})
+}
+
+// SyncProgress counts one replayed event. Updates are only reported when the
+// percentage changes so a large backlog doesn't flood the frontend.
+func (ct *connectionTracker) SyncProgress() {
+	ct.update(func(s *ConnectionState) bool {
+		if s.State != ConnectionSyncing || s.SyncDone >= s.SyncTotal {
+			return false
+		}
+		before := s.SyncDone * 100 / s.SyncTotal
+		s.SyncDone++
+		return s.SyncDone*100/s.SyncTotal != before
+	})
+}
+
+// SyncCompleted ends a sync; the connection is online afterwards.
+func (ct *connectionTracker) SyncCompleted() {
+	ct.update(func(s *ConnectionState) bool {
+		if s.State != ConnectionSyncing {
+			return false
+		}
+		s.State = ConnectionOnline
+		return true
+	})
+}
+
+func (a *Api) emitConnection(s ConnectionState) {
+	if a.ctx == nil || a.isShuttingDown() {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "wa:connection", s)
+}
+
+// handleConnectionEvent feeds connection-related whatsmeow events into the
+// tracker. Events that need more handling still go through mainEventHandler's
+// switch.
+func (a *Api) handleConnectionEvent(evt any) {
+	ct := a.connection
+	switch v := evt.(type) {
+	case *events.Connected, *events.KeepAliveRestored:
+		ct.Online()
+	case *events.OfflineSyncPreview:
+		ct.SyncStarted(v.Total)
+	case *events.OfflineSyncCompleted:
+		ct.SyncCompleted()
+	case *events.Message, *events.Receipt, *events.UndecryptableMessage:
+		ct.SyncProgress()
+	case *events.Disconnected:
+		ct.Offline("connection lost, reconnecting", nil, true)
+	case *events.KeepAliveTimeout:
+		ct.Offline(fmt.Sprintf("server not responding (%d missed keepalives)", v.ErrorCount), errors.New("keepalive timeout"), false)
+	case *events.ConnectFailure:
+		reason := v.Reason.String()
+		if v.Message != "" {
+			reason += ": " + v.Message
+		}
+		ct.Offline(reason, fmt.Errorf("connect failure %d: %s", int(v.Reason), reason), false)
+	case *events.ClientOutdated:
+		ct.Offline("this version of whats4linux is outdated", errors.New("client outdated"), false)
+	case *events.LoggedOut:
+		ct.Offline("logged out", errors.New(v.Reason.String()), false)
+	case *events.StreamReplaced:
+		ct.Offline("opened on another computer", nil, false)
+	case *events.TemporaryBan:
+		ct.Offline("temporarily banned", errors.New(v.String()), false)
+	}
+}
+
+// autoReconnectFailed is the client's AutoReconnectHook. whatsmeow keeps
+// retrying; this only records the failure.
+func (a *Api) autoReconnectFailed(err error) bool {
+	a.connection.Offline("reconnect failed, retrying", err, true)
+	return true
+}
+
+// GetConnectionState returns the current connection state.
+func (a *Api) GetConnectionState() ConnectionState {
+	return a.connection.State()
+}
+
+// Reconnect drops the current connection (if any) and connects again right
+// away instead of waiting for the automatic reconnect backoff.
+func (a *Api) Reconnect() error {
+	if a.isShuttingDown() {
+		return errors.New("shutting down")
+	}
+	a.lifecycleMu.Lock()
+	client := a.waClient
+	a.lifecycleMu.Unlock()
+	if client == nil || client.Store.ID == nil {
+		return errors.New("not logged in")
+	}
+	client.Disconnect()
+	a.connection.Connecting("reconnecting")
+	if err := client.Connect(); err != nil {
+		a.connection.Offline("reconnect failed", err, true)
+		return fmt.Errorf("failed to reconnect: %w", err)
+	}
+	return nil
+}
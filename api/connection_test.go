@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectionTrackerSyncProgress(t *testing.T) {
+	var got []ConnectionState
+	ct := newConnectionTracker(func(s ConnectionState) { got = append(got, s) })
+
+	ct.Offline("connection lost, reconnecting", nil, true)
+	ct.Offline("reconnect failed, retrying", errors.New("dial tcp: timeout"), true)
+	if s := ct.State(); s.ReconnectAttempts != 2 || s.LastError != "dial tcp: timeout" {
+		t.Fatalf("state after failures = %+v, want 2 attempts and the last error", s)
+	}
+
+	ct.Online()
+	ct.SyncStarted(200)
+	got = nil
+	for i := 0; i < 200; i++ {
+		ct.SyncProgress()
+	}
+	// Reported once per percent, not once per event.
+	if len(got) != 100 {
+		t.Fatalf("progress updates = %d, want 100", len(got))
+	}
+	if last := got[len(got)-1]; last.SyncDone != 200 || last.SyncTotal != 200 {
+		t.Fatalf("last progress = %+v, want 200/200", last)
+	}
+	ct.SyncProgress()
+	if len(got) != 100 {
+		t.Fatal("events past the announced total were reported")
+	}
+
+	ct.SyncCompleted()
+	s := ct.State()
+	if s.State != ConnectionOnline || s.SyncTotal != 0 || s.ReconnectAttempts != 0 {
+		t.Fatalf("state after sync = %+v, want online with counters cleared", s)
+	}
+	if s.LastError == "" {
+		t.Fatal("last error should survive reconnecting")
+	}
+}
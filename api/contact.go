@@ -17,6 +17,12 @@ type Contact struct {
 	PushName   string `json:"push_name"`
 	IsBusiness bool   `json:"is_business"`
 	AvatarURL  string `json:"avatar_url"`
+	// DisplayName is the name to show, picked by displayName.
+	DisplayName string `json:"display_name"`
+	// Nickname, Notes and Color are set locally (see ContactOverride).
+	Nickname string `json:"nickname"`
+	Notes    string `json:"notes"`
+	Color    string `json:"color"`
 }
 
 func canonicalUserJID(ctx context.Context, client *whatsmeow.Client, jid types.JID) types.JID {
@@ -30,10 +36,12 @@ func canonicalUserJID(ctx context.Context, client *whatsmeow.Client, jid types.J
 
 func (a *Api) GetContact(jid types.JID) (*Contact, error) {
 	jid = canonicalUserJID(a.ctx, a.waClient, jid)
-	contact, err := a.waClient.Store.Contacts.GetContact(a.ctx, jid)
+	contacts, err := a.lookupContacts([]types.JID{jid})
 	if err != nil {
 		return nil, err
 	}
+	contact := contacts[jid]
+	o := a.contactOverrides()[jid.String()]
 	rawNum := "+" + jid.User
 	// Parse phone number to use as International Format
 	num, err := phonenumbers.Parse(rawNum, "")
@@ -42,12 +50,16 @@ func (a *Api) GetContact(jid types.JID) (*Contact, error) {
 	}
 
 	return &Contact{
-		Phno:       phonenumbers.Format(num, phonenumbers.INTERNATIONAL),
-		JID:        jid.String(),
-		FullName:   contact.FullName,
-		Short:      contact.FirstName,
-		PushName:   contact.PushName,
-		IsBusiness: contact.BusinessName != "",
+		Phno:        phonenumbers.Format(num, phonenumbers.INTERNATIONAL),
+		JID:         jid.String(),
+		FullName:    contact.FullName,
+		Short:       contact.FirstName,
+		PushName:    contact.PushName,
+		IsBusiness:  contact.BusinessName != "",
+		DisplayName: displayName(jid, contact, o.Nickname),
+		Nickname:    o.Nickname,
+		Notes:       o.Notes,
+		Color:       o.Color,
 	}, nil
 }
 
@@ -56,6 +68,7 @@ func (a *Api) FetchContacts() ([]Contact, error) {
 	if err != nil {
 		return nil, err
 	}
+	overrides := a.contactOverrides()
 	contacts := make([]Contact, 0, len(rawContacts))
 	for jid, c := range rawContacts {
 		rawNum := "+" + jid.User
@@ -65,13 +78,18 @@ func (a *Api) FetchContacts() ([]Contact, error) {
 			continue
 		}
 
+		o := overrides[jid.String()]
 		contacts = append(contacts, Contact{
-			Phno:       phonenumbers.Format(num, phonenumbers.INTERNATIONAL),
-			JID:        jid.String(),
-			FullName:   c.FullName,
-			Short:      c.FirstName,
-			PushName:   c.PushName,
-			IsBusiness: c.BusinessName != "",
+			Phno:        phonenumbers.Format(num, phonenumbers.INTERNATIONAL),
+			JID:         jid.String(),
+			FullName:    c.FullName,
+			Short:       c.FirstName,
+			PushName:    c.PushName,
+			IsBusiness:  c.BusinessName != "",
+			DisplayName: displayName(jid, c, o.Nickname),
+			Nickname:    o.Nickname,
+			Notes:       o.Notes,
+			Color:       o.Color,
 		})
 	}
 	return contacts, nil
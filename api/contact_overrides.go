@@ -0,0 +1,342 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/vcard"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"github.com/nyaruka/phonenumbers"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// vcardColorProp carries the override color in exported vCards.
+const vcardColorProp = "X-WHATS4LINUX-COLOR"
+
+var overrideColorRE = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ContactOverride is a nickname, notes and avatar color set for a contact on
+// this computer only.
+type ContactOverride struct {
+	JID      string `json:"jid"`
+	Nickname string `json:"nickname"`
+	Notes    string `json:"notes"`
+	Color    string `json:"color"`
+}
+
+// overrideCache keeps contact_overrides in memory: the table is small and
+// read for every displayed name. Writers replace the map, so a map returned
+// by get is never modified.
+type overrideCache struct {
+	mu sync.Mutex
+	m  map[string]wa.ContactOverride // nil until loaded
+}
+
+func (a *Api) contactOverrides() map[string]wa.ContactOverride {
+	if a.overrides == nil || a.cw == nil {
+		return nil
+	}
+	oc := a.overrides
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if oc.m == nil {
+		m, err := a.cw.FetchContactOverrides()
+		if err != nil {
+			log.Println("Failed to load contact overrides:", err)
+			return nil
+		}
+		oc.m = m
+	}
+	return oc.m
+}
+
+// storeContactOverrides saves overrides and updates the cache.
+func (a *Api) storeContactOverrides(overrides ...wa.ContactOverride) error {
+	if err := a.cw.StoreContactOverrides(overrides...); err != nil {
+		return err
+	}
+	if a.overrides == nil {
+		return nil
+	}
+	oc := a.overrides
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	if oc.m == nil {
+		return nil // loaded with the new rows on next use
+	}
+	m := maps.Clone(oc.m)
+	for _, o := range overrides {
+		if o.IsEmpty() {
+			delete(m, o.JID)
+		} else {
+			m[o.JID] = o
+		}
+	}
+	oc.m = m
+	return nil
+}
+
+// resetContactOverrides drops the cache after app.db was replaced.
+func (a *Api) resetContactOverrides() {
+	if a.overrides == nil {
+		return
+	}
+	a.overrides.mu.Lock()
+	a.overrides.m = nil
+	a.overrides.mu.Unlock()
+}
+
+// nickname returns the local nickname of a user, or "".
+func (a *Api) nickname(jid types.JID) string {
+	return a.contactOverrides()[a.userJID(jid).String()].Nickname
+}
+
+func parseOverrideColor(color string) (string, error) {
+	color = strings.TrimSpace(color)
+	if color == "" {
+		return "", nil
+	}
+	if !overrideColorRE.MatchString(color) {
+		return "", fmt.Errorf("invalid color %q (use #rrggbb)", color)
+	}
+	return strings.ToLower(color), nil
+}
+
+// GetContactOverride returns what was set locally for a contact; fields are
+// empty when nothing was.
+func (a *Api) GetContactOverride(jidStr string) (ContactOverride, error) {
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return ContactOverride{}, err
+	}
+	key := a.userJID(jid).String()
+	o := a.contactOverrides()[key]
+	return ContactOverride{JID: key, Nickname: o.Nickname, Notes: o.Notes, Color: o.Color}, nil
+}
+
+// SetContactOverride stores a contact's nickname, notes and color. Empty
+// fields clear them; clearing all three removes the override.
+func (a *Api) SetContactOverride(o ContactOverride) error {
+	jid, err := types.ParseJID(o.JID)
+	if err != nil {
+		return err
+	}
+	if jid.Server == types.GroupServer || jid.Server == types.NewsletterServer {
+		return errors.New("overrides can only be set for contacts")
+	}
+	color, err := parseOverrideColor(o.Color)
+	if err != nil {
+		return err
+	}
+	err = a.storeContactOverrides(wa.ContactOverride{
+		JID:      a.userJID(jid).String(),
+		Nickname: strings.TrimSpace(o.Nickname),
+		Notes:    strings.TrimSpace(o.Notes),
+		Color:    color,
+	})
+	if err != nil {
+		return err
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return nil
+}
+
+// ExportContactsVCard asks where to save and writes every saved or
+// locally-renamed contact as a vCard file. It returns the path written, or
+// "" when cancelled.
+func (a *Api) ExportContactsVCard() (string, error) {
+	data, err := a.exportContactsVCard()
+	if err != nil {
+		return "", err
+	}
+	homeDir, _ := os.UserHomeDir()
+	path, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		DefaultDirectory: homeDir,
+		DefaultFilename:  "whats4linux-contacts.vcf",
+		Title:            "Export contacts",
+		Filters:          []runtime.FileFilter{{DisplayName: "vCard", Pattern: "*.vcf"}},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		return "", fmt.Errorf("failed to write contacts: %w", err)
+	}
+	return path, nil
+}
+
+func (a *Api) exportContactsVCard() (string, error) {
+	overrides := a.contactOverrides()
+	infos := make(map[types.JID]types.ContactInfo)
+	if a.waClient != nil {
+		all, err := a.waClient.Store.Contacts.GetAllContacts(a.ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to load contacts: %w", err)
+		}
+		for jid, info := range all {
+			if savedName(info, "") && jid.Server == types.DefaultUserServer {
+				infos[jid] = info
+			}
+		}
+	}
+	for key := range overrides {
+		if jid, err := types.ParseJID(key); err == nil && jid.Server == types.DefaultUserServer {
+			if _, ok := infos[jid]; !ok {
+				infos[jid] = a.contactInfos([]types.JID{jid})[jid]
+			}
+		}
+	}
+
+	cards := make([]vcard.Card, 0, len(infos))
+	for _, jid := range slices.SortedFunc(maps.Keys(infos), func(x, y types.JID) int {
+		return strings.Compare(x.User, y.User)
+	}) {
+		o := overrides[jid.String()]
+		card := vcard.Card{
+			FN:       displayName(jid, infos[jid], o.Nickname),
+			Nickname: o.Nickname,
+			Note:     o.Notes,
+			Tels:     []vcard.Tel{{Number: formatNumber(jid, infos[jid]), WAID: jid.User}},
+		}
+		if o.Color != "" {
+			card.Ext = map[string]string{vcardColorProp: o.Color}
+		}
+		cards = append(cards, card)
+	}
+	return vcard.Encode(cards), nil
+}
+
+// ImportContactsVCard asks for a vCard file and stores its names, notes
+// and colors as local overrides. Cards without a usable phone number are
+// skipped. It returns how many contacts were imported.
+func (a *Api) ImportContactsVCard() (int, error) {
+	homeDir, _ := os.UserHomeDir()
+	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		DefaultDirectory: homeDir,
+		Title:            "Import contacts",
+		Filters:          []runtime.FileFilter{{DisplayName: "vCard", Pattern: "*.vcf;*.vcard"}},
+	})
+	if err != nil || path == "" {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read contacts: %w", err)
+	}
+	n, err := a.importContactsVCard(string(data))
+	if err != nil {
+		return 0, err
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return n, nil
+}
+
+// importContactsVCard merges cards into the overrides: a card's nickname,
+// notes and color replace what is stored, and what the card leaves out is
+// kept. A card's name only becomes a nickname when it differs from the name
+// the contact already shows, so importing an export doesn't pin address
+// book names.
+func (a *Api) importContactsVCard(data string) (int, error) {
+	cards, err := vcard.Parse(data)
+	if err != nil {
+		return 0, fmt.Errorf("invalid vCard file: %w", err)
+	}
+	region := a.homeRegion()
+	users := make([]types.JID, len(cards))
+	for i, card := range cards {
+		users[i] = cardUser(card, region)
+	}
+	infos := a.contactInfos(slices.DeleteFunc(slices.Clone(users), types.JID.IsEmpty))
+
+	current := a.contactOverrides()
+	merged := make(map[string]wa.ContactOverride)
+	for i, card := range cards {
+		jid := users[i]
+		if jid.IsEmpty() {
+			continue
+		}
+		key := jid.String()
+		o, ok := merged[key]
+		if !ok {
+			o = current[key]
+			o.JID = key
+		}
+		if name := strings.TrimSpace(card.Nickname); name != "" {
+			o.Nickname = name
+		} else if name := strings.TrimSpace(card.FN); name != "" && name != displayName(jid, infos[jid], "") {
+			o.Nickname = name
+		}
+		if note := strings.TrimSpace(card.Note); note != "" {
+			o.Notes = note
+		}
+		if color, err := parseOverrideColor(card.Ext[vcardColorProp]); err == nil && color != "" {
+			o.Color = color
+		}
+		merged[key] = o
+	}
+	if len(merged) == 0 {
+		return 0, nil
+	}
+	if err := a.storeContactOverrides(slices.Collect(maps.Values(merged))...); err != nil {
+		return 0, err
+	}
+	return len(merged), nil
+}
+
+// cardUser returns the WhatsApp user a card belongs to, or an empty JID:
+// the waid WhatsApp puts on its own cards, or else the first valid phone
+// number. Numbers
+// without a country code are read as numbers in region; with no region they
+// are skipped, since their digits alone would name someone else.
+func cardUser(card vcard.Card, region string) types.JID {
+	for _, tel := range card.Tels {
+		if tel.WAID == "" {
+			continue
+		}
+		if digits := tel.Digits(); digits != "" {
+			return types.NewJID(digits, types.DefaultUserServer)
+		}
+	}
+	for _, tel := range card.Tels {
+		num, err := phonenumbers.Parse(tel.Number, region)
+		if err != nil || !phonenumbers.IsValidNumber(num) {
+			continue
+		}
+		e164 := phonenumbers.Format(num, phonenumbers.E164)
+		return types.NewJID(strings.TrimPrefix(e164, "+"), types.DefaultUserServer)
+	}
+	return types.EmptyJID
+}
+
+// homeRegion returns the country of the account's own number, or "" when
+// logged out.
+func (a *Api) homeRegion() string {
+	if a.waClient == nil || a.waClient.Store.ID == nil {
+		return ""
+	}
+	num, err := phonenumbers.Parse("+"+a.waClient.Store.ID.User, "")
+	if err != nil {
+		return ""
+	}
+	return phonenumbers.GetRegionCodeForNumber(num)
+}
+
+// GetProfileColor returns the avatar color of a chat: the contact's override
+// when set, otherwise one derived from the JID.
+func (a *Api) GetProfileColor(jidStr string) string {
+	if jid, err := types.ParseJID(jidStr); err == nil {
+		if o, ok := a.contactOverrides()[a.userJID(jid).String()]; ok && o.Color != "" {
+			return o.Color
+		}
+	}
+	return misc.GetProfileColor(jidStr)
+}
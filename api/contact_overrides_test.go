@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/vcard"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestImportContactsVCardMergesOverrides(t *testing.T) {
+	originalConfigDir := misc.ConfigDir
+	misc.ConfigDir = t.TempDir()
+	t.Cleanup(func() { misc.ConfigDir = originalConfigDir })
+
+	appDB, err := wa.NewAppDatabase(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = appDB.Close() })
+	a := &Api{cw: appDB, overrides: &overrideCache{}}
+
+	if err := appDB.StoreContactOverrides(wa.ContactOverride{
+		JID: "14155550123@s.whatsapp.net", Nickname: "Old", Notes: "met at work",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := a.importContactsVCard("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Alice Smith\r\n" +
+		"TEL;type=CELL;waid=14155550123:+1 415-555-0123\r\nX-WHATS4LINUX-COLOR:#AABBCC\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nFN:No number\r\nEND:VCARD\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("imported %d contacts, want 1", n)
+	}
+
+	jid := types.NewJID("14155550123", types.DefaultUserServer)
+	want := wa.ContactOverride{JID: jid.String(), Nickname: "Alice Smith", Notes: "met at work", Color: "#aabbcc"}
+	if got := a.contactOverrides()[jid.String()]; got != want {
+		t.Fatalf("override = %+v, want %+v", got, want)
+	}
+	if got := a.displayNameOf(jid, "al"); got != "Alice Smith" {
+		t.Fatalf("displayNameOf = %q, want the nickname", got)
+	}
+	if got := a.GetProfileColor(jid.String()); got != "#aabbcc" {
+		t.Fatalf("GetProfileColor = %q, want the override", got)
+	}
+
+	// The cache must match what a fresh load reads back.
+	a.resetContactOverrides()
+	if got := a.contactOverrides()[jid.String()]; got != want {
+		t.Fatalf("stored override = %+v, want %+v", got, want)
+	}
+
+	data, err := a.exportContactsVCard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"FN:Alice Smith", "NICKNAME:Alice Smith", "waid=14155550123", "NOTE:met at work", "X-WHATS4LINUX-COLOR:#aabbcc"} {
+		if !strings.Contains(data, line) {
+			t.Errorf("export is missing %q:\n%s", line, data)
+		}
+	}
+}
+
+func TestCardUser(t *testing.T) {
+	for _, tc := range []struct {
+		tel    vcard.Tel
+		region string
+		want   string
+	}{
+		{vcard.Tel{Number: "098765 43210", WAID: "919876543210"}, "", "919876543210"},
+		{vcard.Tel{Number: "+91 98765 43210"}, "", "919876543210"},
+		{vcard.Tel{Number: "098765 43210"}, "IN", "919876543210"},
+		{vcard.Tel{Number: "020 7946 0018"}, "GB", "442079460018"},
+		{vcard.Tel{Number: "098765 43210"}, "", ""}, // no country code to go on
+		{vcard.Tel{Number: "12"}, "IN", ""},
+	} {
+		got := cardUser(vcard.Card{Tels: []vcard.Tel{tc.tel}}, tc.region)
+		if got.User != tc.want {
+			t.Errorf("cardUser(%+v, %q) = %q, want %q", tc.tel, tc.region, got.User, tc.want)
+		}
+	}
+}
+
+func TestImportContactsVCardSkipsCurrentNames(t *testing.T) {
+	originalConfigDir := misc.ConfigDir
+	misc.ConfigDir = t.TempDir()
+	t.Cleanup(func() { misc.ConfigDir = originalConfigDir })
+
+	appDB, err := wa.NewAppDatabase(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = appDB.Close() })
+	a := &Api{cw: appDB, overrides: &overrideCache{}}
+
+	// Without contact info the current name is the number, as an export
+	// of an unnamed contact writes it.
+	if _, err := a.importContactsVCard("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:+1 415-555-0123\r\n" +
+		"TEL;waid=14155550123:+1 415-555-0123\r\nNOTE:met at work\r\nEND:VCARD\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	want := wa.ContactOverride{JID: "14155550123@s.whatsapp.net", Notes: "met at work"}
+	if got := a.contactOverrides()[want.JID]; got != want {
+		t.Fatalf("override = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,508 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/lugvitc/whats4linux/internal/cache"
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// maxParallelDownloads bounds how many media downloads run at once; a chat
+// full of images queues the rest.
+const maxParallelDownloads = 3
+
+// maxEndedDownloads is how many failed and cancelled downloads are kept
+// for GetDownloads and RetryDownload.
+const maxEndedDownloads = 50
+
+// Download states reported on wa:download_progress.
+const (
+	DownloadQueued    = "queued"
+	DownloadRunning   = "downloading"
+	DownloadPaused    = "paused"
+	DownloadDone      = "done"
+	DownloadFailed    = "failed"
+	DownloadCancelled = "cancelled"
+)
+
+var (
+	errDownloadCancelled = errors.New("download cancelled")
+	errDownloadShutdown  = errors.New("shutting down")
+)
+
+// DownloadProgress is the payload of wa:download_progress and an entry of
+// GetDownloads.
+type DownloadProgress struct {
+	MessageID string `json:"messageId"`
+	ChatJID   string `json:"chatId"`
+	State     string `json:"state"`
+	Done      int64  `json:"done"`
+	// Total is 0 when the size isn't known.
+	Total int64  `json:"total"`
+	Error string `json:"error,omitempty"`
+	// Background is set for auto-downloads nobody has asked for yet.
+	Background bool `json:"background,omitempty"`
+}
+
+// download is a message's media on its way into the media cache.
+type download struct {
+	msg        *store.ExtendedMessage
+	partial    *cache.Partial
+	background bool
+	cancel     context.CancelFunc
+	// percent is the last progress reported, to report once per percent.
+	percent  int64
+	progress DownloadProgress
+}
+
+// downloadManager runs media downloads on at most limit workers, in the
+// order they were queued, background downloads after the rest. Background
+// downloads that can't run on a metered connection are held until resume.
+// It doesn't check for duplicates: the media cache hands out the running
+// download of a message to anyone asking again, and only the first asker
+// queues it.
+type downloadManager struct {
+	mu      sync.Mutex
+	limit   int
+	workers int
+	queue   []*download
+	running []*download
+	held    []*download
+	// active holds the queued, running and held downloads by message ID;
+	// ended the failed and cancelled ones, oldest first.
+	active map[string]*download
+	ended  []*download
+
+	start func(task func()) bool
+	run   func(ctx context.Context, d *download, report func(done int64)) error
+	emit  func(DownloadProgress)
+}
+
+func newDownloadManager(limit int, start func(task func()) bool, run func(ctx context.Context, d *download, report func(done int64)) error, emit func(DownloadProgress)) *downloadManager {
+	return &downloadManager{
+		limit:  limit,
+		active: make(map[string]*download),
+		start:  start,
+		run:    run,
+		emit:   emit,
+	}
+}
+
+// add queues d. When the app is shutting down it fails d instead.
+func (m *downloadManager) add(d *download) {
+	id := d.msg.Info.ID
+	d.progress = DownloadProgress{
+		MessageID:  id,
+		ChatJID:    d.msg.Info.Chat.String(),
+		State:      DownloadQueued,
+		Total:      int64(d.msg.Media.GetFileLength()),
+		Background: d.background,
+	}
+	m.emit(d.progress)
+
+	m.mu.Lock()
+	m.dropEndedLocked(id)
+	m.active[id] = d
+	m.enqueueLocked(d)
+	startWorker := m.workers < m.limit
+	if startWorker {
+		m.workers++
+	}
+	m.mu.Unlock()
+
+	if startWorker && !m.start(m.work) {
+		m.mu.Lock()
+		m.workers--
+		queued := m.unqueueLocked(d)
+		m.mu.Unlock()
+		if queued {
+			m.end(d, errDownloadShutdown)
+		}
+	}
+}
+
+// enqueueLocked queues d behind the downloads of its priority.
+func (m *downloadManager) enqueueLocked(d *download) {
+	i := len(m.queue)
+	if !d.background {
+		i = 0
+		for i < len(m.queue) && !m.queue[i].background {
+			i++
+		}
+	}
+	m.queue = slices.Insert(m.queue, i, d)
+}
+
+// promote moves a queued background download ahead of the others once
+// someone asks for it.
+func (m *downloadManager) promote(messageID string) {
+	m.mu.Lock()
+	d, ok := m.active[messageID]
+	// A running download has nothing to move ahead of.
+	if !ok || !d.background || d.cancel != nil {
+		m.mu.Unlock()
+		return
+	}
+	d.background = false
+	d.progress.Background = false
+	if m.unqueueLocked(d) {
+		d.progress.State = DownloadQueued
+		m.enqueueLocked(d)
+	}
+	p := d.progress
+	workers := m.reserveWorkersLocked()
+	m.mu.Unlock()
+	m.emit(p)
+	m.startWorkers(workers)
+}
+
+// unqueueLocked takes d off the queue or the held downloads, reporting
+// whether it was still waiting.
+func (m *downloadManager) unqueueLocked(d *download) bool {
+	for _, list := range []*[]*download{&m.queue, &m.held} {
+		if i := slices.Index(*list, d); i >= 0 {
+			*list = slices.Delete(*list, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// reserveWorkersLocked counts in the workers the queue needs, up to the
+// limit, and returns how many to start.
+func (m *downloadManager) reserveWorkersLocked() int {
+	n := max(0, min(m.limit-m.workers, len(m.queue)))
+	m.workers += n
+	return n
+}
+
+// startWorkers starts n reserved workers. Those refused while shutting down
+// are given back; cancelAll ends what they would have run.
+func (m *downloadManager) startWorkers(n int) {
+	for range n {
+		if !m.start(m.work) {
+			m.mu.Lock()
+			m.workers--
+			m.mu.Unlock()
+		}
+	}
+}
+
+// hold parks a background download that can't run on a metered connection
+// until resume. It reports false when the download was cancelled meanwhile.
+func (m *downloadManager) hold(ctx context.Context, d *download) bool {
+	m.mu.Lock()
+	if ctx.Err() != nil {
+		m.mu.Unlock()
+		return false
+	}
+	if i := slices.Index(m.running, d); i >= 0 {
+		m.running = slices.Delete(m.running, i, i+1)
+	}
+	d.cancel = nil
+	d.progress.State = DownloadPaused
+	m.held = append(m.held, d)
+	p := d.progress
+	m.mu.Unlock()
+	m.emit(p)
+	return true
+}
+
+// resume queues the held downloads again.
+func (m *downloadManager) resume() {
+	m.mu.Lock()
+	held := m.held
+	m.held = nil
+	progress := make([]DownloadProgress, len(held))
+	for i, d := range held {
+		d.progress.State = DownloadQueued
+		m.enqueueLocked(d)
+		progress[i] = d.progress
+	}
+	workers := m.reserveWorkersLocked()
+	m.mu.Unlock()
+	for _, p := range progress {
+		m.emit(p)
+	}
+	m.startWorkers(workers)
+}
+
+// work runs queued downloads until the queue is empty.
+func (m *downloadManager) work() {
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			m.workers--
+			m.mu.Unlock()
+			return
+		}
+		d := m.queue[0]
+		m.queue = m.queue[1:]
+		ctx, cancel := context.WithCancel(context.Background())
+		d.cancel = cancel
+		m.running = append(m.running, d)
+		d.progress.State = DownloadRunning
+		p := d.progress
+		m.mu.Unlock()
+
+		m.emit(p)
+		err := m.run(ctx, d, func(done int64) { m.report(d, done) })
+		if errors.Is(err, errAutoDownloadPaused) && m.hold(ctx, d) {
+			cancel()
+			continue
+		}
+		if ctx.Err() != nil {
+			err = errDownloadCancelled
+		}
+		cancel()
+		m.end(d, err)
+	}
+}
+
+// report emits the progress of a running download once per percent.
+func (m *downloadManager) report(d *download, done int64) {
+	m.mu.Lock()
+	d.progress.Done = done
+	percent := int64(0)
+	if d.progress.Total > 0 {
+		percent = done * 100 / d.progress.Total
+	}
+	if percent == d.percent {
+		m.mu.Unlock()
+		return
+	}
+	d.percent = percent
+	p := d.progress
+	m.mu.Unlock()
+	m.emit(p)
+}
+
+// end records how d ended and finishes its file in the cache.
+func (m *downloadManager) end(d *download, err error) {
+	if d.partial != nil {
+		err = d.partial.Finish(err)
+	}
+	m.mu.Lock()
+	// A download queued again since has taken its place.
+	if m.active[d.progress.MessageID] == d {
+		delete(m.active, d.progress.MessageID)
+	}
+	for i, r := range m.running {
+		if r == d {
+			m.running = append(m.running[:i], m.running[i+1:]...)
+			break
+		}
+	}
+	switch {
+	case err == nil:
+		d.progress.State = DownloadDone
+	case errors.Is(err, errDownloadCancelled):
+		d.progress.State = DownloadCancelled
+	default:
+		d.progress.State = DownloadFailed
+		d.progress.Error = err.Error()
+	}
+	if err != nil {
+		m.ended = append(m.ended, d)
+		if len(m.ended) > maxEndedDownloads {
+			m.ended = m.ended[1:]
+		}
+	}
+	p := d.progress
+	m.mu.Unlock()
+	m.emit(p)
+}
+
+// hasEnded reports whether the download of a message failed or was
+// cancelled and hasn't been retried since.
+func (m *downloadManager) hasEnded(messageID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.ContainsFunc(m.ended, func(d *download) bool {
+		return d.progress.MessageID == messageID
+	})
+}
+
+func (m *downloadManager) dropEndedLocked(messageID string) *download {
+	for i, d := range m.ended {
+		if d.progress.MessageID == messageID {
+			m.ended = append(m.ended[:i], m.ended[i+1:]...)
+			return d
+		}
+	}
+	return nil
+}
+
+// cancel stops a queued or running download. It reports whether there was
+// one.
+func (m *downloadManager) cancel(messageID string) bool {
+	m.mu.Lock()
+	d, ok := m.active[messageID]
+	if !ok {
+		m.mu.Unlock()
+		return false
+	}
+	if d.cancel != nil {
+		// The worker ends it once the download returns.
+		d.cancel()
+		m.mu.Unlock()
+		return true
+	}
+	queued := m.unqueueLocked(d)
+	m.mu.Unlock()
+	// Otherwise it is already being ended.
+	if queued {
+		m.end(d, errDownloadCancelled)
+	}
+	return true
+}
+
+// cancelAll cancels every queued and running download.
+func (m *downloadManager) cancelAll() {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.active))
+	for id := range m.active {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+	for _, id := range ids {
+		m.cancel(id)
+	}
+}
+
+// retry takes a failed or cancelled download off the ended list and
+// returns its message, to be downloaded again.
+func (m *downloadManager) retry(messageID string) *store.ExtendedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d := m.dropEndedLocked(messageID); d != nil {
+		return d.msg
+	}
+	return nil
+}
+
+// list returns the running downloads, then the queued ones in order, then
+// the held ones, then those that failed or were cancelled, most recent
+// first.
+func (m *downloadManager) list() []DownloadProgress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]DownloadProgress, 0, len(m.active)+len(m.ended))
+	for _, d := range m.running {
+		out = append(out, d.progress)
+	}
+	for _, d := range m.queue {
+		out = append(out, d.progress)
+	}
+	for _, d := range m.held {
+		out = append(out, d.progress)
+	}
+	for i := len(m.ended) - 1; i >= 0; i-- {
+		out = append(out, m.ended[i].progress)
+	}
+	return out
+}
+
+func (a *Api) emitDownloadProgress(p DownloadProgress) {
+	runtime.EventsEmit(a.ctx, "wa:download_progress", p)
+}
+
+// fetchMedia returns the download of a message's media into the cache,
+// queueing it unless it is already queued or running.
+func (a *Api) fetchMedia(msg *store.ExtendedMessage) (*cache.Partial, error) {
+	return a.queueMedia(msg, false)
+}
+
+// queueMedia is fetchMedia for both kinds of download. Asking for a queued
+// background download moves it up.
+func (a *Api) queueMedia(msg *store.ExtendedMessage, background bool) (*cache.Partial, error) {
+	if msg == nil || msg.Media == nil {
+		return nil, fmt.Errorf("message has no downloadable media")
+	}
+	if a.mediaCache == nil || a.downloads == nil {
+		return nil, fmt.Errorf("media cache is not ready")
+	}
+	if a.waClient == nil {
+		return nil, fmt.Errorf("WhatsApp client is not ready")
+	}
+	width, height := msg.Media.GetDimensions()
+	p, started, err := a.mediaCache.StartDownload(
+		msg.Info.ID,
+		cacheKind(msg.Media.GetMediaGeneralType()),
+		mediaMime(msg.Media),
+		width, height,
+		int64(msg.Media.GetFileLength()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if started {
+		a.downloads.add(&download{msg: msg, partial: p, background: background})
+	} else if !background {
+		a.downloads.promote(msg.Info.ID)
+	}
+	return p, nil
+}
+
+// runDownload downloads into the cache for the download manager. Queued
+// auto-downloads are held once the connection turns metered.
+func (a *Api) runDownload(ctx context.Context, d *download, report func(done int64)) error {
+	if d.background && autoDownloadPaused(store.GetAutoDownload()) {
+		return errAutoDownloadPaused
+	}
+	if err := d.partial.Create(); err != nil {
+		return err
+	}
+	return a.downloadToPartial(ctx, d.msg.Media, &countingWriter{w: d.partial, onWrite: report})
+}
+
+// countingWriter reports how much has been written in total.
+type countingWriter struct {
+	w       io.Writer
+	done    int64
+	onWrite func(done int64)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.done += int64(n)
+	c.onWrite(c.done)
+	return n, err
+}
+
+// GetDownloads lists the media downloads that are running, queued, or
+// failed or were cancelled and can be retried.
+func (a *Api) GetDownloads() []DownloadProgress {
+	if a.downloads == nil {
+		return []DownloadProgress{}
+	}
+	return a.downloads.list()
+}
+
+// CancelDownload stops downloading a message's media. It reports whether a
+// download was queued or running.
+func (a *Api) CancelDownload(messageID string) bool {
+	if a.downloads == nil {
+		return false
+	}
+	return a.downloads.cancel(messageID)
+}
+
+// RetryDownload queues a failed or cancelled download again.
+func (a *Api) RetryDownload(messageID string) error {
+	if a.downloads == nil {
+		return fmt.Errorf("media cache is not ready")
+	}
+	msg := a.downloads.retry(messageID)
+	if msg == nil {
+		return fmt.Errorf("no failed download for message %s", messageID)
+	}
+	_, err := a.fetchMedia(msg)
+	return err
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func testDownload(id string) *download {
+	chat, _ := types.ParseJID("123@s.whatsapp.net")
+	return &download{msg: &store.ExtendedMessage{
+		Info:  types.MessageInfo{ID: id, MessageSource: types.MessageSource{Chat: chat}},
+		Media: wa.NewMedia("/path", nil, nil, nil, "", "image/jpeg", "", 100, 0, 0, mtypes.MediaTypeImage),
+	}}
+}
+
+func TestDownloadManagerQueuesCancelsAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	ended := make(map[string]string)
+	endedCh := make(chan struct{}, 10)
+	started := make(chan string, 10)
+	release := make(chan error)
+	var wg sync.WaitGroup
+	m := newDownloadManager(1,
+		func(task func()) bool {
+			wg.Add(1)
+			go func() { defer wg.Done(); task() }()
+			return true
+		},
+		func(ctx context.Context, d *download, report func(int64)) error {
+			report(50)
+			started <- d.progress.MessageID
+			select {
+			case err := <-release:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		func(p DownloadProgress) {
+			if p.State == DownloadDone || p.State == DownloadFailed || p.State == DownloadCancelled {
+				mu.Lock()
+				ended[p.MessageID] = p.State
+				mu.Unlock()
+				endedCh <- struct{}{}
+			}
+		},
+	)
+	waitEnded := func() {
+		t.Helper()
+		select {
+		case <-endedCh:
+		case <-time.After(time.Second):
+			t.Fatal("download never ended")
+		}
+	}
+
+	m.add(testDownload("a"))
+	m.add(testDownload("b"))
+	m.add(testDownload("c"))
+	if id := <-started; id != "a" {
+		t.Fatalf("started %s first", id)
+	}
+	list := m.list()
+	if len(list) != 3 || list[0].MessageID != "a" || list[0].State != DownloadRunning || list[0].Done != 50 ||
+		list[1].MessageID != "b" || list[1].State != DownloadQueued {
+		t.Fatalf("list = %+v", list)
+	}
+
+	// A queued download is dropped at once, a running one stops.
+	if !m.cancel("b") {
+		t.Fatal("cancel of a queued download failed")
+	}
+	waitEnded()
+	if !m.cancel("a") {
+		t.Fatal("cancel of a running download failed")
+	}
+	waitEnded()
+	if id := <-started; id != "c" {
+		t.Fatalf("started %s after a", id)
+	}
+	release <- errors.New("network down")
+	waitEnded()
+	wg.Wait()
+
+	mu.Lock()
+	if ended["a"] != DownloadCancelled || ended["b"] != DownloadCancelled || ended["c"] != DownloadFailed {
+		t.Fatalf("ended = %v", ended)
+	}
+	mu.Unlock()
+	list = m.list()
+	if len(list) != 3 || list[0].MessageID != "c" || list[0].Error != "network down" {
+		t.Fatalf("list after = %+v", list)
+	}
+	if m.cancel("c") {
+		t.Fatal("cancelled a download that had ended")
+	}
+	if msg := m.retry("c"); msg == nil || msg.Info.ID != "c" {
+		t.Fatal("retry didn't return the failed download")
+	}
+	if len(m.list()) != 2 {
+		t.Fatal("retried download is still listed as failed")
+	}
+}
+
+func TestDownloadManagerRunsBackgroundDownloadsLast(t *testing.T) {
+	var order []string
+	var tasks []func()
+	m := newDownloadManager(1,
+		func(task func()) bool { tasks = append(tasks, task); return true },
+		func(ctx context.Context, d *download, report func(int64)) error {
+			order = append(order, d.progress.MessageID)
+			return nil
+		},
+		func(DownloadProgress) {},
+	)
+	add := func(id string, background bool) {
+		d := testDownload(id)
+		d.background = background
+		m.add(d)
+	}
+	add("prefetch-1", true)
+	add("prefetch-2", true)
+	add("asked-1", false)
+	add("prefetch-3", true)
+	add("asked-2", false)
+	// Asking for a queued prefetch moves it up.
+	m.promote("prefetch-3")
+
+	if len(tasks) != 1 {
+		t.Fatalf("started %d workers, want 1", len(tasks))
+	}
+	tasks[0]()
+	want := []string{"asked-1", "asked-2", "prefetch-3", "prefetch-1", "prefetch-2"}
+	if strings.Join(order, " ") != strings.Join(want, " ") {
+		t.Fatalf("ran %v, want %v", order, want)
+	}
+}
+
+func TestDownloadManagerHoldsPausedDownloadsUntilResumed(t *testing.T) {
+	metered := true
+	var tasks []func()
+	var ran []string
+	states := make(map[string]string)
+	m := newDownloadManager(1,
+		func(task func()) bool { tasks = append(tasks, task); return true },
+		func(ctx context.Context, d *download, report func(int64)) error {
+			if d.background && metered {
+				return errAutoDownloadPaused
+			}
+			ran = append(ran, d.progress.MessageID)
+			if d.progress.MessageID == "expired" {
+				return errors.New("media expired")
+			}
+			return nil
+		},
+		func(p DownloadProgress) { states[p.MessageID] = p.State },
+	)
+	runWorkers := func() {
+		for len(tasks) > 0 {
+			task := tasks[0]
+			tasks = tasks[1:]
+			task()
+		}
+	}
+	for _, id := range []string{"a", "b", "c", "expired"} {
+		d := testDownload(id)
+		d.background = true
+		m.add(d)
+	}
+	runWorkers()
+	if len(ran) != 0 {
+		t.Fatalf("ran %v on a metered connection", ran)
+	}
+	for _, id := range []string{"a", "b", "c", "expired"} {
+		if states[id] != DownloadPaused || m.hasEnded(id) {
+			t.Fatalf("%s is %s, want held", id, states[id])
+		}
+	}
+
+	// Asking for a held download runs it; cancelling one ends it.
+	m.promote("b")
+	m.cancel("c")
+	runWorkers()
+	if strings.Join(ran, " ") != "b" || states["b"] != DownloadDone || states["c"] != DownloadCancelled {
+		t.Fatalf("ran %v, states %v", ran, states)
+	}
+
+	metered = false
+	m.resume()
+	runWorkers()
+	if strings.Join(ran, " ") != "b a expired" || states["a"] != DownloadDone {
+		t.Fatalf("ran %v after resuming, states %v", ran, states)
+	}
+	if len(m.list()) != 2 || !m.hasEnded("expired") || !m.hasEnded("c") || m.hasEnded("a") {
+		t.Fatalf("list = %+v", m.list())
+	}
+}
+
+func TestDownloadManagerEndKeepsTheDownloadQueuedAgain(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan *download, 2)
+	var wg sync.WaitGroup
+	m := newDownloadManager(1,
+		func(task func()) bool {
+			wg.Add(1)
+			go func() { defer wg.Done(); task() }()
+			return true
+		},
+		func(ctx context.Context, d *download, report func(int64)) error {
+			started <- d
+			<-ctx.Done()
+			<-release
+			return ctx.Err()
+		},
+		func(p DownloadProgress) {},
+	)
+	m.add(testDownload("a"))
+	<-started
+	m.cancel("a")
+	// Asked for again before the cancelled download has ended.
+	second := testDownload("a")
+	m.add(second)
+	release <- struct{}{}
+	if d := <-started; d != second {
+		t.Fatal("the download queued again didn't run")
+	}
+	if !m.cancel("a") {
+		t.Fatal("ending the cancelled download forgot the one queued again")
+	}
+	release <- struct{}{}
+	wg.Wait()
+}
@@ -101,3 +101,52 @@ func (a *Api) GetGroupInfo(jidStr string) (Group, error) {
 		Participants:     participants,
 	}, nil
 }
+
+// requireGroupAdmin returns the parsed group JID if we are an admin of it.
+func (a *Api) requireGroupAdmin(groupJID string) (types.JID, error) {
+	jid, err := parseGroupJID(groupJID)
+	if err != nil {
+		return types.EmptyJID, err
+	}
+	if a.waClient.Store.ID == nil {
+		return types.EmptyJID, fmt.Errorf("not logged in")
+	}
+	info, err := a.waClient.GetGroupInfo(a.ctx, jid)
+	if err != nil {
+		return types.EmptyJID, fmt.Errorf("failed to get group info: %w", err)
+	}
+	own := a.waClient.Store.ID.ToNonAD()
+	ownLID := a.waClient.Store.GetLID().ToNonAD()
+	for _, p := range info.Participants {
+		if p.JID.User != own.User && (ownLID.IsEmpty() || p.JID.User != ownLID.User) {
+			continue
+		}
+		if p.IsAdmin || p.IsSuperAdmin {
+			return jid, nil
+		}
+		break
+	}
+	return types.EmptyJID, fmt.Errorf("not an admin of %s", groupJID)
+}
+
+// SetGroupPicture sets the picture of a group we admin. The image is cropped
+// and scaled like SetProfilePicture.
+func (a *Api) SetGroupPicture(groupJID string, imageBytes []byte) error {
+	if len(imageBytes) == 0 {
+		return fmt.Errorf("no image given")
+	}
+	jid, err := a.requireGroupAdmin(groupJID)
+	if err != nil {
+		return err
+	}
+	return a.setPicture(jid, imageBytes)
+}
+
+// RemoveGroupPicture removes the picture of a group we admin.
+func (a *Api) RemoveGroupPicture(groupJID string) error {
+	jid, err := a.requireGroupAdmin(groupJID)
+	if err != nil {
+		return err
+	}
+	return a.setPicture(jid, nil)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// onDemandHistoryCount is how many older messages are asked from the phone
+// when scrolling past the oldest stored message.
+const onDemandHistoryCount = 50
+
+// historyWorker stores history sync batches one at a time, in the order
+// whatsmeow dispatched them, off the event loop. A single worker keeps the
+// order; goroutines queueing on a mutex wouldn't.
+type historyWorker struct {
+	mu      sync.Mutex
+	queue   []*events.HistorySync
+	running bool
+
+	start   func(task func()) bool
+	process func(*events.HistorySync)
+}
+
+func newHistoryWorker(start func(task func()) bool, process func(*events.HistorySync)) *historyWorker {
+	return &historyWorker{start: start, process: process}
+}
+
+// add queues a batch behind the others, starting the worker when idle.
+// Batches arriving while the app shuts down are dropped.
+func (w *historyWorker) add(v *events.HistorySync) {
+	w.mu.Lock()
+	w.queue = append(w.queue, v)
+	startWorker := !w.running
+	w.running = true
+	w.mu.Unlock()
+
+	if startWorker && !w.start(w.work) {
+		w.mu.Lock()
+		w.running = false
+		w.queue = nil
+		w.mu.Unlock()
+	}
+}
+
+func (w *historyWorker) work() {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		v := w.queue[0]
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		w.process(v)
+	}
+}
+
+// HistorySyncProgress is emitted on wa:history_sync for each history batch.
+type HistorySyncProgress struct {
+	// Type is the whatsmeow sync type in lower case, e.g.
+	// "initial_bootstrap", "recent", "full" or "on_demand".
+	Type       string `json:"type"`
+	ChunkOrder uint32 `json:"chunk_order"`
+	// Progress is the phone's estimate of the overall sync, 0-100.
+	Progress      uint32 `json:"progress"`
+	Conversations int    `json:"conversations"`
+	Messages      int    `json:"messages"`
+	// ChatIDs lists the chats an on-demand batch filled, so open chats can
+	// reload.
+	ChatIDs []string `json:"chat_ids,omitempty"`
+}
+
+func (a *Api) emitHistorySyncProgress(data *waHistorySync.HistorySync, stored int, chats []string) {
+	p := HistorySyncProgress{
+		Type:          strings.ToLower(data.GetSyncType().String()),
+		ChunkOrder:    data.GetChunkOrder(),
+		Progress:      data.GetProgress(),
+		Conversations: len(data.GetConversations()),
+		Messages:      stored,
+	}
+	if data.GetSyncType() == waHistorySync.HistorySync_ON_DEMAND {
+		p.ChatIDs = chats
+	}
+	runtime.EventsEmit(a.ctx, "wa:history_sync", p)
+}
+
+// requestOlderHistory asks the phone for the messages before the oldest one
+// stored for a chat. The answer arrives as an on-demand HistorySync event
+// and is stored by processHistorySync. A request is sent once per oldest
+// message, so a chat whose history is exhausted isn't asked again.
+func (a *Api) requestOlderHistory(chatJID string) {
+	jid, err := types.ParseJID(chatJID)
+	if err != nil {
+		return
+	}
+	switch jid.Server {
+	case types.NewsletterServer, types.BroadcastServer:
+		// Channels are backfilled from the server (FetchChannelMessages).
+		return
+	}
+	if a.waClient == nil || !a.waClient.IsLoggedIn() {
+		return
+	}
+	oldest, err := a.messageStore.OldestMessage(chatJID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Failed to find oldest message for history request:", err)
+		}
+		return
+	}
+	if prev, loaded := a.historyRequests.Swap(chatJID, oldest.ID); loaded && prev == oldest.ID {
+		return
+	}
+	if _, err := a.waClient.SendPeerMessage(a.ctx, a.waClient.BuildHistorySyncRequest(oldest, onDemandHistoryCount)); err != nil {
+		a.historyRequests.Delete(chatJID)
+		log.Println("Failed to request older history:", err)
+		return
+	}
+	runtime.EventsEmit(a.ctx, "wa:history_request", map[string]any{
+		"chatId": chatJID,
+		"before": oldest.ID,
+	})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"slices"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHistoryWorkerProcessesBatchesInOrder(t *testing.T) {
+	batch := func(chunk uint32) *events.HistorySync {
+		return &events.HistorySync{Data: &waHistorySync.HistorySync{ChunkOrder: proto.Uint32(chunk)}}
+	}
+	var tasks []func()
+	var order []uint32
+	var w *historyWorker
+	w = newHistoryWorker(
+		func(task func()) bool { tasks = append(tasks, task); return true },
+		func(v *events.HistorySync) {
+			order = append(order, v.Data.GetChunkOrder())
+			// Batches keep arriving while one is stored.
+			if v.Data.GetChunkOrder() == 1 {
+				w.add(batch(4))
+			}
+		},
+	)
+	w.add(batch(1))
+	w.add(batch(2))
+	w.add(batch(3))
+	if len(tasks) != 1 {
+		t.Fatalf("started %d workers, want 1", len(tasks))
+	}
+	tasks[0]()
+	if len(tasks) != 1 {
+		t.Fatalf("started %d workers, want 1", len(tasks))
+	}
+	if want := []uint32{1, 2, 3, 4}; !slices.Equal(order, want) {
+		t.Fatalf("processed chunks %v, want %v", order, want)
+	}
+
+	// Idle again: the next batch starts a new worker.
+	w.add(batch(5))
+	if len(tasks) != 2 {
+		t.Fatalf("started %d workers, want 2", len(tasks))
+	}
+}
@@ -6,13 +6,9 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
 
-	"github.com/gen2brain/beeep"
 	"github.com/lugvitc/whats4linux/internal/store"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"github.com/lugvitc/whats4linux/internal/wa"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types"
 )
@@ -86,6 +82,8 @@ func (a *Api) GetVideoThumbnail(messageID string) string {
 	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumb)
 }
 
+// DownloadMedia returns a message's media as a data URL, from the media
+// cache when it's there and downloading it into the cache otherwise.
 func (a *Api) DownloadMedia(chatJID string, messageID string) (string, error) {
 	if a.messageStore == nil {
 		return "", fmt.Errorf("message store is not ready")
@@ -97,74 +95,71 @@ func (a *Api) DownloadMedia(chatJID string, messageID string) (string, error) {
 	if msg.Media == nil {
 		return "", fmt.Errorf("message %s has no downloadable media", messageID)
 	}
-	if a.waClient == nil {
-		return "", fmt.Errorf("WhatsApp client is not ready")
-	}
-
-	mime := msg.Media.GetMimetype()
-	width, height := msg.Media.GetDimensions()
 
-	mediaType := msg.Media.GetMediaType()
-	if mime == "" {
-		// A correct MIME is required or <video>/<audio> won't play the data URL.
-		switch mediaType {
-		case whatsmeow.MediaImage:
-			mime = "image/jpeg"
-		case whatsmeow.MediaVideo:
-			mime = "video/mp4"
-		case whatsmeow.MediaAudio:
-			mime = "audio/ogg"
-		default:
-			mime = "application/octet-stream"
+	if a.mediaCache != nil {
+		if data, cachedMime, err := a.mediaCache.Read(messageID); err == nil {
+			return "data:" + cachedMime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
 		}
 	}
-	data, err := a.waClient.Download(a.ctx, msg.Media)
+	data, mime, _, _, err := a.downloadMedia(msg)
 	if err != nil {
-		return "", fmt.Errorf("failed to download media: %v", err)
-	}
-
-	// Save to cache for images and stickers
-	if mediaType == whatsmeow.MediaImage {
-		_, err = a.imageCache.SaveImage(messageID, data, mime, width, height)
-		if err != nil {
-			// Log error but continue
-		}
+		return "", fmt.Errorf("failed to download media: %w", err)
 	}
-
 	// Return a ready-to-use data URL with the correct MIME.
 	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
 }
 
-// downloadMedia downloads media from a message and returns data, mime, width, height
+// mediaMime is the MIME type of a message's media, guessed from the media
+// type when the message has none. A correct MIME is required or
+// <video>/<audio> won't play it.
+func mediaMime(media *wa.Media) string {
+	if mime := media.GetMimetype(); mime != "" {
+		return mime
+	}
+	switch media.GetMediaType() {
+	case whatsmeow.MediaImage:
+		return "image/jpeg"
+	case whatsmeow.MediaVideo:
+		return "video/mp4"
+	case whatsmeow.MediaAudio:
+		return "audio/ogg"
+	}
+	return "application/octet-stream"
+}
+
+// downloadMedia downloads a message's media into the cache, through the
+// download manager, and returns data, mime, width, height.
 func (a *Api) downloadMedia(msg *store.ExtendedMessage) ([]byte, string, int, int, error) {
-	if msg == nil || msg.Media == nil {
-		return nil, "", 0, 0, fmt.Errorf("message has no downloadable media")
+	p, err := a.fetchMedia(msg)
+	if err != nil {
+		return nil, "", 0, 0, err
 	}
-	if a.waClient == nil {
-		return nil, "", 0, 0, fmt.Errorf("WhatsApp client is not ready")
+	// Read the download itself: media too big for the cache never lands
+	// there.
+	r, err := p.NewReader(a.ctx)
+	if err != nil {
+		return nil, "", 0, 0, err
 	}
-	data, err := a.waClient.Download(a.ctx, msg.Media)
-	mime := msg.Media.GetMimetype()
-
-	if mime == "" && msg.Media.GetMediaType() == whatsmeow.MediaImage {
-		mime = "image/jpeg"
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", 0, 0, err
 	}
 	width, height := msg.Media.GetDimensions()
-
-	return data, mime, width, height, err
+	return data, mediaMime(msg.Media), width, height, nil
 }
 
 func (a *Api) GetCachedImage(messageID string) (string, error) {
-	if a.imageCache == nil {
-		return "", fmt.Errorf("image cache is not ready")
+	if a.mediaCache == nil {
+		return "", fmt.Errorf("media cache is not ready")
 	}
 	// Try to read from cache first
-	data, mime, err := a.imageCache.ReadImageByMessageID(messageID)
+	data, mime, err := a.mediaCache.Read(messageID)
 	if err == nil {
 		return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data)), nil
 	}
 
-	// Image not in cache, download and cache it
+	// Image not in cache, download it into the cache
 	if a.messageStore == nil {
 		return "", fmt.Errorf("message store is not ready")
 	}
@@ -176,16 +171,11 @@ func (a *Api) GetCachedImage(messageID string) (string, error) {
 		return "", fmt.Errorf("message %s has no downloadable image", messageID)
 	}
 
-	data, mime, width, height, err := a.downloadMedia(msg)
+	data, mime, _, _, err = a.downloadMedia(msg)
 	if err != nil {
 		return "", fmt.Errorf("failed to download image: %w", err)
 	}
 
-	_, err = a.imageCache.SaveImage(messageID, data, mime, width, height)
-	if err != nil {
-		// Don't fail, still return the data
-	}
-
 	return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data)), nil
 }
 
@@ -193,17 +183,17 @@ func (a *Api) GetCachedImage(messageID string) (string, error) {
 // Returns map of message IDs to data URLs
 func (a *Api) GetCachedImages(messageIDs []string) (map[string]string, error) {
 	result := make(map[string]string)
-	if a.imageCache == nil {
-		return result, fmt.Errorf("image cache is not ready")
+	if a.mediaCache == nil {
+		return result, fmt.Errorf("media cache is not ready")
 	}
-	metas, err := a.imageCache.GetImagesByMessageIDs(messageIDs)
+	metas, err := a.mediaCache.GetMany(messageIDs)
 	if err != nil {
 		return nil, err
 	}
 
 	for msgID, meta := range metas {
 		if meta != nil {
-			data, mime, err := a.imageCache.ReadImageByMessageID(msgID)
+			data, mime, err := a.mediaCache.Read(msgID)
 			if err == nil {
 				result[msgID] = fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
 			}
@@ -215,12 +205,12 @@ func (a *Api) GetCachedImages(messageIDs []string) (map[string]string, error) {
 
 // GetCachedAvatar retrieves or downloads and caches an avatar for a JID
 func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
-	if a.imageCache == nil {
-		return "", fmt.Errorf("image cache is not ready")
+	if a.mediaCache == nil {
+		return "", fmt.Errorf("media cache is not ready")
 	}
 
 	// Try to get cached avatar data first
-	data, mime, err := a.imageCache.ReadAvatarByJID(jid)
+	data, mime, err := a.mediaCache.ReadAvatarByJID(jid)
 
 	if err == nil && !recache {
 		avatarDataURL := fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
@@ -248,7 +238,7 @@ func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
 	}
 	if err != nil || pic == nil {
 		if recache {
-			a.startBackground(func() { _ = a.imageCache.DeleteAvatar(jid) })
+			a.startBackground(func() { _ = a.mediaCache.DeleteAvatar(jid) })
 		}
 		return "", nil // No avatar available
 	}
@@ -259,7 +249,7 @@ func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
 // downloadAvatarFromURL fetches an avatar image from URL, caches it, and
 // returns a data URL. Used by both regular and community avatar paths.
 func (a *Api) downloadAvatarFromURL(jid, url string) (string, error) {
-	resp, err := http.Get(url)
+	resp, err := a.avatarHTTPClient().Get(url)
 	if err != nil {
 		return "", fmt.Errorf("failed to download avatar: %w", err)
 	}
@@ -289,7 +279,7 @@ func (a *Api) downloadAvatarFromURL(jid, url string) (string, error) {
 		}
 	}
 
-	_, err = a.imageCache.SaveAvatar(jid, data, mime)
+	_, err = a.mediaCache.SaveAvatar(jid, data, mime)
 	if err != nil {
 		log.Printf("[downloadAvatarFromURL] Failed to cache avatar for %s: %v", jid, err)
 		return "", fmt.Errorf("failed to cache avatar: %w", err)
@@ -323,56 +313,3 @@ func (a *Api) GetSelfAvatar(recache bool) (string, error) {
 
 	return avatar, nil
 }
-
-// getFileExtension returns file extension for mime type
-func getFileExtension(mime string) string {
-	switch mime {
-	case "image/png":
-		return ".png"
-	case "image/gif":
-		return ".gif"
-	case "image/webp":
-		return ".webp"
-	case "image/jpeg", "image/jpg":
-		return ".jpg"
-	default:
-		return ".jpg"
-	}
-}
-
-// DownloadImageToFile downloads an image from cache to the Downloads folder
-func (a *Api) DownloadImageToFile(messageID string) error {
-	data, mime, err := a.imageCache.ReadImageByMessageID(messageID)
-	if err != nil {
-		return err
-	}
-
-	homeDir, _ := os.UserHomeDir()
-	downloadsDir := filepath.Join(homeDir, "Downloads")
-	fileName := messageID + getFileExtension(mime)
-	filePath := filepath.Join(downloadsDir, fileName)
-
-	// Check if file exists and prompt for new path
-	if _, err := os.Stat(filePath); err == nil {
-		if filePath, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
-			DefaultDirectory: downloadsDir,
-			DefaultFilename:  fileName,
-			Title:            "File already exists. Save as...",
-			Filters:          []runtime.FileFilter{{DisplayName: "Image Files", Pattern: "*" + getFileExtension(mime)}},
-		}); err != nil || filePath == "" {
-			return err
-		}
-	}
-
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		return err
-	}
-
-	beeep.Notify("whats4linux", "Downloaded: "+filePath, "")
-	go func() {
-		if _, err := exec.LookPath("mpg123"); err == nil {
-			exec.Command("mpg123", "./beep.mp3").Run()
-		}
-	}()
-	return nil
-}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/lugvitc/whats4linux/internal/cache"
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// cacheKind is the media cache quota a message's media counts against.
+func cacheKind(mediaType mtypes.MediaType) cache.Kind {
+	switch mediaType {
+	case mtypes.MediaTypeVideo:
+		return cache.KindVideo
+	case mtypes.MediaTypeAudio:
+		return cache.KindAudio
+	case mtypes.MediaTypeDocument:
+		return cache.KindDocument
+	case mtypes.MediaTypeSticker:
+		return cache.KindSticker
+	}
+	return cache.KindImage
+}
+
+// mediaCacheQuotas reads the configured quotas, in bytes.
+func mediaCacheQuotas() map[cache.Kind]int64 {
+	quotas := make(map[cache.Kind]int64)
+	for kind, mb := range store.GetMediaCacheQuotas() {
+		quotas[cache.Kind(kind)] = mb << 20
+	}
+	return quotas
+}
+
+// GetMediaCacheQuotas returns how many megabytes of each kind of media
+// ("image", "video", "audio", "document", "sticker" and "avatar") the
+// cache keeps.
+func (a *Api) GetMediaCacheQuotas() map[string]int64 {
+	quotas := cache.DefaultQuotas
+	if a.mediaCache != nil {
+		quotas = a.mediaCache.Quotas()
+	}
+	out := make(map[string]int64, len(quotas))
+	for kind, bytes := range quotas {
+		out[string(kind)] = bytes >> 20
+	}
+	return out
+}
+
+// SetMediaCacheQuotas changes the cache size of each kind of media, in
+// megabytes, and evicts the least recently used files that no longer fit.
+// Kinds left out go back to their defaults.
+func (a *Api) SetMediaCacheQuotas(quotas map[string]int64) error {
+	for kind, mb := range quotas {
+		if _, ok := cache.DefaultQuotas[cache.Kind(kind)]; !ok {
+			return fmt.Errorf("unknown media kind %q", kind)
+		}
+		if mb < 0 {
+			return fmt.Errorf("negative quota for %s", kind)
+		}
+	}
+	if err := store.SetMediaCacheQuotas(quotas); err != nil {
+		return fmt.Errorf("failed to save media cache quotas: %w", err)
+	}
+	if a.mediaCache != nil {
+		return a.mediaCache.SetQuotas(mediaCacheQuotas())
+	}
+	return nil
+}
+
+// GetMediaCacheUsage returns how many bytes of each kind of media are
+// cached.
+func (a *Api) GetMediaCacheUsage() (map[string]int64, error) {
+	if a.mediaCache == nil {
+		return nil, fmt.Errorf("media cache is not ready")
+	}
+	usage, err := a.mediaCache.Usage()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(usage))
+	for kind, bytes := range usage {
+		out[string(kind)] = bytes
+	}
+	return out, nil
+}
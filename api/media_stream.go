@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/lugvitc/whats4linux/internal/server"
+	"github.com/lugvitc/whats4linux/internal/wa"
+)
+
+// mediaSource serves message media to the asset server's /media/ route.
+type mediaSource struct {
+	a *Api
+}
+
+// NewMediaSource lets the asset server serve a's message media, which it
+// downloads into the media cache on first use.
+func NewMediaSource(a *Api) server.MediaSource {
+	return mediaSource{a}
+}
+
+func (s mediaSource) OpenMedia(ctx context.Context, messageID string) (*server.Media, error) {
+	a := s.a
+	if a.messageStore == nil || a.mediaCache == nil {
+		return nil, fmt.Errorf("media is not ready")
+	}
+	msg, err := a.messageStore.GetMessageWithMediaByID(messageID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && msg.Media == nil) {
+		return nil, server.ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if f, meta, err := a.mediaCache.Open(messageID); err != nil {
+		log.Println("Failed to open cached media:", err)
+	} else if f != nil {
+		return &server.Media{Content: f, Mime: meta.Mime, Size: meta.Size, ModTime: msg.Info.Timestamp}, nil
+	}
+
+	p, err := a.fetchMedia(msg)
+	if err != nil {
+		return nil, err
+	}
+	r, err := p.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &server.Media{Content: r, Mime: mediaMime(msg.Media), Size: p.Size(), ModTime: msg.Info.Timestamp}, nil
+}
+
+// downloadToPartial downloads media into out, the cache file readers
+// follow as the media decrypts.
+func (a *Api) downloadToPartial(ctx context.Context, media *wa.Media, out io.Writer) error {
+	tmp, err := os.CreateTemp("", "whats4linux-media-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	file, err := wa.NewStreamingFile(tmp, media, out)
+	if err != nil {
+		return err
+	}
+	if err := a.waClient.DownloadToFile(ctx, media, file); err != nil {
+		return fmt.Errorf("failed to download media: %w", err)
+	}
+	if err := file.Err(); err != nil {
+		return err
+	}
+	// whatsmeow has decrypted and verified the whole file; the end of it
+	// wasn't streamed.
+	if _, err := tmp.Seek(file.Streamed(), io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(out, tmp)
+	return err
+}
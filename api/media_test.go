@@ -27,11 +27,11 @@ func newMediaTestAPI(t *testing.T) *Api {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	imageCache, err := cache.NewImageCache()
+	mediaCache, err := cache.NewMediaCache(nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Cleanup(func() { _ = imageCache.Close() })
+	t.Cleanup(func() { _ = mediaCache.Close() })
 
 	chat, _ := types.ParseJID("123@s.whatsapp.net")
 	sender, _ := types.ParseJID("456@s.whatsapp.net")
@@ -53,7 +53,7 @@ func newMediaTestAPI(t *testing.T) *Api {
 	return &Api{
 		ctx:          context.Background(),
 		messageStore: store,
-		imageCache:   imageCache,
+		mediaCache:   mediaCache,
 	}
 }
 
@@ -87,9 +87,9 @@ func TestMediaMethodsHandleUninitialisedAPI(t *testing.T) {
 		t.Fatal("DownloadMedia returned no error without a message store")
 	}
 	if _, err := a.GetCachedImage("message"); err == nil {
-		t.Fatal("GetCachedImage returned no error without an image cache")
+		t.Fatal("GetCachedImage returned no error without a media cache")
 	}
 	if _, err := a.GetCachedAvatar("123@s.whatsapp.net", false); err == nil {
-		t.Fatal("GetCachedAvatar returned no error without an image cache")
+		t.Fatal("GetCachedAvatar returned no error without a media cache")
 	}
 }
@@ -1,12 +1,15 @@
 package api
 
 import (
-	"encoding/base64"
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/lugvitc/whats4linux/internal/imaging"
 	"github.com/lugvitc/whats4linux/internal/markdown"
 	"github.com/lugvitc/whats4linux/internal/store"
 	mtypes "github.com/lugvitc/whats4linux/internal/types"
@@ -20,14 +23,25 @@ import (
 )
 
 type MessageContent struct {
-	Type            string   `json:"type"`
-	Text            string   `json:"text,omitempty"`
-	Base64Data      string   `json:"base64Data,omitempty"`
-	Mimetype        string   `json:"mimetype,omitempty"`
+	Type       string `json:"type"`
+	Text       string `json:"text,omitempty"`
+	Base64Data string `json:"base64Data,omitempty"`
+	// FilePath sends the media from a local file, streamed instead of
+	// passed through the bridge as Base64Data.
+	FilePath string `json:"filePath,omitempty"`
+	Mimetype string `json:"mimetype,omitempty"`
+	// Quality overrides the send quality setting for an image.
+	Quality         string   `json:"quality,omitempty"`
 	FileName        string   `json:"fileName,omitempty"`
 	QuotedMessageID string   `json:"quotedMessageId,omitempty"`
 	Mentions        []string `json:"mentions,omitempty"`
 	ClientTempID    string   `json:"clientTempId,omitempty"`
+	// PTT marks audio recorded in the app as a voice note. It must be
+	// Ogg/Opus.
+	PTT bool `json:"ptt,omitempty"`
+	// StickerID resends a sticker from the catalog's favorites or recents
+	// instead of uploading one.
+	StickerID string `json:"stickerId,omitempty"`
 }
 
 func (a *Api) processMessageText(msg *waE2E.Message) string {
@@ -84,6 +98,11 @@ func (a *Api) FetchMessagesPaged(jid string, limit int, beforeTimestamp int64, b
 	if err != nil {
 		return nil, err
 	}
+	// A short page means the oldest stored message was reached; ask the
+	// phone for what came before it.
+	if len(messages) < limit {
+		a.startBackground(func() { a.requestOlderHistory(jid) })
+	}
 	return messages, nil
 }
 
@@ -228,6 +247,17 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		return "", err
 	}
 
+	if content.FilePath != "" {
+		if content.Mimetype == "" {
+			content.Mimetype = mimeTypeOf(content.FilePath)
+		}
+		if content.FileName == "" {
+			content.FileName = filepath.Base(content.FilePath)
+		}
+	}
+	uploadCtx, cancelUpload := a.uploadContext(content)
+	defer cancelUpload()
+
 	switch content.Type {
 	case "text":
 
@@ -253,21 +283,31 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 			}
 		}
 	case "image":
-		// Decode base64 image data
-		imageData, err := base64.StdEncoding.DecodeString(content.Base64Data)
+		data, err := readMedia(content)
+		if err != nil {
+			return "", err
+		}
+		image, err := a.prepareImage(data, content.Quality)
 		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 image data: %v", err)
+			return "", err
 		}
 
 		// Create image message
 		mimeType := content.Mimetype
+		if image.Mimetype != "" {
+			mimeType = image.Mimetype
+		}
 		if mimeType == "" {
 			mimeType = "image/jpeg"
 		}
 		imageMsg := &waE2E.ImageMessage{
 			Mimetype:      &mimeType,
 			Caption:       &content.Text,
-			JPEGThumbnail: nil, // We'll let WhatsApp generate the thumbnail
+			JPEGThumbnail: image.Thumbnail,
+		}
+		if image.Width > 0 {
+			imageMsg.Width = proto.Uint32(uint32(image.Width))
+			imageMsg.Height = proto.Uint32(uint32(image.Height))
 		}
 
 		if len(content.Mentions) > 0 || contextInfo != nil {
@@ -281,7 +321,7 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		}
 
 		// Upload the image
-		uploaded, err := a.waClient.Upload(a.ctx, imageData, whatsmeow.MediaImage)
+		uploaded, err := a.uploadReader(uploadCtx, parsedJID, content.ClientTempID, bytes.NewReader(image.Data), int64(len(image.Data)), whatsmeow.MediaImage)
 		if err != nil {
 			return "", fmt.Errorf("failed to upload image: %v", err)
 		}
@@ -297,11 +337,13 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 			ImageMessage: imageMsg,
 		}
 	case "video":
-		// Decode base64 video data
-		videoData, err := base64.StdEncoding.DecodeString(content.Base64Data)
+		// ffmpeg reads the video from a file.
+		content, cleanup, err := spillMedia(content)
 		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 video data: %v", err)
+			return "", err
 		}
+		defer cleanup()
+		video := probeVideo(uploadCtx, content.FilePath)
 
 		// Create video message
 		mimeType := content.Mimetype
@@ -311,7 +353,14 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		videoMsg := &waE2E.VideoMessage{
 			Mimetype:      &mimeType,
 			Caption:       &content.Text,
-			JPEGThumbnail: nil, // We'll let WhatsApp generate the thumbnail
+			JPEGThumbnail: video.Thumbnail,
+		}
+		if video.Seconds > 0 {
+			videoMsg.Seconds = proto.Uint32(video.Seconds)
+		}
+		if video.Width > 0 {
+			videoMsg.Width = proto.Uint32(uint32(video.Width))
+			videoMsg.Height = proto.Uint32(uint32(video.Height))
 		}
 
 		if len(content.Mentions) > 0 || contextInfo != nil {
@@ -325,7 +374,7 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		}
 
 		// Upload the video
-		uploaded, err := a.waClient.Upload(a.ctx, videoData, whatsmeow.MediaVideo)
+		uploaded, err := a.uploadMedia(uploadCtx, parsedJID, content, whatsmeow.MediaVideo)
 		if err != nil {
 			return "", fmt.Errorf("failed to upload video: %v", err)
 		}
@@ -341,10 +390,10 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 			VideoMessage: videoMsg,
 		}
 	case "audio":
-		// Decode base64 audio data
-		audioData, err := base64.StdEncoding.DecodeString(content.Base64Data)
-		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 audio data: %v", err)
+		voice, isOpus := probeAudio(content)
+		// WhatsApp only plays voice notes in Ogg/Opus.
+		if content.PTT && !isOpus {
+			return "", fmt.Errorf("voice notes must be Ogg/Opus audio")
 		}
 
 		// Create audio message
@@ -355,13 +404,21 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		audioMsg := &waE2E.AudioMessage{
 			Mimetype: &mimeType,
 		}
+		if isOpus {
+			audioMsg.Seconds = proto.Uint32(uint32((voice.Duration + time.Second/2) / time.Second))
+			audioMsg.Waveform = voice.Waveform
+			if content.PTT {
+				mimeType = "audio/ogg; codecs=opus"
+				audioMsg.PTT = proto.Bool(true)
+			}
+		}
 
 		if contextInfo != nil {
 			audioMsg.ContextInfo = contextInfo
 		}
 
 		// Upload the audio
-		uploaded, err := a.waClient.Upload(a.ctx, audioData, whatsmeow.MediaAudio)
+		uploaded, err := a.uploadMedia(uploadCtx, parsedJID, content, whatsmeow.MediaAudio)
 		if err != nil {
 			return "", fmt.Errorf("failed to upload audio: %v", err)
 		}
@@ -377,12 +434,6 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 			AudioMessage: audioMsg,
 		}
 	case "document":
-		// Decode base64 document data
-		documentData, err := base64.StdEncoding.DecodeString(content.Base64Data)
-		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 document data: %v", err)
-		}
-
 		// Create document message
 		mimeType := content.Mimetype
 		if mimeType == "" {
@@ -409,7 +460,7 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		}
 
 		// Upload the document
-		uploaded, err := a.waClient.Upload(a.ctx, documentData, whatsmeow.MediaDocument)
+		uploaded, err := a.uploadMedia(uploadCtx, parsedJID, content, whatsmeow.MediaDocument)
 		if err != nil {
 			return "", fmt.Errorf("failed to upload document: %v", err)
 		}
@@ -425,23 +476,36 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 			DocumentMessage: documentMsg,
 		}
 	case "sticker":
-		// Decode base64 sticker data
-		stickerData, err := base64.StdEncoding.DecodeString(content.Base64Data)
+		if content.StickerID != "" {
+			stickerMsg, err := a.storedSticker(content.StickerID)
+			if err != nil {
+				return "", err
+			}
+			msgContent = &waE2E.Message{
+				StickerMessage: stickerMsg,
+			}
+			break
+		}
+
+		data, err := readMedia(content)
+		if err != nil {
+			return "", err
+		}
+		sticker, animated, err := prepareSticker(uploadCtx, data)
 		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 sticker data: %v", err)
+			return "", fmt.Errorf("failed to prepare sticker: %w", err)
 		}
 
 		// Create sticker message
-		mimeType := content.Mimetype
-		if mimeType == "" {
-			mimeType = "image/webp"
-		}
 		stickerMsg := &waE2E.StickerMessage{
-			Mimetype: &mimeType,
+			Mimetype:   proto.String("image/webp"),
+			Width:      proto.Uint32(imaging.StickerSide),
+			Height:     proto.Uint32(imaging.StickerSide),
+			IsAnimated: proto.Bool(animated),
 		}
 
 		// Upload the sticker
-		uploaded, err := a.waClient.Upload(a.ctx, stickerData, whatsmeow.MediaImage) // Stickers use MediaImage
+		uploaded, err := a.uploadReader(uploadCtx, parsedJID, content.ClientTempID, bytes.NewReader(sticker), int64(len(sticker)), whatsmeow.MediaImage) // Stickers use MediaImage
 		if err != nil {
 			return "", fmt.Errorf("failed to upload sticker: %v", err)
 		}
@@ -460,6 +524,10 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		return "", fmt.Errorf("unsupported message type: %s", content.Type)
 	}
 
+	if err := uploadCtx.Err(); err != nil {
+		return "", errors.New("upload cancelled")
+	}
+
 	log.Printf("SendMessage Content: %+v\n", msgContent)
 
 	resp, err := a.waClient.SendMessage(a.ctx, parsedJID, msgContent)
@@ -556,6 +624,9 @@ func (a *Api) MarkRead(chatJID string, messageIDs []string, Type string) error {
 				log.Printf("MarkRead error for message %s: %v", msgID, err)
 			}
 		}
+		if err := a.messageStore.SetChatRead(parsedChatJID.String(), true); err != nil {
+			log.Println("MarkRead: failed to clear unread count:", err)
+		}
 	}
 	return nil
 }
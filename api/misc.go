@@ -4,7 +4,6 @@ import (
 	"html"
 	"strings"
 
-	"github.com/lugvitc/whats4linux/internal/misc"
 	"github.com/lugvitc/whats4linux/internal/settings"
 	"github.com/lugvitc/whats4linux/internal/store"
 	"go.mau.fi/whatsmeow/types"
@@ -45,29 +44,37 @@ func (a *Api) GetSettings() map[string]any {
 func replaceMentions(text string, mentionedJIDs []string, a *Api) string {
 	result := text
 
+	mentioned := make(map[string]types.JID, len(mentionedJIDs))
+	users := make([]types.JID, 0, len(mentionedJIDs))
 	for _, jid := range mentionedJIDs {
 		parsedJID, err := types.ParseJID(jid)
 		if err != nil {
 			continue
 		}
 		parsedJID = canonicalUserJID(a.ctx, a.waClient, parsedJID)
-		contact, _ := a.waClient.Store.Contacts.GetContact(a.ctx, parsedJID)
-		displayName := contact.FullName
-		if displayName == "" {
-			displayName = "~ " + contact.PushName
+		mentioned[jid] = parsedJID
+		users = append(users, parsedJID)
+	}
+	contacts := a.contactInfos(users)
+	overrides := a.contactOverrides()
+
+	for _, jid := range mentionedJIDs {
+		parsedJID, ok := mentioned[jid]
+		if !ok {
+			continue
 		}
-		if displayName == "" {
-			displayName = parsedJID.User
+		contact := contacts[parsedJID]
+		nickname := overrides[parsedJID.String()].Nickname
+		name := displayName(parsedJID, contact, nickname)
+		if !savedName(contact, nickname) && contact.PushName != "" {
+			// Like WhatsApp, mark names that aren't in the address book.
+			name = "~ " + name
 		}
 
 		mentionPattern := "@" + strings.Split(jid, "@")[0]
-		mentionHTML := `<span class="mention">@` + html.EscapeString(displayName) + `</span>`
+		mentionHTML := `<span class="mention">@` + html.EscapeString(name) + `</span>`
 		result = strings.ReplaceAll(result, mentionPattern, mentionHTML)
 	}
 
 	return result
 }
-
-func (a *Api) GetProfileColor(jidStr string) string {
-	return misc.GetProfileColor(jidStr)
-}
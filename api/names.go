@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/nyaruka/phonenumbers"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	wastore "go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// contactCache is an in-memory copy of whatsmeow's contact store. The first
+// lookup loads every contact in one query; after that lookups are map reads,
+// and contacts changed by events are read again on their next lookup.
+type contactCache struct {
+	mu sync.Mutex
+	// contacts is nil until loaded. A JID missing from a loaded map has no
+	// contact info.
+	contacts map[types.JID]types.ContactInfo
+	stale    map[types.JID]struct{}
+}
+
+func newContactCache() *contactCache {
+	return &contactCache{stale: make(map[types.JID]struct{})}
+}
+
+// lookup returns the contact info of every jid, with as few queries as the
+// cache allows. JIDs that failed to load are left out and their errors
+// returned.
+func (cc *contactCache) lookup(ctx context.Context, cs wastore.ContactStore, jids ...types.JID) (map[types.JID]types.ContactInfo, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.contacts == nil {
+		all, err := cs.GetAllContacts(ctx)
+		if err != nil {
+			log.Println("Failed to load contacts, looking them up one by one:", err)
+		} else {
+			cc.contacts = all
+			clear(cc.stale)
+		}
+	}
+
+	found := make(map[types.JID]types.ContactInfo, len(jids))
+	var errs error
+	for _, jid := range jids {
+		if cc.contacts != nil {
+			if _, stale := cc.stale[jid]; !stale {
+				found[jid] = cc.contacts[jid]
+				continue
+			}
+		}
+		info, err := cs.GetContact(ctx, jid)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to look up contact %s: %w", jid, err))
+			continue
+		}
+		found[jid] = info
+		if cc.contacts != nil {
+			cc.contacts[jid] = info
+			delete(cc.stale, jid)
+		}
+	}
+	return found, errs
+}
+
+// invalidate makes the next lookup of jids read them from the store again.
+func (cc *contactCache) invalidate(jids ...types.JID) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.contacts == nil {
+		return
+	}
+	for _, jid := range jids {
+		if !jid.IsEmpty() {
+			cc.stale[jid.ToNonAD()] = struct{}{}
+		}
+	}
+}
+
+// reset drops everything, e.g. when the account changes.
+func (cc *contactCache) reset() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.contacts = nil
+	clear(cc.stale)
+}
+
+// contactInfos returns the contact info of users, keyed by the JIDs as
+// given. LIDs are looked up under their phone number when it is known.
+// Users whose info failed to load are logged and left empty.
+func (a *Api) contactInfos(users []types.JID) map[types.JID]types.ContactInfo {
+	found, err := a.lookupContacts(users)
+	if err != nil {
+		log.Println(err)
+	}
+	return found
+}
+
+// lookupContacts is contactInfos, returning the lookup errors.
+func (a *Api) lookupContacts(users []types.JID) (map[types.JID]types.ContactInfo, error) {
+	found := make(map[types.JID]types.ContactInfo, len(users))
+	if a.waClient == nil || len(users) == 0 {
+		return found, nil
+	}
+	canonical := make([]types.JID, len(users))
+	for i, jid := range users {
+		canonical[i] = canonicalUserJID(a.ctx, a.waClient, jid)
+	}
+	var infos map[types.JID]types.ContactInfo
+	var errs error
+	if a.contacts != nil {
+		infos, errs = a.contacts.lookup(a.ctx, a.waClient.Store.Contacts, canonical...)
+	} else {
+		infos = make(map[types.JID]types.ContactInfo, len(canonical))
+		for _, jid := range canonical {
+			info, err := a.waClient.Store.Contacts.GetContact(a.ctx, jid)
+			if err != nil {
+				errs = errors.Join(errs, fmt.Errorf("failed to look up contact %s: %w", jid, err))
+				continue
+			}
+			infos[jid] = info
+		}
+	}
+	for i, jid := range users {
+		found[jid] = infos[canonical[i]]
+	}
+	return found, errs
+}
+
+// displayNameOf returns the name to show for a user, falling back to
+// pushName (e.g. from the message being shown) when the contact store has
+// none.
+func (a *Api) displayNameOf(jid types.JID, pushName string) string {
+	jid = a.userJID(jid)
+	info := a.contactInfos([]types.JID{jid})[jid]
+	if info.PushName == "" {
+		info.PushName = pushName
+	}
+	return displayName(jid, info, a.nickname(jid))
+}
+
+// displayName is the name shown for a user in the chat list, notifications
+// and mentions: the local nickname, then the name saved in the address book,
+// then their push name, then their verified business name, then their
+// number.
+func displayName(jid types.JID, info types.ContactInfo, nickname string) string {
+	switch {
+	case nickname != "":
+		return nickname
+	case info.FullName != "":
+		return info.FullName
+	case info.FirstName != "":
+		return info.FirstName
+	case info.PushName != "":
+		return info.PushName
+	case info.BusinessName != "":
+		return info.BusinessName
+	}
+	return formatNumber(jid, info)
+}
+
+// formatNumber formats a user's phone number for display. LIDs don't carry
+// one, so the redacted number WhatsApp shows in groups is used if known.
+func formatNumber(jid types.JID, info types.ContactInfo) string {
+	if jid.Server != types.DefaultUserServer {
+		if info.RedactedPhone != "" {
+			return info.RedactedPhone
+		}
+		return jid.User
+	}
+	num, err := phonenumbers.Parse("+"+jid.User, "")
+	if err != nil {
+		return "+" + jid.User
+	}
+	return phonenumbers.Format(num, phonenumbers.INTERNATIONAL)
+}
+
+// savedName reports whether the name displayName picks was chosen by the
+// user: a local nickname or a name from the address book.
+func savedName(info types.ContactInfo, nickname string) bool {
+	return nickname != "" || info.FullName != "" || info.FirstName != ""
+}
+
+// invalidateContact drops cached contact info after whatsmeow stored a
+// change, under both the given JIDs and their phone number.
+func (a *Api) invalidateContact(jids ...types.JID) {
+	if a.contacts == nil {
+		return
+	}
+	for _, jid := range jids {
+		if jid.IsEmpty() {
+			continue
+		}
+		a.contacts.invalidate(jid)
+		if a.waClient != nil {
+			a.contacts.invalidate(canonicalUserJID(a.ctx, a.waClient, jid))
+		}
+	}
+}
+
+// reloadContacts drops the contact cache after whatsmeow stored contacts
+// in bulk, without an event per contact, and has the chat list reload.
+func (a *Api) reloadContacts() {
+	if a.contacts == nil {
+		return
+	}
+	a.contacts.reset()
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+}
+
+// userJID is jid under its phone number when known, for formatting.
+func (a *Api) userJID(jid types.JID) types.JID {
+	if a.waClient == nil {
+		return jid.ToNonAD()
+	}
+	return canonicalUserJID(a.ctx, a.waClient, jid)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	wastore "go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// countingContacts is a ContactStore that counts its queries.
+type countingContacts struct {
+	wastore.ContactStore
+	contacts    map[types.JID]types.ContactInfo
+	all, single int
+	err         error
+}
+
+func (c *countingContacts) GetAllContacts(context.Context) (map[types.JID]types.ContactInfo, error) {
+	c.all++
+	if c.err != nil {
+		return nil, c.err
+	}
+	all := make(map[types.JID]types.ContactInfo, len(c.contacts))
+	for jid, info := range c.contacts {
+		all[jid] = info
+	}
+	return all, nil
+}
+
+func (c *countingContacts) GetContact(_ context.Context, jid types.JID) (types.ContactInfo, error) {
+	c.single++
+	return c.contacts[jid], c.err
+}
+
+func TestContactCacheLoadsOnceAndRereadsInvalidated(t *testing.T) {
+	alice := types.NewJID("15550001111", types.DefaultUserServer)
+	bob := types.NewJID("15550002222", types.DefaultUserServer)
+	cs := &countingContacts{contacts: map[types.JID]types.ContactInfo{
+		alice: {Found: true, PushName: "Alice"},
+	}}
+	cc := newContactCache()
+	ctx := context.Background()
+
+	got, err := cc.lookup(ctx, cs, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[alice].PushName != "Alice" || got[bob].Found {
+		t.Fatalf("lookup = %+v", got)
+	}
+	cc.lookup(ctx, cs, alice, bob)
+	if cs.all != 1 || cs.single != 0 {
+		t.Fatalf("queries = %d bulk, %d single; want 1 bulk only", cs.all, cs.single)
+	}
+
+	cs.contacts[alice] = types.ContactInfo{Found: true, PushName: "Alice B."}
+	cc.invalidate(alice)
+	if got, _ := cc.lookup(ctx, cs, alice, bob); got[alice].PushName != "Alice B." {
+		t.Fatalf("after invalidate = %+v, want the new push name", got[alice])
+	}
+	cc.lookup(ctx, cs, alice)
+	if cs.all != 1 || cs.single != 1 {
+		t.Fatalf("queries = %d bulk, %d single; want 1 and 1", cs.all, cs.single)
+	}
+}
+
+func TestContactCacheReturnsLookupErrors(t *testing.T) {
+	alice := types.NewJID("15550001111", types.DefaultUserServer)
+	failed := errors.New("database is locked")
+	cs := &countingContacts{err: failed}
+	got, err := newContactCache().lookup(context.Background(), cs, alice)
+	if !errors.Is(err, failed) {
+		t.Fatalf("err = %v, want %v", err, failed)
+	}
+	if _, ok := got[alice]; ok {
+		t.Fatal("a contact that failed to load was returned")
+	}
+}
+
+func TestDisplayNamePolicy(t *testing.T) {
+	pn := types.NewJID("14155550123", types.DefaultUserServer)
+	lid := types.NewJID("123456789", types.HiddenUserServer)
+	for _, tc := range []struct {
+		jid      types.JID
+		info     types.ContactInfo
+		nickname string
+		want     string
+	}{
+		{pn, types.ContactInfo{FullName: "Alice Smith", PushName: "al"}, "Ali", "Ali"},
+		{pn, types.ContactInfo{FullName: "Alice Smith", FirstName: "Alice", PushName: "al", BusinessName: "Al's"}, "", "Alice Smith"},
+		{pn, types.ContactInfo{PushName: "al", BusinessName: "Al's"}, "", "al"},
+		{pn, types.ContactInfo{BusinessName: "Al's"}, "", "Al's"},
+		{pn, types.ContactInfo{}, "", "+1 415-555-0123"},
+		{lid, types.ContactInfo{RedactedPhone: "+1∙∙∙∙∙∙∙∙23"}, "", "+1∙∙∙∙∙∙∙∙23"},
+		{lid, types.ContactInfo{}, "", "123456789"},
+	} {
+		if got := displayName(tc.jid, tc.info, tc.nickname); got != tc.want {
+			t.Errorf("displayName(%s, %+v, %q) = %q, want %q", tc.jid, tc.info, tc.nickname, got, tc.want)
+		}
+	}
+}
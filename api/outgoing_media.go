@@ -0,0 +1,185 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/ffmpeg"
+	"github.com/lugvitc/whats4linux/internal/imaging"
+	"github.com/lugvitc/whats4linux/internal/oggopus"
+	"github.com/lugvitc/whats4linux/internal/store"
+)
+
+// videoProbeTimeout bounds the ffmpeg run that reads a video's poster frame.
+const videoProbeTimeout = 20 * time.Second
+
+// readMedia returns the whole media of content, from its file or base64.
+func readMedia(content MessageContent) ([]byte, error) {
+	if content.FilePath != "" {
+		return os.ReadFile(content.FilePath)
+	}
+	data, err := base64.StdEncoding.DecodeString(content.Base64Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 %s data: %v", content.Type, err)
+	}
+	return data, nil
+}
+
+// Image send qualities, for the setting and MessageContent.Quality.
+const (
+	SendQualityStandard = "standard"
+	SendQualityHD       = "hd"
+	SendQualityOriginal = "original"
+)
+
+func sendProfile(quality string) (imaging.Profile, error) {
+	switch quality {
+	case SendQualityStandard:
+		return imaging.ProfileStandard, nil
+	case SendQualityHD:
+		return imaging.ProfileHD, nil
+	case SendQualityOriginal:
+		return imaging.Profile{}, nil
+	}
+	return imaging.Profile{}, fmt.Errorf("unknown send quality %q", quality)
+}
+
+// GetSendQuality returns how outgoing images are compressed: "standard"
+// (the default), "hd" or "original".
+func (a *Api) GetSendQuality() string {
+	if q := store.GetSendQuality(); q != "" {
+		return q
+	}
+	return SendQualityStandard
+}
+
+// SetSendQuality changes how outgoing images are compressed.
+func (a *Api) SetSendQuality(quality string) error {
+	if _, err := sendProfile(quality); err != nil {
+		return err
+	}
+	if err := store.SetSendQuality(quality); err != nil {
+		return fmt.Errorf("failed to save send quality: %w", err)
+	}
+	return nil
+}
+
+// prepareImage compresses an outgoing image at quality (the setting when
+// empty), strips its metadata and measures and thumbnails it. Images Go
+// can't decode are sent uncompressed and without a thumbnail, but still
+// stripped.
+func (a *Api) prepareImage(data []byte, quality string) (imaging.Outgoing, error) {
+	if quality == "" {
+		quality = a.GetSendQuality()
+	}
+	profile, err := sendProfile(quality)
+	if err != nil {
+		return imaging.Outgoing{}, err
+	}
+	out, err := imaging.PrepareOutgoing(data, profile)
+	if err != nil {
+		stripped, _, stripErr := imaging.StripMetadata(data)
+		if stripErr != nil {
+			return imaging.Outgoing{}, fmt.Errorf("failed to strip image metadata: %w", stripErr)
+		}
+		log.Println("Sending image without thumbnail:", err)
+		return imaging.Outgoing{Data: stripped}, nil
+	}
+	return out, nil
+}
+
+// spillMedia makes sure content's media is in a file, writing base64 data
+// to a temporary one, and returns content pointing at it. cleanup removes
+// the temporary file.
+func spillMedia(content MessageContent) (MessageContent, func(), error) {
+	if content.FilePath != "" {
+		return content, func() {}, nil
+	}
+	data, err := readMedia(content)
+	if err != nil {
+		return content, nil, err
+	}
+	tmp, err := os.CreateTemp("", "whats4linux-media-*")
+	if err != nil {
+		return content, nil, err
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return content, nil, err
+	}
+	content.FilePath = tmp.Name()
+	content.Base64Data = ""
+	return content, cleanup, nil
+}
+
+// probeAudio reads the length and waveform of Ogg/Opus audio. It reports
+// false for other formats, which are sent without them.
+func probeAudio(content MessageContent) (oggopus.Info, bool) {
+	var r io.Reader
+	if content.FilePath != "" {
+		f, err := os.Open(content.FilePath)
+		if err != nil {
+			return oggopus.Info{}, false
+		}
+		defer f.Close()
+		r = f
+	} else {
+		data, err := readMedia(content)
+		if err != nil {
+			return oggopus.Info{}, false
+		}
+		r = bytes.NewReader(data)
+	}
+	info, err := oggopus.Parse(r)
+	if err != nil {
+		if !errors.Is(err, oggopus.ErrNotOpus) {
+			log.Println("Sending audio without waveform:", err)
+		}
+		return oggopus.Info{}, false
+	}
+	return info, true
+}
+
+// videoDetails is what recipients see of a video before downloading it.
+type videoDetails struct {
+	Seconds       uint32
+	Width, Height int
+	Thumbnail     []byte
+}
+
+// probeVideo reads a video's duration and poster frame with ffmpeg. Without
+// ffmpeg, or when it fails, the video is sent without them.
+func probeVideo(ctx context.Context, path string) videoDetails {
+	ctx, cancel := context.WithTimeout(ctx, videoProbeTimeout)
+	defer cancel()
+	v, err := ffmpeg.Probe(ctx, path)
+	if err != nil {
+		if !errors.Is(err, ffmpeg.ErrNotInstalled) {
+			log.Println("Sending video without thumbnail:", err)
+		}
+		return videoDetails{}
+	}
+	details := videoDetails{Seconds: uint32((v.Duration + time.Second/2) / time.Second)}
+	poster, _, err := imaging.Decode(v.Poster)
+	if err != nil {
+		log.Println("Sending video without thumbnail:", err)
+		return details
+	}
+	details.Width, details.Height = poster.Bounds().Dx(), poster.Bounds().Dy()
+	if details.Thumbnail, err = imaging.Thumbnail(poster); err != nil {
+		log.Println("Sending video without thumbnail:", err)
+	}
+	return details
+}
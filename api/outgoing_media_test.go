@@ -0,0 +1,33 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestPrepareImageStripsImagesItCannotDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.Bytes()
+	// Mark the frame arithmetic-coded, which Go doesn't decode, and add a
+	// comment right after SOI.
+	i := bytes.Index(src, []byte{0xff, 0xc0})
+	src[i+1] = 0xc9
+	comment := []byte("\xff\xfe\x00\x08secret")
+	src = append(append(append([]byte{}, src[:2]...), comment...), src[2:]...)
+
+	out, err := (&Api{}).prepareImage(src, SendQualityStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Data) == 0 || bytes.Contains(out.Data, []byte("secret")) {
+		t.Fatal("undecodable image was sent with its metadata")
+	}
+	if out.Thumbnail != nil {
+		t.Fatal("undecodable image got a thumbnail")
+	}
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	// typingTimeout clears a composing/recording state when the matching
+	// "paused" never arrives (the sender closed the app, lost signal, ...).
+	typingTimeout = 15 * time.Second
+	// lastSeenCacheSize bounds the presence cache; the oldest entry is
+	// dropped when it is full.
+	lastSeenCacheSize = 512
+	// lastSeenRefreshAfter is how old a cached presence may get before
+	// GetLastSeen re-subscribes to refresh it.
+	lastSeenRefreshAfter = 5 * time.Minute
+)
+
+// TypingState is what a participant is currently doing in a chat.
+type TypingState struct {
+	ChatJID string `json:"chat_id"`
+	Sender  string `json:"sender"`
+	// State is "composing", "recording" or "paused".
+	State string `json:"state"`
+}
+
+// LastSeen is the cached online state of a contact. LastSeen is unix seconds
+// and 0 when unknown or hidden by the contact's privacy settings.
+type LastSeen struct {
+	JID       string `json:"jid"`
+	Online    bool   `json:"online"`
+	LastSeen  int64  `json:"last_seen"`
+	Known     bool   `json:"known"`
+	updatedAt time.Time
+}
+
+// stopper is the part of *time.Timer the tracker uses.
+type stopper interface {
+	Stop() bool
+}
+
+type typingEntry struct {
+	state string
+	timer stopper
+}
+
+// presenceTracker holds typing states per chat and participant, and a small
+// last-seen cache. Expired typing states are reported as "paused" through
+// onTyping.
+type presenceTracker struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	typing   map[string]map[string]*typingEntry // chat -> sender -> state
+	lastSeen map[string]LastSeen
+	onTyping func(TypingState)
+	// afterFunc starts expiry timers; tests replace it to fire them.
+	afterFunc func(time.Duration, func()) stopper
+}
+
+func newPresenceTracker(ttl time.Duration, onTyping func(TypingState)) *presenceTracker {
+	return &presenceTracker{
+		ttl:      ttl,
+		typing:   make(map[string]map[string]*typingEntry),
+		lastSeen: make(map[string]LastSeen),
+		onTyping: onTyping,
+		afterFunc: func(d time.Duration, f func()) stopper {
+			return time.AfterFunc(d, f)
+		},
+	}
+}
+
+// SetTyping records a typing state and reports it. Composing and recording
+// states expire after the tracker's ttl.
+func (pt *presenceTracker) SetTyping(chat, sender, state string) {
+	pt.mu.Lock()
+	senders := pt.typing[chat]
+	if senders == nil {
+		senders = make(map[string]*typingEntry)
+		pt.typing[chat] = senders
+	}
+	if old := senders[sender]; old != nil {
+		old.timer.Stop()
+		delete(senders, sender)
+	}
+	if state != string(types.ChatPresencePaused) {
+		entry := &typingEntry{state: state}
+		entry.timer = pt.afterFunc(pt.ttl, func() { pt.expire(chat, sender, entry) })
+		senders[sender] = entry
+	}
+	if len(senders) == 0 {
+		delete(pt.typing, chat)
+	}
+	pt.mu.Unlock()
+
+	pt.onTyping(TypingState{ChatJID: chat, Sender: sender, State: state})
+}
+
+func (pt *presenceTracker) expire(chat, sender string, entry *typingEntry) {
+	pt.mu.Lock()
+	senders := pt.typing[chat]
+	if senders == nil || senders[sender] != entry {
+		// Replaced or cleared in the meantime.
+		pt.mu.Unlock()
+		return
+	}
+	delete(senders, sender)
+	if len(senders) == 0 {
+		delete(pt.typing, chat)
+	}
+	pt.mu.Unlock()
+
+	pt.onTyping(TypingState{ChatJID: chat, Sender: sender, State: string(types.ChatPresencePaused)})
+}
+
+// Typing returns who is currently typing or recording in a chat.
+func (pt *presenceTracker) Typing(chat string) []TypingState {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	states := []TypingState{}
+	for sender, entry := range pt.typing[chat] {
+		states = append(states, TypingState{ChatJID: chat, Sender: sender, State: entry.state})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Sender < states[j].Sender })
+	return states
+}
+
+// SetLastSeen caches a presence update.
+func (pt *presenceTracker) SetLastSeen(ls LastSeen) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if _, ok := pt.lastSeen[ls.JID]; !ok && len(pt.lastSeen) >= lastSeenCacheSize {
+		var oldestJID string
+		var oldest time.Time
+		for jid, entry := range pt.lastSeen {
+			if oldestJID == "" || entry.updatedAt.Before(oldest) {
+				oldestJID, oldest = jid, entry.updatedAt
+			}
+		}
+		delete(pt.lastSeen, oldestJID)
+	}
+	ls.Known = true
+	ls.updatedAt = time.Now()
+	pt.lastSeen[ls.JID] = ls
+}
+
+// LastSeen returns the cached presence of jid.
+func (pt *presenceTracker) LastSeen(jid string) (LastSeen, bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	ls, ok := pt.lastSeen[jid]
+	return ls, ok
+}
+
+// Stop cancels pending expiry timers and forgets cached presence.
+func (pt *presenceTracker) Stop() {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	for _, senders := range pt.typing {
+		for _, entry := range senders {
+			entry.timer.Stop()
+		}
+	}
+	pt.typing = make(map[string]map[string]*typingEntry)
+	pt.lastSeen = make(map[string]LastSeen)
+}
+
+func (a *Api) emitTyping(ts TypingState) {
+	if a.ctx == nil || a.isShuttingDown() {
+		return
+	}
+	runtime.EventsEmit(a.ctx, "wa:typing", ts)
+}
+
+// handleChatPresence records a typing/recording/paused update.
+func (a *Api) handleChatPresence(v *events.ChatPresence) {
+	if v.IsFromMe {
+		return
+	}
+	chat := canonicalUserJID(a.ctx, a.waClient, v.Chat.ToNonAD())
+	sender := canonicalUserJID(a.ctx, a.waClient, v.Sender.ToNonAD())
+	state := string(v.State)
+	if v.State == types.ChatPresenceComposing && v.Media == types.ChatPresenceMediaAudio {
+		state = "recording"
+	}
+	a.presence.SetTyping(chat.String(), sender.String(), state)
+}
+
+// handlePresence caches an online/offline update and forwards it.
+func (a *Api) handlePresence(v *events.Presence) {
+	jid := canonicalUserJID(a.ctx, a.waClient, v.From.ToNonAD())
+	ls := LastSeen{JID: jid.String(), Online: !v.Unavailable}
+	if !v.LastSeen.IsZero() {
+		ls.LastSeen = v.LastSeen.Unix()
+	} else if !v.Unavailable {
+		ls.LastSeen = time.Now().Unix()
+	}
+	a.presence.SetLastSeen(ls)
+	if v.Unavailable {
+		// Someone going offline has stopped typing to us.
+		for _, ts := range a.presence.Typing(jid.String()) {
+			a.presence.SetTyping(ts.ChatJID, ts.Sender, string(types.ChatPresencePaused))
+		}
+	}
+	ls.Known = true
+	runtime.EventsEmit(a.ctx, "wa:presence", ls)
+}
+
+// SetOpenChat subscribes to typing and presence updates for the chat the user
+// has open, and returns who is typing in it right now. WhatsApp only sends
+// presence for contacts we subscribed to.
+func (a *Api) SetOpenChat(jidStr string) ([]TypingState, error) {
+	if jidStr == "" {
+		return []TypingState{}, nil
+	}
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return nil, err
+	}
+	if jid.Server == types.NewsletterServer || jid.Server == types.BroadcastServer {
+		return []TypingState{}, nil
+	}
+	if err := a.waClient.SubscribePresence(a.ctx, jid.ToNonAD()); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to presence: %w", err)
+	}
+	return a.presence.Typing(canonicalUserJID(a.ctx, a.waClient, jid.ToNonAD()).String()), nil
+}
+
+// GetLastSeen returns the cached online/last-seen state of a contact. Unknown
+// or stale entries trigger a presence subscription; the answer then arrives
+// as a wa:presence event.
+func (a *Api) GetLastSeen(jidStr string) (LastSeen, error) {
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return LastSeen{}, err
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return LastSeen{}, fmt.Errorf("%s is not a contact", jidStr)
+	}
+	jid = canonicalUserJID(a.ctx, a.waClient, jid.ToNonAD())
+	ls, ok := a.presence.LastSeen(jid.String())
+	if !ok || time.Since(ls.updatedAt) > lastSeenRefreshAfter {
+		a.startBackground(func() {
+			if err := a.waClient.SubscribePresence(a.ctx, jid); err != nil {
+				log.Println("GetLastSeen: presence subscription failed:", err)
+			}
+		})
+	}
+	if !ok {
+		return LastSeen{JID: jid.String()}, nil
+	}
+	return ls, nil
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresenceTrackerExpiresTyping(t *testing.T) {
+	var got []TypingState
+	pt := newPresenceTracker(typingTimeout, func(ts TypingState) { got = append(got, ts) })
+	var timer *fakeTimer
+	pt.afterFunc = func(d time.Duration, f func()) stopper {
+		timer = &fakeTimer{fire: f}
+		return timer
+	}
+
+	const chat, sender = "1@g.us", "2@s.whatsapp.net"
+	pt.SetTyping(chat, sender, "composing")
+	if typing := pt.Typing(chat); len(typing) != 1 || typing[0].State != "composing" {
+		t.Fatalf("typing = %+v, want one composing entry", typing)
+	}
+
+	timer.fire()
+	if typing := pt.Typing(chat); len(typing) != 0 {
+		t.Fatalf("typing after expiry = %+v, want none", typing)
+	}
+	if len(got) != 2 || got[1].Sender != sender || got[1].State != "paused" {
+		t.Fatalf("reported states = %+v, want composing then paused", got)
+	}
+}
+
+// fakeTimer is a presence expiry timer the test fires itself.
+type fakeTimer struct {
+	fire    func()
+	stopped bool
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.stopped = true
+	return true
+}
+
+func TestPresenceTrackerReplacedStateDoesNotExpireEarly(t *testing.T) {
+	var got []TypingState
+	pt := newPresenceTracker(typingTimeout, func(ts TypingState) { got = append(got, ts) })
+	var timers []*fakeTimer
+	pt.afterFunc = func(d time.Duration, f func()) stopper {
+		if d != typingTimeout {
+			t.Fatalf("timer set for %v, want %v", d, typingTimeout)
+		}
+		timer := &fakeTimer{fire: f}
+		timers = append(timers, timer)
+		return timer
+	}
+
+	const chat, sender = "3@s.whatsapp.net", "3@s.whatsapp.net"
+	pt.SetTyping(chat, sender, "composing")
+	pt.SetTyping(chat, sender, "recording")
+	if len(timers) != 2 || !timers[0].stopped {
+		t.Fatalf("replacing the state didn't stop its timer: %+v", timers)
+	}
+	// A timer that fired as it was stopped must not end the new state.
+	timers[0].fire()
+	if typing := pt.Typing(chat); len(typing) != 1 || typing[0].State != "recording" {
+		t.Fatalf("typing = %+v, want the newer recording state", typing)
+	}
+	timers[1].fire()
+	if typing := pt.Typing(chat); len(typing) != 0 {
+		t.Fatalf("typing after expiry = %+v, want none", typing)
+	}
+	if len(got) != 3 || got[2].State != "paused" {
+		t.Fatalf("reported states = %+v, want composing, recording, paused", got)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// PrivacySettings mirrors the privacy options exposed in the settings view.
+// Values are whatsmeow's setting strings ("all", "contacts", "none", ...).
+type PrivacySettings struct {
+	LastSeen     string `json:"last_seen"`
+	Online       string `json:"online"`
+	Profile      string `json:"profile"`
+	About        string `json:"about"`
+	GroupAdd     string `json:"group_add"`
+	ReadReceipts string `json:"read_receipts"`
+}
+
+func privacySettingsFrom(s types.PrivacySettings) PrivacySettings {
+	return PrivacySettings{
+		LastSeen:     string(s.LastSeen),
+		Online:       string(s.Online),
+		Profile:      string(s.Profile),
+		About:        string(s.Status),
+		GroupAdd:     string(s.GroupAdd),
+		ReadReceipts: string(s.ReadReceipts),
+	}
+}
+
+// privacyOptions maps the PrivacySettings JSON names to the whatsmeow setting
+// type and the values WhatsApp accepts for it.
+var privacyOptions = map[string]struct {
+	kind   types.PrivacySettingType
+	values []types.PrivacySetting
+}{
+	"last_seen": {types.PrivacySettingTypeLastSeen, []types.PrivacySetting{
+		types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone,
+	}},
+	"online": {types.PrivacySettingTypeOnline, []types.PrivacySetting{
+		types.PrivacySettingAll, types.PrivacySettingMatchLastSeen,
+	}},
+	"profile": {types.PrivacySettingTypeProfile, []types.PrivacySetting{
+		types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone,
+	}},
+	"about": {types.PrivacySettingTypeStatus, []types.PrivacySetting{
+		types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone,
+	}},
+	"group_add": {types.PrivacySettingTypeGroupAdd, []types.PrivacySetting{
+		types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone,
+	}},
+	"read_receipts": {types.PrivacySettingTypeReadReceipts, []types.PrivacySetting{
+		types.PrivacySettingAll, types.PrivacySettingNone,
+	}},
+}
+
+// GetPrivacySettings fetches the account's privacy settings.
+func (a *Api) GetPrivacySettings() (PrivacySettings, error) {
+	settings, err := a.waClient.TryFetchPrivacySettings(a.ctx, false)
+	if err != nil {
+		return PrivacySettings{}, fmt.Errorf("failed to fetch privacy settings: %w", err)
+	}
+	return privacySettingsFrom(*settings), nil
+}
+
+// SetPrivacySetting changes one privacy setting (named as in PrivacySettings)
+// and returns the updated settings.
+func (a *Api) SetPrivacySetting(name, value string) (PrivacySettings, error) {
+	opt, ok := privacyOptions[name]
+	if !ok {
+		return PrivacySettings{}, fmt.Errorf("unknown privacy setting %q", name)
+	}
+	if !slices.Contains(opt.values, types.PrivacySetting(value)) {
+		return PrivacySettings{}, fmt.Errorf("invalid value %q for privacy setting %q", value, name)
+	}
+	settings, err := a.waClient.SetPrivacySetting(a.ctx, opt.kind, types.PrivacySetting(value))
+	if err != nil {
+		return PrivacySettings{}, fmt.Errorf("failed to update privacy setting: %w", err)
+	}
+	return privacySettingsFrom(settings), nil
+}
+
+// GetBlocklist returns the blocked contacts from the local blocklist.
+func (a *Api) GetBlocklist() ([]string, error) {
+	return a.messageStore.GetBlockedJIDs()
+}
+
+// IsBlocked reports whether a contact is blocked.
+func (a *Api) IsBlocked(jidStr string) (bool, error) {
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return false, err
+	}
+	return a.messageStore.IsBlocked(canonicalUserJID(a.ctx, a.waClient, jid.ToNonAD()).String()), nil
+}
+
+// BlockContact blocks a contact.
+func (a *Api) BlockContact(jidStr string) error {
+	return a.updateBlocklist(jidStr, events.BlocklistChangeActionBlock)
+}
+
+// UnblockContact unblocks a contact.
+func (a *Api) UnblockContact(jidStr string) error {
+	return a.updateBlocklist(jidStr, events.BlocklistChangeActionUnblock)
+}
+
+func (a *Api) updateBlocklist(jidStr string, action events.BlocklistChangeAction) error {
+	jid, err := types.ParseJID(jidStr)
+	if err != nil {
+		return err
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return fmt.Errorf("%s is not a contact", jidStr)
+	}
+	list, err := a.waClient.UpdateBlocklist(a.ctx, jid.ToNonAD(), action)
+	if err != nil {
+		return fmt.Errorf("failed to %s contact: %w", action, err)
+	}
+	// The response carries the whole updated list.
+	a.storeBlocklist(list)
+	return nil
+}
+
+// storeBlocklist replaces the local blocklist with a full server copy.
+func (a *Api) storeBlocklist(list *types.Blocklist) {
+	jids := make([]string, 0, len(list.JIDs))
+	for _, jid := range list.JIDs {
+		jids = append(jids, canonicalUserJID(a.ctx, a.waClient, jid.ToNonAD()).String())
+	}
+	if err := a.messageStore.ReplaceBlocklist(jids); err != nil {
+		log.Println("Failed to store blocklist:", err)
+		return
+	}
+	runtime.EventsEmit(a.ctx, "wa:blocklist_update")
+}
+
+// syncBlocklist refreshes the local blocklist from the server.
+func (a *Api) syncBlocklist() {
+	list, err := a.waClient.GetBlocklist(a.ctx)
+	if err != nil {
+		log.Println("Failed to fetch blocklist:", err)
+		return
+	}
+	a.storeBlocklist(list)
+}
+
+// handleBlocklistEvent applies a blocklist change made on another device.
+func (a *Api) handleBlocklistEvent(v *events.Blocklist) {
+	if v.Action == events.BlocklistActionModify || len(v.Changes) == 0 {
+		// No diff attached; the whole list has to be re-requested.
+		a.startBackground(a.syncBlocklist)
+		return
+	}
+	for _, change := range v.Changes {
+		jid := canonicalUserJID(a.ctx, a.waClient, change.JID.ToNonAD()).String()
+		blocked := change.Action == events.BlocklistChangeActionBlock
+		if err := a.messageStore.SetBlocked(jid, blocked); err != nil {
+			log.Println("Failed to update blocklist:", err)
+		}
+	}
+	runtime.EventsEmit(a.ctx, "wa:blocklist_update")
+}
+
+// isBlockedSender reports whether a message comes from a blocked contact.
+func (a *Api) isBlockedSender(info *types.MessageInfo) bool {
+	if info.IsFromMe {
+		return false
+	}
+	sender := canonicalUserJID(a.ctx, a.waClient, info.Sender.ToNonAD())
+	return a.messageStore.IsBlocked(sender.String())
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gen2brain/beeep"
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// maxNameCopies bounds the " (n)" suffixes tried for a free file name.
+const maxNameCopies = 1000
+
+// maxFileNameBytes is the longest file name Linux file systems take.
+const maxFileNameBytes = 255
+
+var errSaveRunning = errors.New("already saving this chat's media")
+
+// SaveProgress is the payload of wa:save_progress, reported as
+// SaveChatMedia works through a chat.
+type SaveProgress struct {
+	ChatJID string `json:"chatId"`
+	Dir     string `json:"dir"`
+	State   string `json:"state"` // DownloadRunning, DownloadDone or DownloadCancelled
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Saved   int    `json:"saved"`
+	Failed  int    `json:"failed"`
+}
+
+// SaveMedia saves a message's media, downloading it first when it isn't
+// cached, and returns where it was saved. destDir defaults to the user's
+// download directory. The file keeps the name it was sent with; a file of
+// that name already there gets a " (n)" suffix instead of being replaced.
+func (a *Api) SaveMedia(chatJID, messageID, destDir string) (string, error) {
+	if a.messageStore == nil {
+		return "", fmt.Errorf("message store is not ready")
+	}
+	msg, err := a.messageStore.GetMessageWithMedia(chatJID, messageID)
+	if err != nil || msg == nil {
+		return "", fmt.Errorf("message not found")
+	}
+	if msg.Media == nil {
+		return "", fmt.Errorf("message %s has no downloadable media", messageID)
+	}
+	dir, err := saveDir(destDir)
+	if err != nil {
+		return "", err
+	}
+	path, err := a.saveMedia(a.ctx, msg, dir)
+	if err != nil {
+		return "", err
+	}
+	if err := beeep.Notify(misc.APP_NAME, "Saved "+path, ""); err != nil {
+		log.Println("notify failed:", err)
+	}
+	return path, nil
+}
+
+// SaveChatMedia starts saving the media of every message in a chat, oldest
+// first, like SaveMedia, and returns the directory it saves to. It runs in
+// the background, reporting wa:save_progress after each file, until done or
+// stopped with CancelSaveChatMedia. Media that fails to download or save is
+// skipped and counted.
+func (a *Api) SaveChatMedia(chatJID, destDir string) (string, error) {
+	if a.messageStore == nil {
+		return "", fmt.Errorf("message store is not ready")
+	}
+	ids, err := a.messageStore.ChatMediaMessageIDs(chatJID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list chat media: %w", err)
+	}
+	dir, err := saveDir(destDir)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	if _, running := a.saves.LoadOrStore(chatJID, cancel); running {
+		cancel()
+		return "", errSaveRunning
+	}
+	started := a.startBackground(func() {
+		defer func() {
+			a.saves.CompareAndDelete(chatJID, cancel)
+			cancel()
+		}()
+		a.saveChatMedia(ctx, chatJID, ids, dir)
+	})
+	if !started {
+		a.saves.CompareAndDelete(chatJID, cancel)
+		cancel()
+		return "", errDownloadShutdown
+	}
+	return dir, nil
+}
+
+// CancelSaveChatMedia stops saving a chat's media. The file being saved is
+// removed; those already saved are kept. It reports whether a save was
+// running.
+func (a *Api) CancelSaveChatMedia(chatJID string) bool {
+	cancel, ok := a.saves.LoadAndDelete(chatJID)
+	if ok {
+		cancel.(context.CancelFunc)()
+	}
+	return ok
+}
+
+// cancelSaves stops every SaveChatMedia job.
+func (a *Api) cancelSaves() {
+	a.saves.Range(func(chatJID, cancel any) bool {
+		cancel.(context.CancelFunc)()
+		return true
+	})
+}
+
+// saveChatMedia saves the media of ids into dir for SaveChatMedia.
+func (a *Api) saveChatMedia(ctx context.Context, chatJID string, ids []string, dir string) {
+	progress := SaveProgress{ChatJID: chatJID, Dir: dir, State: DownloadRunning, Total: len(ids)}
+	a.emitSaveProgress(progress)
+	msgs := make([]*store.ExtendedMessage, 0, len(ids))
+	for _, id := range ids {
+		msg, err := a.messageStore.GetMessageWithMedia(chatJID, id)
+		if err != nil || msg.Media == nil {
+			progress.Done++
+			progress.Failed++
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	for i, msg := range msgs {
+		if ctx.Err() != nil {
+			break
+		}
+		// Keep the download workers busy with the next few while this one
+		// saves.
+		for _, next := range msgs[i+1 : min(i+1+maxParallelDownloads, len(msgs))] {
+			a.fetchUncached(next)
+		}
+		if _, err := a.saveMedia(ctx, msg, dir); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("Failed to save media of message %s: %v", msg.Info.ID, err)
+			progress.Failed++
+		} else {
+			progress.Saved++
+		}
+		progress.Done++
+		a.emitSaveProgress(progress)
+	}
+
+	progress.State = DownloadDone
+	if ctx.Err() != nil {
+		progress.State = DownloadCancelled
+	}
+	a.emitSaveProgress(progress)
+	if progress.Saved > 0 {
+		if err := beeep.Notify(misc.APP_NAME, fmt.Sprintf("Saved %d files to %s", progress.Saved, dir), ""); err != nil {
+			log.Println("notify failed:", err)
+		}
+	}
+}
+
+func (a *Api) emitSaveProgress(p SaveProgress) {
+	runtime.EventsEmit(a.ctx, "wa:save_progress", p)
+}
+
+// saveDir is where media is saved: destDir, or the download directory.
+func saveDir(destDir string) (string, error) {
+	dir := destDir
+	if dir == "" {
+		dir = misc.DownloadDir()
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// fetchUncached starts downloading a message's media into the cache unless
+// it is there already.
+func (a *Api) fetchUncached(msg *store.ExtendedMessage) {
+	if a.mediaCache == nil {
+		return
+	}
+	if meta, err := a.mediaCache.Get(msg.Info.ID); err != nil || meta != nil {
+		return
+	}
+	if _, err := a.fetchMedia(msg); err != nil {
+		log.Println("Failed to queue media download:", err)
+	}
+}
+
+// saveMedia copies a message's media from the cache into dir, downloading
+// it first when it isn't cached, and returns the new file's path. Waiting
+// for the download stops when ctx is done.
+func (a *Api) saveMedia(ctx context.Context, msg *store.ExtendedMessage, dir string) (string, error) {
+	if a.mediaCache == nil {
+		return "", fmt.Errorf("media cache is not ready")
+	}
+	in, meta, err := a.mediaCache.Open(msg.Info.ID)
+	if err != nil {
+		return "", err
+	}
+	var src io.ReadCloser
+	mimeType := ""
+	if in != nil {
+		src, mimeType = in, meta.Mime
+	} else {
+		p, err := a.fetchMedia(msg)
+		if err != nil {
+			return "", err
+		}
+		// Saved as it downloads, straight from the download: media too
+		// big for the cache never lands there.
+		if src, err = p.NewReader(ctx); err != nil {
+			return "", err
+		}
+		mimeType = mediaMime(msg.Media)
+	}
+	defer src.Close()
+
+	out, err := createUnique(dir, saveFileName(msg, mimeType))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to save media: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to save media: %w", err)
+	}
+	return out.Name(), nil
+}
+
+// saveFileName names saved media: the file name it was sent with, or one
+// made up from its type and time the way WhatsApp names unnamed media. A
+// name without an extension gets the one of its MIME type, and one too long
+// for the file system is shortened before its extension.
+func saveFileName(msg *store.ExtendedMessage, mimeType string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 {
+			return '_'
+		}
+		return r
+	}, msg.Media.GetFileName())
+	// No hidden files, and no "..".
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		label := "File"
+		switch msg.Media.GetMediaGeneralType() {
+		case mtypes.MediaTypeImage:
+			label = "Image"
+		case mtypes.MediaTypeVideo:
+			label = "Video"
+		case mtypes.MediaTypeAudio:
+			label = "Audio"
+		case mtypes.MediaTypeDocument:
+			label = "Document"
+		case mtypes.MediaTypeSticker:
+			label = "Sticker"
+		}
+		// The time has dots in it; always add the extension.
+		return "WhatsApp " + label + " " + msg.Info.Timestamp.Local().Format("2006-01-02 at 15.04.05") + getFileExtension(mimeType)
+	}
+	if filepath.Ext(name) == "" {
+		name += getFileExtension(mimeType)
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > maxFileNameBytes/2 {
+		// Too long to be an extension.
+		ext = ""
+	}
+	return fitFileName(strings.TrimSuffix(name, ext), ext)
+}
+
+// fitFileName joins base and suffix, shortening base so the result fits in
+// maxFileNameBytes without splitting a UTF-8 character.
+func fitFileName(base, suffix string) string {
+	n := maxFileNameBytes - len(suffix)
+	if len(base) <= n {
+		return base + suffix
+	}
+	for n > 0 && !utf8.RuneStart(base[n]) {
+		n--
+	}
+	return base[:n] + suffix
+}
+
+// createUnique creates name in dir, or "name (n)" with the lowest n free
+// when a file of that name exists.
+func createUnique(dir, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for n := 0; n < maxNameCopies; n++ {
+		candidate := name
+		if n > 0 {
+			candidate = fitFileName(base, fmt.Sprintf(" (%d)%s", n, ext))
+		}
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", candidate, err)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("no free file name for %s in %s", name, dir)
+}
+
+// getFileExtension returns the file extension for a MIME type, or "" when
+// there is none.
+func getFileExtension(mimeType string) string {
+	mimeType, _, _ = mime.ParseMediaType(mimeType)
+	switch mimeType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/jpeg", "image/jpg":
+		return ".jpg"
+	case "video/mp4":
+		return ".mp4"
+	case "video/3gpp":
+		return ".3gp"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/m4a":
+		return ".m4a"
+	case "application/pdf":
+		return ".pdf"
+	}
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
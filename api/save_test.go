@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestSaveFileName(t *testing.T) {
+	sent := time.Date(2026, 3, 4, 15, 6, 7, 0, time.Local)
+	message := func(fileName string, mediaType mtypes.MediaType) *store.ExtendedMessage {
+		return &store.ExtendedMessage{
+			Info:  types.MessageInfo{Timestamp: sent},
+			Media: wa.NewMedia("/path", nil, nil, nil, "", "", fileName, 0, 0, 0, mediaType),
+		}
+	}
+	for _, tc := range []struct {
+		msg  *store.ExtendedMessage
+		mime string
+		want string
+	}{
+		{message("report.pdf", mtypes.MediaTypeDocument), "application/pdf", "report.pdf"},
+		{message("notes", mtypes.MediaTypeDocument), "application/pdf", "notes.pdf"},
+		{message("../../.bashrc", mtypes.MediaTypeDocument), "text/plain", "_.._.bashrc"},
+		{message("..", mtypes.MediaTypeDocument), "application/pdf", "WhatsApp Document 2026-03-04 at 15.06.07.pdf"},
+		{message("", mtypes.MediaTypeImage), "image/jpeg", "WhatsApp Image 2026-03-04 at 15.06.07.jpg"},
+		{message("", mtypes.MediaTypeSticker), "image/webp", "WhatsApp Sticker 2026-03-04 at 15.06.07.webp"},
+		{message("", mtypes.MediaTypeAudio), "audio/ogg; codecs=opus", "WhatsApp Audio 2026-03-04 at 15.06.07.ogg"},
+		{message(strings.Repeat("a", 300)+".pdf", mtypes.MediaTypeDocument), "application/pdf", strings.Repeat("a", 251) + ".pdf"},
+		{message(strings.Repeat("é", 200), mtypes.MediaTypeDocument), "application/pdf", strings.Repeat("é", 125) + ".pdf"},
+	} {
+		if got := saveFileName(tc.msg, tc.mime); got != tc.want {
+			t.Errorf("saveFileName(%q, %q) = %q, want %q", tc.msg.Media.GetFileName(), tc.mime, got, tc.want)
+		}
+	}
+}
+
+func TestCreateUnique(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "photo.jpg"), []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"photo (1).jpg", "photo (2).jpg"} {
+		f, err := createUnique(dir, "photo.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if got := filepath.Base(f.Name()); got != want {
+			t.Errorf("created %q, want %q", got, want)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "photo.jpg")); string(data) != "first" {
+		t.Errorf("existing file was overwritten: %q", data)
+	}
+}
+
+func TestCreateUniqueKeepsLongNamesInBounds(t *testing.T) {
+	dir := t.TempDir()
+	name := strings.Repeat("a", 251) + ".pdf"
+	for _, want := range []string{name, strings.Repeat("a", 247) + " (1).pdf"} {
+		f, err := createUnique(dir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if got := filepath.Base(f.Name()); got != want {
+			t.Errorf("created %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCancelSaveChatMedia(t *testing.T) {
+	a := &Api{}
+	cancelled := false
+	a.saves.Store("chat", context.CancelFunc(func() { cancelled = true }))
+	if !a.CancelSaveChatMedia("chat") || !cancelled {
+		t.Fatal("running save wasn't cancelled")
+	}
+	if a.CancelSaveChatMedia("chat") {
+		t.Fatal("cancelled a save that had stopped")
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// SessionEnded describes why the WhatsApp session stopped. It accompanies the
+// matching wa:status value ("logged_out", "stream_replaced" or
+// "temporary_ban") on wa:session_ended.
+type SessionEnded struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+	// ExpiresAt is when a temporary ban lifts, in unix seconds.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+func (a *Api) emitSessionEnded(ended SessionEnded) {
+	runtime.EventsEmit(a.ctx, "wa:status", ended.State)
+	runtime.EventsEmit(a.ctx, "wa:session_ended", ended)
+}
+
+// handleLoggedOut reacts to the phone unlinking this device. The device is
+// gone from session.wa, which leaves the client unusable, so a fresh device
+// store is created for the next QR login. Local history is kept;
+// Logout(true) wipes it.
+func (a *Api) handleLoggedOut(v *events.LoggedOut) {
+	gen := a.sessionGen.Load()
+	// Not a background task: Logout(true) waits for those while holding
+	// loginMu, which this needs.
+	go func() {
+		a.loginMu.Lock()
+		defer a.loginMu.Unlock()
+		// Logout already reset the session, or Shutdown is closing what a
+		// reset would touch.
+		if a.sessionGen.Load() != gen || a.isShuttingDown() {
+			return
+		}
+		if err := a.resetSession(false); err != nil {
+			log.Println("Failed to reset session after logout:", err)
+		}
+		a.emitSessionEnded(SessionEnded{State: "logged_out", Reason: v.Reason.String()})
+	}()
+}
+
+// handleStreamReplaced reports that another client took over this session.
+// whatsmeow doesn't reconnect by itself; Login connects again.
+func (a *Api) handleStreamReplaced() {
+	a.emitSessionEnded(SessionEnded{
+		State:  "stream_replaced",
+		Reason: "WhatsApp was opened with this account on another computer",
+	})
+}
+
+func (a *Api) handleTemporaryBan(v *events.TemporaryBan) {
+	ended := SessionEnded{State: "temporary_ban", Reason: v.Code.String()}
+	if v.Expire > 0 {
+		ended.ExpiresAt = time.Now().Add(v.Expire).Unix()
+	}
+	a.emitSessionEnded(ended)
+}
+
+// Logout unlinks this device from the account and prepares a fresh device
+// store so the QR screen can be shown again without a restart. With wipe
+// set, messages.db, app.db and the media cache are deleted as well.
+func (a *Api) Logout(wipe bool) error {
+	a.cancelPendingLogin(false)
+	a.loginMu.Lock()
+	defer a.loginMu.Unlock()
+	if a.isShuttingDown() {
+		return context.Canceled
+	}
+
+	a.lifecycleMu.Lock()
+	client := a.waClient
+	a.lifecycleMu.Unlock()
+	if client == nil {
+		return errors.New("WhatsApp client is not ready")
+	}
+	if client.Store.ID != nil {
+		if err := client.Logout(a.ctx); err != nil {
+			// Most likely offline. Drop the session locally anyway so the
+			// user isn't stuck; the phone lists the device until it is
+			// removed there.
+			log.Println("Logout request failed, removing session locally:", err)
+			client.Disconnect()
+			if err := client.Store.Delete(a.ctx); err != nil {
+				return fmt.Errorf("failed to delete session: %w", err)
+			}
+		}
+	}
+
+	if err := a.resetSession(wipe); err != nil {
+		return err
+	}
+	a.emitSessionEnded(SessionEnded{State: "logged_out", Reason: "user_initiated"})
+	return nil
+}
+
+// resetSession detaches the event handler from the logged-out client and
+// replaces it with a client on a new, unpaired device. With wipe set, the
+// local stores are emptied. Must be called with
+// loginMu held; with wipe set, not from a background task.
+func (a *Api) resetSession(wipe bool) error {
+	a.lifecycleMu.Lock()
+	old := a.waClient
+	if old != nil && a.eventHandlerSet {
+		old.RemoveEventHandler(a.eventHandlerID)
+		a.eventHandlerSet = false
+	}
+	container := a.waContainer
+	a.lifecycleMu.Unlock()
+	if container == nil {
+		return errors.New("WhatsApp session database is not open")
+	}
+	a.sessionGen.Add(1)
+	if old != nil {
+		old.Disconnect()
+	}
+	// whatsmeow deletes a logged-out device itself, but only after it has
+	// dispatched LoggedOut; without this GetFirstDevice could load it again.
+	if err := deleteDevices(a.ctx, container); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if a.downloads != nil {
+		a.downloads.cancelAll()
+	}
+	a.cancelSaves()
+
+	if wipe {
+		// Let events that were already running, and what they started,
+		// finish before their stores go away.
+		a.eventMu.Lock()
+		a.eventMu.Unlock()
+		a.backgroundTasks.Wait()
+		if err := a.wipeLocalData(); err != nil {
+			return err
+		}
+	}
+
+	if a.contacts != nil {
+		a.contacts.reset()
+	}
+	a.resetContactOverrides()
+	if a.presence != nil {
+		a.presence.Stop()
+	}
+	// GetFirstDevice creates a new device once the old one is deleted.
+	client, err := a.newClient(container)
+	if err != nil {
+		return err
+	}
+	a.lifecycleMu.Lock()
+	a.waClient = client
+	a.lifecycleMu.Unlock()
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	return nil
+}
+
+// deleteDevices removes every device from session.wa. whatsmeow is handed
+// fresh copies, so this doesn't race with it deleting the logged-out
+// client's own store.
+func deleteDevices(ctx context.Context, container *sqlstore.Container) error {
+	devices, err := container.GetAllDevices(ctx)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		if err := container.DeleteDevice(ctx, device); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wipeLocalData empties messages.db, app.db and the media cache. The stores
+// stay open: calls and the asset server running alongside see them empty,
+// never closed. session.wa and app_settings.json are kept.
+func (a *Api) wipeLocalData() error {
+	var err error
+	if a.messageStore != nil {
+		err = errors.Join(err, a.messageStore.Wipe())
+	}
+	if a.mediaCache != nil {
+		err = errors.Join(err, a.mediaCache.Clear())
+	}
+	if a.cw != nil {
+		err = errors.Join(err, a.cw.Wipe())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to wipe local data: %w", err)
+	}
+	return nil
+}
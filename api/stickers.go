@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/ffmpeg"
+	"github.com/lugvitc/whats4linux/internal/imaging"
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/store"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// recentStickerLimit is how many recent stickers the catalog lists.
+const recentStickerLimit = 30
+
+// stickerEncodeTimeout bounds the ffmpeg runs that compress a sticker.
+const stickerEncodeTimeout = 20 * time.Second
+
+// LocalSticker is an image file in a local sticker pack, sent with
+// MessageContent.FilePath.
+type LocalSticker struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+}
+
+// StickerPack is a folder of stickers under the packs directory.
+type StickerPack struct {
+	Name     string         `json:"name"`
+	Stickers []LocalSticker `json:"stickers"`
+}
+
+// StickerCatalog is everything the sticker picker shows. Stored stickers
+// are sent again with MessageContent.StickerID.
+type StickerCatalog struct {
+	Favorites []store.StoredSticker `json:"favorites"`
+	Recent    []store.StoredSticker `json:"recent"`
+	Packs     []StickerPack         `json:"packs"`
+}
+
+// stickerPacksDir holds one folder per local sticker pack.
+func stickerPacksDir() string {
+	return filepath.Join(misc.ConfigDir, "stickers")
+}
+
+// isStickerFile reports whether a pack file can be sent as a sticker.
+func isStickerFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".webp", ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
+
+// loadStickerPacks lists the packs in dir. Loose files and empty folders
+// are ignored.
+func loadStickerPacks(dir string) ([]StickerPack, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var packs []StickerPack
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, e.Name()))
+		if err != nil {
+			log.Println("Skipping sticker pack:", err)
+			continue
+		}
+		pack := StickerPack{Name: e.Name()}
+		for _, f := range files {
+			if f.Type().IsRegular() && isStickerFile(f.Name()) {
+				pack.Stickers = append(pack.Stickers, LocalSticker{
+					Path: filepath.Join(dir, e.Name(), f.Name()),
+					Name: strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())),
+				})
+			}
+		}
+		if len(pack.Stickers) > 0 {
+			packs = append(packs, pack)
+		}
+	}
+	return packs, nil
+}
+
+// GetStickerPacksDir returns the folder local sticker packs are read from:
+// each folder in it is a pack of WebP, PNG, JPEG or GIF files.
+func (a *Api) GetStickerPacksDir() string {
+	return stickerPacksDir()
+}
+
+// GetStickerCatalog returns the favorite and recent stickers and the local
+// sticker packs.
+func (a *Api) GetStickerCatalog() (StickerCatalog, error) {
+	var catalog StickerCatalog
+	if a.messageStore != nil {
+		var err error
+		if catalog.Favorites, err = a.messageStore.FavoriteStickers(); err != nil {
+			return catalog, fmt.Errorf("failed to load favorite stickers: %w", err)
+		}
+		if catalog.Recent, err = a.messageStore.RecentStickers(recentStickerLimit); err != nil {
+			return catalog, fmt.Errorf("failed to load recent stickers: %w", err)
+		}
+	}
+	packs, err := loadStickerPacks(stickerPacksDir())
+	if err != nil {
+		return catalog, fmt.Errorf("failed to load sticker packs: %w", err)
+	}
+	catalog.Packs = packs
+	return catalog, nil
+}
+
+// SetStickerFavorite adds a sent or received sticker to the favorites, or
+// removes it.
+func (a *Api) SetStickerFavorite(stickerID string, favorite bool) error {
+	if a.messageStore == nil {
+		return fmt.Errorf("message store is not ready")
+	}
+	return a.messageStore.SetStickerFavorite(stickerID, favorite)
+}
+
+// GetLocalSticker returns a sticker from a local pack as a data URL.
+func (a *Api) GetLocalSticker(path string) (string, error) {
+	rel, err := filepath.Rel(stickerPacksDir(), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || !isStickerFile(path) {
+		return "", fmt.Errorf("%s is not in a sticker pack", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	mimeType := mimeTypeOf(path)
+	if mimeType == "" {
+		mimeType = "image/webp"
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// prepareSticker makes data sendable as a sticker. WebP stickers are sent
+// as they are if WhatsApp accepts them; PNG, JPEG and GIF images (the first
+// frame) are converted to a static 512x512 WebP.
+func prepareSticker(ctx context.Context, data []byte) ([]byte, bool, error) {
+	if w, h, animated, err := imaging.WebPInfo(data); err == nil {
+		limit := imaging.MaxStickerBytes
+		if animated {
+			limit = imaging.MaxAnimatedStickerBytes
+		}
+		switch {
+		case w != imaging.StickerSide || h != imaging.StickerSide:
+			return nil, false, fmt.Errorf("WebP stickers must be %dx%d, not %dx%d", imaging.StickerSide, imaging.StickerSide, w, h)
+		case len(data) > limit:
+			return nil, false, fmt.Errorf("sticker is larger than %d KB", limit>>10)
+		}
+		return data, animated, nil
+	}
+
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, false, err
+	}
+	canvas := imaging.StickerCanvas(img)
+
+	// Lossy WebP keeps photos sharp where the lossless encoder has to
+	// posterize them, so prefer ffmpeg's libwebp when it's there.
+	if ffmpeg.Available() {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, canvas); err != nil {
+			return nil, false, err
+		}
+		ctx, cancel := context.WithTimeout(ctx, stickerEncodeTimeout)
+		defer cancel()
+		for _, quality := range []int{80, 60, 40} {
+			out, err := ffmpeg.EncodeWebP(ctx, buf.Bytes(), quality)
+			if err != nil {
+				log.Println("Encoding sticker without ffmpeg:", err)
+				break
+			}
+			if len(out) <= imaging.MaxStickerBytes {
+				return out, false, nil
+			}
+		}
+	}
+	out, err := imaging.Sticker(canvas)
+	return out, false, err
+}
+
+// storedSticker builds a message resending a sticker already on WhatsApp's
+// servers, from the keys of a message that carried it.
+func (a *Api) storedSticker(stickerID string) (*waE2E.StickerMessage, error) {
+	if a.messageStore == nil {
+		return nil, fmt.Errorf("message store is not ready")
+	}
+	media, animated, err := a.messageStore.StickerMedia(stickerID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown sticker %s: %w", stickerID, err)
+	}
+	mimeType := media.GetMimetype()
+	if mimeType == "" {
+		mimeType = "image/webp"
+	}
+	msg := &waE2E.StickerMessage{
+		URL:           proto.String(media.GetURL()),
+		DirectPath:    proto.String(media.GetDirectPath()),
+		MediaKey:      media.GetMediaKey(),
+		FileSHA256:    media.GetFileSHA256(),
+		FileEncSHA256: media.GetFileEncSHA256(),
+		Mimetype:      &mimeType,
+		IsAnimated:    proto.Bool(animated),
+	}
+	if w, h := media.GetDimensions(); w > 0 && h > 0 {
+		msg.Width, msg.Height = proto.Uint32(uint32(w)), proto.Uint32(uint32(h))
+	}
+	if n := media.GetFileLength(); n > 0 {
+		msg.FileLength = proto.Uint64(n)
+	}
+	return msg, nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadStickerPacks(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"cats/a.webp", "cats/b.png", "cats/notes.txt", "empty/readme", ".hidden/x.webp"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "loose.webp"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	packs, err := loadStickerPacks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) != 1 || packs[0].Name != "cats" || len(packs[0].Stickers) != 2 || packs[0].Stickers[1].Name != "b" {
+		t.Fatalf("packs = %+v", packs)
+	}
+
+	if packs, err := loadStickerPacks(filepath.Join(dir, "missing")); err != nil || packs != nil {
+		t.Fatalf("missing dir = %v, %v", packs, err)
+	}
+}
+
+func TestPrepareStickerChecksWebPSize(t *testing.T) {
+	// A 100x100 VP8L header: stickers must be 512x512.
+	webp := []byte("RIFF\x16\x00\x00\x00WEBPVP8L\x0a\x00\x00\x00\x2f\x63\xc0\x18\x00\x00\x00\x00\x00\x00")
+	if _, _, err := prepareSticker(context.Background(), webp); err == nil || !strings.Contains(err.Error(), "512x512") {
+		t.Fatalf("err = %v, want a size error", err)
+	}
+}
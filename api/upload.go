@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// LocalFile describes a file on disk the user picked or dropped, for the
+// composer to preview before sending it with MessageContent.FilePath.
+type LocalFile struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Mimetype string `json:"mimetype"`
+	// Type is the MessageContent.Type the file is sent as by default.
+	Type string `json:"type"`
+}
+
+// UploadProgress is the payload of wa:upload_progress. An upload first
+// encrypts the file into a temporary file, then sends that.
+type UploadProgress struct {
+	ClientTempID string `json:"clientTempId"`
+	ChatJID      string `json:"chatId"`
+	Phase        string `json:"phase"` // "encrypting" or "uploading"
+	Done         int64  `json:"done"`
+	Total        int64  `json:"total"`
+}
+
+func localFile(path string) (LocalFile, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return LocalFile{}, err
+	}
+	if !st.Mode().IsRegular() {
+		return LocalFile{}, fmt.Errorf("%s is not a file", path)
+	}
+	mimeType := mimeTypeOf(path)
+	msgType := "document"
+	switch {
+	case strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml":
+		msgType = "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		msgType = "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		msgType = "audio"
+	}
+	return LocalFile{
+		Path:     path,
+		Name:     filepath.Base(path),
+		Size:     st.Size(),
+		Mimetype: mimeType,
+		Type:     msgType,
+	}, nil
+}
+
+// mediaMimeTypes are the MIME types of common media extensions. Go only
+// knows a few of them without the system's MIME database, and systems
+// disagree on some (.ogg is video/ogg on many).
+var mediaMimeTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".3gp":  "video/3gpp",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".amr":  "audio/amr",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+	".pdf":  "application/pdf",
+}
+
+// mimeTypeOf guesses a file's MIME type from its extension, without
+// parameters such as charset.
+func mimeTypeOf(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if mimeType, ok := mediaMimeTypes[ext]; ok {
+		return mimeType
+	}
+	mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext))
+	return mimeType
+}
+
+func localFiles(paths []string) []LocalFile {
+	files := make([]LocalFile, 0, len(paths))
+	for _, p := range paths {
+		if f, err := localFile(p); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// SelectFilesToSend lets the user pick files to attach. It returns nothing
+// when cancelled.
+func (a *Api) SelectFilesToSend() ([]LocalFile, error) {
+	homeDir, _ := os.UserHomeDir()
+	paths, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		DefaultDirectory: homeDir,
+		Title:            "Attach files",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return localFiles(paths), nil
+}
+
+// onFileDrop forwards files dropped on the window as wa:files_dropped.
+func (a *Api) onFileDrop(x, y int, paths []string) {
+	runtime.EventsEmit(a.ctx, "wa:files_dropped", map[string]any{
+		"x":     x,
+		"y":     y,
+		"files": localFiles(paths),
+	})
+}
+
+// CancelUpload stops the upload of the message sent with clientTempID. The
+// SendMessage call then fails. It reports whether an upload was running.
+func (a *Api) CancelUpload(clientTempID string) bool {
+	cancel, ok := a.uploads.LoadAndDelete(clientTempID)
+	if ok {
+		cancel.(context.CancelFunc)()
+	}
+	return ok
+}
+
+// uploadContext returns the context the media of content is uploaded
+// under, registered for CancelUpload when the message has a client ID.
+func (a *Api) uploadContext(content MessageContent) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	if content.ClientTempID == "" {
+		return ctx, cancel
+	}
+	a.uploads.Store(content.ClientTempID, cancel)
+	return ctx, func() {
+		a.uploads.CompareAndDelete(content.ClientTempID, cancel)
+		cancel()
+	}
+}
+
+// uploadMedia encrypts and uploads the media of content: streamed from
+// content.FilePath when set, otherwise decoded from content.Base64Data.
+func (a *Api) uploadMedia(ctx context.Context, chat types.JID, content MessageContent, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	if content.FilePath == "" {
+		data, err := base64.StdEncoding.DecodeString(content.Base64Data)
+		if err != nil {
+			return whatsmeow.UploadResponse{}, fmt.Errorf("failed to decode base64 %s data: %v", content.Type, err)
+		}
+		return a.waClient.Upload(ctx, data, mediaType)
+	}
+
+	f, err := os.Open(content.FilePath)
+	if err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	return a.uploadReader(ctx, chat, content.ClientTempID, f, st.Size(), mediaType)
+}
+
+// uploadReader encrypts size bytes from src into a temporary file and
+// uploads that, reporting wa:upload_progress along the way.
+func (a *Api) uploadReader(ctx context.Context, chat types.JID, clientTempID string, src io.Reader, size int64, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	tmp, err := os.CreateTemp("", "whats4linux-upload-*")
+	if err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	progress := &uploadReporter{emit: func(p UploadProgress) {
+		p.ClientTempID = clientTempID
+		p.ChatJID = chat.String()
+		runtime.EventsEmit(a.ctx, "wa:upload_progress", p)
+	}}
+	counted := &countingReader{r: src, onRead: func(done int64) {
+		progress.report("encrypting", done, size)
+	}}
+	resp, err := a.waClient.UploadReader(ctx, counted, &uploadTempFile{f: tmp, progress: progress}, mediaType)
+	if err != nil && ctx.Err() != nil {
+		return resp, errors.New("upload cancelled")
+	}
+	return resp, err
+}
+
+// uploadReporter emits upload progress once per percent and phase.
+type uploadReporter struct {
+	emit    func(UploadProgress)
+	phase   string
+	percent int64
+}
+
+func (r *uploadReporter) report(phase string, done, total int64) {
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	if phase == r.phase && percent == r.percent {
+		return
+	}
+	r.phase, r.percent = phase, percent
+	r.emit(UploadProgress{Phase: phase, Done: done, Total: total})
+}
+
+type countingReader struct {
+	r      io.Reader
+	done   int64
+	onRead func(done int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.done += int64(n)
+	c.onRead(c.done)
+	return n, err
+}
+
+// uploadTempFile holds the encrypted file. whatsmeow writes it while
+// encrypting and reads it back while uploading, so reads are upload
+// progress. It deliberately exposes only Read, Write and Seek, so copies
+// can't bypass the counting through os.File's ReadFrom/WriteTo.
+type uploadTempFile struct {
+	f        *os.File
+	written  int64
+	read     int64
+	progress *uploadReporter
+}
+
+func (t *uploadTempFile) Write(p []byte) (int, error) {
+	n, err := t.f.Write(p)
+	t.written += int64(n)
+	return n, err
+}
+
+func (t *uploadTempFile) Read(p []byte) (int, error) {
+	n, err := t.f.Read(p)
+	t.read += int64(n)
+	t.progress.report("uploading", t.read, t.written)
+	return n, err
+}
+
+func (t *uploadTempFile) Seek(offset int64, whence int) (int64, error) {
+	return t.f.Seek(offset, whence)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadProgressPhases(t *testing.T) {
+	var got []UploadProgress
+	progress := &uploadReporter{emit: func(p UploadProgress) { got = append(got, p) }}
+
+	tmp, err := os.CreateTemp(t.TempDir(), "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	tf := &uploadTempFile{f: tmp, progress: progress}
+
+	// Encrypting: the plaintext is read in small chunks and written out.
+	data := bytes.Repeat([]byte{1}, 1000)
+	src := &countingReader{r: bytes.NewReader(data), onRead: func(done int64) {
+		progress.report("encrypting", done, int64(len(data)))
+	}}
+	if _, err := io.CopyBuffer(tf, src, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	encrypting := len(got)
+	// 0%..100%, once each, despite 200 reads.
+	if encrypting != 101 {
+		t.Fatalf("encrypting updates = %d, want 101", encrypting)
+	}
+
+	// Uploading: the temporary file is read back.
+	if _, err := tf.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	for {
+		if _, err := tf.Read(buf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := got[len(got)-1]
+	if last.Phase != "uploading" || last.Done != 1000 || last.Total != 1000 {
+		t.Fatalf("last progress = %+v, want uploading 1000/1000", last)
+	}
+	if n := len(got) - encrypting; n != 10 {
+		t.Fatalf("uploading updates = %d, want 10", n)
+	}
+}
+
+func TestLocalFileType(t *testing.T) {
+	dir := t.TempDir()
+	for name, want := range map[string]string{
+		"photo.JPG":  "image",
+		"clip.mp4":   "video",
+		"voice.ogg":  "audio",
+		"song.MP3":   "audio",
+		"clip.mkv":   "video",
+		"report.pdf": "document",
+		"logo.svg":   "document",
+		"noext":      "document",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := localFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type != want || f.Name != name || f.Size != 1 {
+			t.Errorf("localFile(%s) = %+v, want type %s", name, f, want)
+		}
+	}
+	if _, err := localFile(dir); err == nil {
+		t.Error("localFile accepted a directory")
+	}
+}
@@ -2,9 +2,15 @@ package api
 
 import (
 	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/lugvitc/whats4linux/internal/imaging"
 	"github.com/nyaruka/phonenumbers"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
 	"go.mau.fi/whatsmeow/types"
 )
 
@@ -65,3 +71,97 @@ func (a *Api) GetProfile(jidStr string) (Contact, error) {
 		AvatarURL:  avatarURL,
 	}, nil
 }
+
+// WhatsApp limits for profile fields and pictures.
+const (
+	maxPushNameLength      = 25
+	maxStatusMessageLength = 139
+	profilePictureSize     = 640
+	profilePictureQuality  = 85
+)
+
+// SetPushName changes the display name other users see. It is synced to the
+// other linked devices through app state.
+func (a *Api) SetPushName(name string) error {
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("not logged in")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > maxPushNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxPushNameLength)
+	}
+	if err := a.waClient.SendAppState(a.ctx, appstate.BuildSettingPushName(name)); err != nil {
+		return fmt.Errorf("failed to update name: %w", err)
+	}
+	a.waClient.Store.PushName = name
+	if err := a.waClient.Store.Save(a.ctx); err != nil {
+		log.Println("SetPushName: failed to persist device store:", err)
+	}
+	// Presence updates carry the push name, so contacts pick it up quickly.
+	if err := a.waClient.SendPresence(a.ctx, types.PresenceAvailable); err != nil {
+		log.Println("SetPushName: failed to send presence:", err)
+	}
+	return nil
+}
+
+// SetStatusMessage changes the "About" text of the profile.
+func (a *Api) SetStatusMessage(text string) error {
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("not logged in")
+	}
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxStatusMessageLength {
+		return fmt.Errorf("about text is longer than %d characters", maxStatusMessageLength)
+	}
+	if err := a.waClient.SetStatusMessage(a.ctx, text); err != nil {
+		return fmt.Errorf("failed to update about text: %w", err)
+	}
+	return nil
+}
+
+// setPicture uploads (or, with nil avatar, removes) the picture of target and
+// drops the stale cached avatar. An empty target means our own profile.
+func (a *Api) setPicture(target types.JID, avatar []byte) error {
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("not logged in")
+	}
+	if avatar != nil {
+		var err error
+		avatar, err = imaging.SquareJPEG(avatar, profilePictureSize, profilePictureQuality)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := a.waClient.SetGroupPhoto(a.ctx, target, avatar); err != nil {
+		return fmt.Errorf("failed to update picture: %w", err)
+	}
+
+	cacheJID := target
+	if target.IsEmpty() {
+		cacheJID = canonicalUserJID(a.ctx, a.waClient, a.waClient.Store.ID.ToNonAD())
+	}
+	if a.mediaCache != nil {
+		if err := a.mediaCache.DeleteAvatar(cacheJID.String()); err != nil {
+			log.Println("failed to invalidate cached avatar:", cacheJID.String(), err)
+		}
+	}
+	runtime.EventsEmit(a.ctx, "wa:picture_update", cacheJID.String())
+	return nil
+}
+
+// SetProfilePicture crops and scales imageBytes (JPEG, PNG or GIF) to a
+// square JPEG and sets it as our profile picture.
+func (a *Api) SetProfilePicture(imageBytes []byte) error {
+	if len(imageBytes) == 0 {
+		return fmt.Errorf("no image given")
+	}
+	return a.setPicture(types.EmptyJID, imageBytes)
+}
+
+// RemoveProfilePicture removes our profile picture.
+func (a *Api) RemoveProfilePicture() error {
+	return a.setPicture(types.EmptyJID, nil)
+}
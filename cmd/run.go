@@ -33,7 +33,7 @@ func run(assets fs.FS) cli.ActionFunc {
 			Height: 768,
 			AssetServer: &assetserver.Options{
 				Assets:  assets,
-				Handler: server.NewAssetFileServer(),
+				Handler: server.NewAssetFileServer(apiPkg.NewMediaSource(api)),
 			},
 			BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 			OnStartup:        api.Startup,
@@ -45,6 +45,11 @@ func run(assets fs.FS) cli.ActionFunc {
 			Bind: []any{
 				api,
 			},
+			// Dropped files arrive as paths (wa:files_dropped), so they can be
+			// sent from disk instead of read into the webview.
+			DragAndDrop: &options.DragAndDrop{
+				EnableFileDrop: true,
+			},
 			Linux: &linux.Options{
 				WindowIsTranslucent: false,
 				// Software rendering avoids WebKitGTK GPU-process crashes across
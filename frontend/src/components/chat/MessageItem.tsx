@@ -1,7 +1,7 @@
 import React, { useState, useEffect, useMemo, lazy, Suspense } from "react"
 import { store } from "../../../wailsjs/go/models"
 import {
-  DownloadImageToFile,
+  SaveMedia,
   GetCachedAvatar,
   SendReaction,
   SetMessagePinned,
@@ -121,9 +121,9 @@ export function MessageItem({
     return <div className="mt-1" dangerouslySetInnerHTML={{ __html: caption }} />
   }
 
-  const handleImageDownload = async () => {
+  const handleSaveMedia = async () => {
     try {
-      await DownloadImageToFile(message.Info.ID)
+      await SaveMedia(chatId, message.Info.ID, "")
     } catch (e) {}
   }
 
@@ -244,7 +244,7 @@ export function MessageItem({
             type="image"
             chatId={chatId}
             sentMediaCache={sentMediaCache}
-            onDownload={handleImageDownload}
+            onDownload={handleSaveMedia}
           />
           {renderCaption(content.imageMessage.caption)}
         </div>
@@ -296,7 +296,7 @@ export function MessageItem({
               </div>
             </div>
             <button
-              onClick={handleImageDownload}
+              onClick={handleSaveMedia}
               className="p-2 border border-gray-300 dark:border-gray-600 rounded-full"
             >
               <svg
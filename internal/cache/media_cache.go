@@ -0,0 +1,573 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	query "github.com/lugvitc/whats4linux/internal/query"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Kind is a class of cached media with its own size quota.
+type Kind string
+
+const (
+	KindImage    Kind = "image"
+	KindVideo    Kind = "video"
+	KindAudio    Kind = "audio"
+	KindDocument Kind = "document"
+	KindSticker  Kind = "sticker"
+	KindAvatar   Kind = "avatar"
+)
+
+// Kinds lists every kind of cached media.
+var Kinds = []Kind{KindImage, KindVideo, KindAudio, KindDocument, KindSticker, KindAvatar}
+
+// DefaultQuotas are the per-kind cache sizes, in bytes, used for kinds
+// without a configured quota.
+var DefaultQuotas = map[Kind]int64{
+	KindImage:    512 << 20,
+	KindVideo:    1 << 30,
+	KindAudio:    256 << 20,
+	KindDocument: 512 << 20,
+	KindSticker:  64 << 20,
+	KindAvatar:   64 << 20,
+}
+
+// MediaCache keeps downloaded media on disk, indexed by message ID. Each
+// kind is kept under its quota by evicting the least recently used files.
+type MediaCache struct {
+	db *sql.DB
+	// dir holds the files, named by content hash. It is called "images"
+	// because that was all the cache once held.
+	dir      string
+	getStmt  *sql.Stmt // Prepared statement for single entry retrieval
+	saveStmt *sql.Stmt // Prepared statement for saving entries
+	mu       sync.Mutex
+	quotas   map[Kind]int64
+
+	// partials are the downloads in progress, by message ID.
+	pmu      sync.Mutex
+	partials map[string]*Partial
+}
+
+type MediaMeta struct {
+	MessageID  string
+	SHA256     string
+	Mime       string
+	Kind       Kind
+	Width      int
+	Height     int
+	Size       int64
+	CreatedAt  int64
+	LastAccess int64
+}
+
+// NewMediaCache opens the media cache with the given per-kind quotas in
+// bytes; kinds missing from quotas use DefaultQuotas.
+func NewMediaCache(quotas map[Kind]int64) (*MediaCache, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache directory: %v", err)
+	}
+
+	baseDir := filepath.Join(cacheDir, "whats4linux")
+	mediaDir := filepath.Join(baseDir, "images")
+	if err := os.MkdirAll(mediaDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %v", err)
+	}
+
+	mc, err := openMediaCache(mediaDir, filepath.Join(baseDir, "idxdb"), quotas)
+	if err != nil {
+		return nil, err
+	}
+	if err := mc.evict(); err != nil {
+		log.Println("media cache eviction failed:", err)
+	}
+	return mc, nil
+}
+
+func openMediaCache(dir, dbPath string, quotas map[Kind]int64) (*MediaCache, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	mc := &MediaCache{db: db, dir: dir, quotas: withDefaultQuotas(quotas)}
+	// Downloads left over from the last run can't be resumed.
+	if err := os.RemoveAll(mc.partialDir()); err != nil {
+		log.Println("failed to remove partial downloads:", err)
+	}
+	if err := os.MkdirAll(mc.partialDir(), 0755); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create partial download directory: %v", err)
+	}
+	if err := mc.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %v", err)
+	}
+
+	mc.getStmt, err = db.Prepare(query.GetImageByID)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare get statement: %v", err)
+	}
+	mc.saveStmt, err = db.Prepare(query.SaveImageIndex)
+	if err != nil {
+		mc.getStmt.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare save statement: %v", err)
+	}
+	return mc, nil
+}
+
+// migrate creates the index, upgrading an image-only one: avatars get
+// their own kind, last access starts at the creation time and file sizes
+// are read from disk.
+func (mc *MediaCache) migrate() error {
+	if _, err := mc.db.Exec(query.CreateImageIndexTable); err != nil {
+		return err
+	}
+	added := false
+	for _, q := range []string{query.AddImageIndexKind, query.AddImageIndexSize, query.AddImageIndexLastAccess} {
+		_, err := mc.db.Exec(q)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return err
+		}
+		added = added || err == nil
+	}
+	if _, err := mc.db.Exec(query.CreateImageIndexKindIndex); err != nil {
+		return err
+	}
+	if !added {
+		return nil
+	}
+	if _, err := mc.db.Exec(query.BackfillAvatarKind); err != nil {
+		return err
+	}
+	if _, err := mc.db.Exec(query.BackfillLastAccess); err != nil {
+		return err
+	}
+
+	rows, err := mc.db.Query(query.SelectUnsizedFiles)
+	if err != nil {
+		return err
+	}
+	type file struct{ sha, mime string }
+	var files []file
+	for rows.Next() {
+		var f file
+		var mimeType sql.NullString
+		if err := rows.Scan(&f.sha, &mimeType); err != nil {
+			rows.Close()
+			return err
+		}
+		f.mime = mimeType.String
+		files = append(files, f)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if info, err := os.Stat(filepath.Join(mc.dir, f.sha+mimeToExt(f.mime))); err == nil {
+			if _, err := mc.db.Exec(query.UpdateFileSize, info.Size(), f.sha, f.mime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func withDefaultQuotas(quotas map[Kind]int64) map[Kind]int64 {
+	out := make(map[Kind]int64, len(DefaultQuotas))
+	for kind, quota := range DefaultQuotas {
+		out[kind] = quota
+	}
+	for kind, quota := range quotas {
+		if _, ok := out[kind]; ok && quota >= 0 {
+			out[kind] = quota
+		}
+	}
+	return out
+}
+
+// Quotas returns the size limit of each kind, in bytes.
+func (mc *MediaCache) Quotas() map[Kind]int64 {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	out := make(map[Kind]int64, len(mc.quotas))
+	for kind, quota := range mc.quotas {
+		out[kind] = quota
+	}
+	return out
+}
+
+// SetQuotas changes the per-kind quotas (missing kinds go back to their
+// defaults) and evicts down to them.
+func (mc *MediaCache) SetQuotas(quotas map[Kind]int64) error {
+	mc.mu.Lock()
+	mc.quotas = withDefaultQuotas(quotas)
+	mc.mu.Unlock()
+	return mc.evict()
+}
+
+// Usage returns how many bytes each kind takes on disk.
+func (mc *MediaCache) Usage() (map[Kind]int64, error) {
+	usage := make(map[Kind]int64, len(Kinds))
+	for _, kind := range Kinds {
+		var n int64
+		if err := mc.db.QueryRow(query.SelectKindUsage, kind).Scan(&n); err != nil {
+			return nil, err
+		}
+		usage[kind] = n
+	}
+	return usage, nil
+}
+
+// Save stores media in the cache and indexes it under messageID.
+func (mc *MediaCache) Save(messageID string, kind Kind, data []byte, mime string, width, height int) (string, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	h := sha256.Sum256(data)
+	hashStr := hex.EncodeToString(h[:])
+
+	ext := mimeToExt(mime)
+	path := filepath.Join(mc.dir, hashStr+ext)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", fmt.Errorf("failed to write media file: %v", err)
+		}
+	}
+
+	now := time.Now().Unix()
+	_, err := mc.saveStmt.Exec(messageID, hashStr, mime, width, height, now, kind, len(data), now)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert media index: %v", err)
+	}
+	if err := mc.evictKindLocked(kind, messageID); err != nil {
+		log.Println("media cache eviction failed:", err)
+	}
+
+	return hashStr, nil
+}
+
+func (mc *MediaCache) evict() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for _, kind := range Kinds {
+		if err := mc.evictKindLocked(kind, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type evictionCandidate struct {
+	messageID string
+	sha256    string
+	mime      string
+	size      int64
+}
+
+// evictKindLocked drops the least recently used entries of kind until it
+// fits its quota, sparing keep, the entry just saved. A file is deleted
+// once no entry refers to it.
+func (mc *MediaCache) evictKindLocked(kind Kind, keep string) error {
+	maxBytes := mc.quotas[kind]
+	var total int64
+	if err := mc.db.QueryRow(query.SelectKindUsage, kind).Scan(&total); err != nil {
+		return err
+	}
+	if total <= maxBytes {
+		return nil
+	}
+
+	rows, err := mc.db.Query(query.SelectEvictionCandidates, kind)
+	if err != nil {
+		return err
+	}
+	var candidates []evictionCandidate
+	for rows.Next() {
+		var candidate evictionCandidate
+		var mimeType sql.NullString
+		if err := rows.Scan(&candidate.messageID, &candidate.sha256, &mimeType, &candidate.size); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		candidate.mime = mimeType.String
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, candidate := range candidates {
+		if total <= maxBytes {
+			break
+		}
+		if candidate.messageID == keep {
+			continue
+		}
+		removed, err := mc.deleteLocked(candidate.messageID, candidate.sha256, candidate.mime)
+		if err != nil {
+			return err
+		}
+		if removed {
+			total -= candidate.size
+		}
+	}
+	return nil
+}
+
+// deleteLocked removes an index entry, and its file when no other entry
+// shares it. It reports whether the file was removed.
+func (mc *MediaCache) deleteLocked(messageID, sha, mimeType string) (bool, error) {
+	if _, err := mc.db.Exec(query.DeleteImageIndex, messageID); err != nil {
+		return false, err
+	}
+	var references int
+	if err := mc.db.QueryRow(query.CountFileReferences, sha, mimeType).Scan(&references); err != nil {
+		return false, err
+	}
+	if references != 0 {
+		return false, nil
+	}
+	if err := os.Remove(filepath.Join(mc.dir, sha+mimeToExt(mimeType))); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// Get retrieves media metadata by message ID, or nil when it isn't cached.
+func (mc *MediaCache) Get(messageID string) (*MediaMeta, error) {
+	meta, err := scanMediaMeta(mc.getStmt.QueryRow(messageID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return meta, err
+}
+
+func scanMediaMeta(scanner interface{ Scan(dest ...any) error }) (*MediaMeta, error) {
+	var (
+		meta     MediaMeta
+		mimeType sql.NullString
+		width    sql.NullInt64
+		height   sql.NullInt64
+		created  sql.NullInt64
+	)
+	err := scanner.Scan(
+		&meta.MessageID,
+		&meta.SHA256,
+		&mimeType,
+		&width,
+		&height,
+		&created,
+		&meta.Kind,
+		&meta.Size,
+		&meta.LastAccess,
+	)
+	if err != nil {
+		return nil, err
+	}
+	meta.Mime = mimeType.String
+	meta.Width, meta.Height = int(width.Int64), int(height.Int64)
+	meta.CreatedAt = created.Int64
+	return &meta, nil
+}
+
+func idPlaceholders(messageIDs []string) (string, []any) {
+	placeholders := make([]string, len(messageIDs))
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ",") + ")", args
+}
+
+// GetMany retrieves the metadata of several messages' media (batch).
+// Uncached messages are left out.
+func (mc *MediaCache) GetMany(messageIDs []string) (map[string]*MediaMeta, error) {
+	if len(messageIDs) == 0 {
+		return make(map[string]*MediaMeta), nil
+	}
+
+	list, args := idPlaceholders(messageIDs)
+	rows, err := mc.db.Query(query.GetImagesByIDsPrefix+list, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]*MediaMeta, len(messageIDs))
+	for rows.Next() {
+		meta, err := scanMediaMeta(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[meta.MessageID] = meta
+	}
+	return result, rows.Err()
+}
+
+// Touch marks messages' media as just used, so eviction keeps it longer.
+func (mc *MediaCache) Touch(messageIDs ...string) {
+	if len(messageIDs) == 0 {
+		return
+	}
+	list, args := idPlaceholders(messageIDs)
+	args = append([]any{time.Now().Unix()}, args...)
+	if _, err := mc.db.Exec(query.TouchImagesByIDsPrefix+list, args...); err != nil {
+		log.Println("media cache touch failed:", err)
+	}
+}
+
+// FileName returns the name of a message's cached file in the cache
+// directory.
+func (mc *MediaCache) FileName(messageID string) (string, error) {
+	meta, err := mc.Get(messageID)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		return "", fmt.Errorf("media not found for message ID: %s", messageID)
+	}
+
+	return meta.SHA256 + mimeToExt(meta.Mime), nil
+}
+
+// Read reads a message's cached media and marks it as used.
+func (mc *MediaCache) Read(messageID string) ([]byte, string, error) {
+	meta, err := mc.Get(messageID)
+	if err != nil {
+		return nil, "", err
+	}
+	if meta == nil {
+		return nil, "", fmt.Errorf("media not found for message ID: %s", messageID)
+	}
+
+	path := filepath.Join(mc.dir, meta.SHA256+mimeToExt(meta.Mime))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read media file: %v", err)
+	}
+	mc.Touch(messageID)
+
+	return data, meta.Mime, nil
+}
+
+// SaveAvatar saves an avatar image to cache using JID as the key
+func (mc *MediaCache) SaveAvatar(jid string, data []byte, mime string) (string, error) {
+	avatarKey := "avatar_" + jid
+	return mc.Save(avatarKey, KindAvatar, data, mime, 0, 0)
+}
+
+// DeleteAvatar deletes an avatar image from cache by JID
+func (mc *MediaCache) DeleteAvatar(jid string) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	avatarKey := "avatar_" + jid
+	meta, err := mc.Get(avatarKey)
+	if err != nil || meta == nil {
+		return err
+	}
+	if _, err := mc.deleteLocked(avatarKey, meta.SHA256, meta.Mime); err != nil {
+		return fmt.Errorf("failed to delete avatar: %v", err)
+	}
+	return nil
+}
+
+// GetAvatarFileName returns the cached file name of an avatar by JID
+func (mc *MediaCache) GetAvatarFileName(jid string) (string, error) {
+	avatarKey := "avatar_" + jid
+	return mc.FileName(avatarKey)
+}
+
+// ReadAvatarByJID reads an avatar image by JID
+func (mc *MediaCache) ReadAvatarByJID(jid string) ([]byte, string, error) {
+	avatarKey := "avatar_" + jid
+	return mc.Read(avatarKey)
+}
+
+// Clear deletes every cached file and its index entry. Downloads in
+// progress aren't touched; cancel them first.
+func (mc *MediaCache) Clear() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if _, err := mc.db.Exec(query.DeleteAllImageIndex); err != nil {
+		return fmt.Errorf("failed to clear media index: %v", err)
+	}
+	entries, err := os.ReadDir(mc.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list media files: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mc.dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database connection and prepared statements
+func (mc *MediaCache) Close() error {
+	if mc.getStmt != nil {
+		mc.getStmt.Close()
+	}
+	if mc.saveStmt != nil {
+		mc.saveStmt.Close()
+	}
+	return mc.db.Close()
+}
+
+// mimeToExt names cached files. Images the cache doesn't recognise keep
+// the ".jpg" they were always saved with, so existing entries still resolve.
+func mimeToExt(mimeType string) string {
+	mimeType, _, _ = mime.ParseMediaType(mimeType)
+	switch mimeType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "video/mp4":
+		return ".mp4"
+	case "video/webm":
+		return ".webm"
+	case "video/3gpp":
+		return ".3gp"
+	case "video/quicktime":
+		return ".mov"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/m4a":
+		return ".m4a"
+	case "audio/aac":
+		return ".aac"
+	case "audio/amr":
+		return ".amr"
+	case "application/pdf":
+		return ".pdf"
+	}
+	if mimeType == "" || strings.HasPrefix(mimeType, "image/") {
+		return ".jpg"
+	}
+	return ".bin"
+}
@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestMediaCache(t *testing.T, quotas map[Kind]int64) (*MediaCache, string) {
+	t.Helper()
+	dir := t.TempDir()
+	mc, err := openMediaCache(dir, filepath.Join(dir, "index.db"), quotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = mc.Close() })
+	return mc, dir
+}
+
+func TestMediaCacheEvictsOldFilesToSizeLimit(t *testing.T) {
+	mc, dir := newTestMediaCache(t, nil)
+
+	hash, err := mc.Save("message", KindImage, []byte("cached image"), "image/png", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, hash+".png")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := mc.SetQuotas(map[Kind]int64{KindImage: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("cached file still exists after eviction: %v", err)
+	}
+	meta, err := mc.Get("message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta != nil {
+		t.Fatal("cache index still contains evicted image")
+	}
+}
+
+func TestMediaCacheEvictsLeastRecentlyUsedPerKind(t *testing.T) {
+	mc, _ := newTestMediaCache(t, map[Kind]int64{KindVideo: 20})
+	save := func(id string, kind Kind, data string, accessed int64) {
+		t.Helper()
+		if _, err := mc.Save(id, kind, []byte(data), "video/mp4", 0, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mc.db.Exec(`UPDATE image_index SET last_access = ? WHERE message_id = ?`, accessed, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("old", KindVideo, "0123456789", 1)
+	save("newer", KindVideo, "abcdefghij", 2)
+	// A copy of a cached file doesn't count twice.
+	save("copy", KindVideo, "abcdefghij", 3)
+	// Other kinds have their own quota.
+	save("doc", KindDocument, "a document bigger than the video quota", 1)
+
+	// Reading the oldest makes it the most recently used.
+	if _, _, err := mc.Read("old"); err != nil {
+		t.Fatal(err)
+	}
+	save("new", KindVideo, "ABCDEFGHIJ", 4)
+
+	for id, want := range map[string]bool{"old": true, "newer": false, "copy": false, "new": true, "doc": true} {
+		meta, err := mc.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (meta != nil) != want {
+			t.Errorf("%s cached = %v, want %v", id, meta != nil, want)
+		}
+	}
+	usage, err := mc.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage[KindVideo] != 20 || usage[KindDocument] != 38 {
+		t.Fatalf("usage = %v", usage)
+	}
+}
+
+func TestMediaCacheMigratesImageIndex(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "index.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The image-only schema.
+	if _, err := db.Exec(`CREATE TABLE image_index (
+		message_id TEXT PRIMARY KEY, sha256 TEXT NOT NULL, mime TEXT,
+		width INTEGER, height INTEGER, created_at INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO image_index VALUES ('m', 'aa', 'image/jpeg', 1, 1, 7), ('avatar_1@s.whatsapp.net', 'bb', 'image/jpeg', 1, 1, 8)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := os.WriteFile(filepath.Join(dir, "aa.jpg"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mc, err := openMediaCache(dir, dbPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mc.Close()
+	image, _ := mc.Get("m")
+	avatar, _ := mc.Get("avatar_1@s.whatsapp.net")
+	if image == nil || image.Kind != KindImage || image.Size != 5 || image.LastAccess != 7 {
+		t.Fatalf("image = %+v", image)
+	}
+	if avatar == nil || avatar.Kind != KindAvatar {
+		t.Fatalf("avatar = %+v", avatar)
+	}
+}
+
+func TestPartialDownloadIsReadableWhileGrowing(t *testing.T) {
+	mc, _ := newTestMediaCache(t, nil)
+	p, started, err := mc.StartDownload("video", KindVideo, "video/mp4", 0, 0, 10)
+	if err != nil || !started {
+		t.Fatal(started, err)
+	}
+	if again, started, _ := mc.StartDownload("video", KindVideo, "video/mp4", 0, 0, 10); again != p || started {
+		t.Fatal("a second download of the same message was started")
+	}
+	r, err := p.NewReader(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if end, err := r.Seek(0, io.SeekEnd); err != nil || end != 10 {
+		t.Fatalf("Seek(End) = %d, %v", end, err)
+	}
+	r.Seek(0, io.SeekStart)
+
+	// A queued download holds no file until it starts.
+	if entries, _ := os.ReadDir(mc.partialDir()); len(entries) != 0 {
+		t.Fatalf("queued download created %d files", len(entries))
+	}
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+	p.Write([]byte("01234"))
+	buf := make([]byte, 10)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "01234" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+	// The reader waits for the rest.
+	go func() {
+		p.Write([]byte("56789"))
+		p.Finish(nil)
+	}()
+	rest, err := io.ReadAll(r)
+	if err != nil || string(rest) != "56789" {
+		t.Fatalf("ReadAll = %q, %v", rest, err)
+	}
+
+	if mc.Downloading("video") != nil {
+		t.Fatal("finished download is still in progress")
+	}
+	f, meta, err := mc.Open("video")
+	if err != nil || f == nil {
+		t.Fatal(f, err)
+	}
+	f.Close()
+	if meta.Kind != KindVideo || meta.Size != 10 {
+		t.Fatalf("meta = %+v", meta)
+	}
+}
+
+func TestFailedPartialDownloadFailsReaders(t *testing.T) {
+	mc, _ := newTestMediaCache(t, nil)
+	p, _, err := mc.StartDownload("audio", KindAudio, "audio/ogg", 0, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.NewReader(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(0, io.SeekEnd); err == nil {
+		t.Fatal("seeked to the end of media of unknown size")
+	}
+	failed := errors.New("download failed")
+	p.Finish(failed)
+	if _, err := r.Read(make([]byte, 1)); err != failed {
+		t.Fatalf("Read error = %v, want %v", err, failed)
+	}
+	if meta, _ := mc.Get("audio"); meta != nil {
+		t.Fatal("failed download was cached")
+	}
+}
+
+func TestMediaTooBigForItsQuotaIsReadButNotCached(t *testing.T) {
+	mc, _ := newTestMediaCache(t, map[Kind]int64{KindDocument: 8})
+	if _, err := mc.Save("small", KindDocument, []byte("tiny"), "application/pdf", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _, err := mc.StartDownload("big", KindDocument, "application/pdf", 0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Create(); err != nil {
+		t.Fatal(err)
+	}
+	p.Write([]byte("0123456789"))
+	if err := p.Finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.NewReader(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if data, err := io.ReadAll(r); err != nil || string(data) != "0123456789" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if meta, _ := mc.Get("big"); meta != nil {
+		t.Fatal("media over its quota was cached")
+	}
+	if meta, _ := mc.Get("small"); meta == nil {
+		t.Fatal("caching nothing evicted other media")
+	}
+}
+
+func TestEvictionSparesTheEntryJustSaved(t *testing.T) {
+	mc, _ := newTestMediaCache(t, map[Kind]int64{KindImage: 8})
+	if _, err := mc.Save("old", KindImage, []byte("1234"), "image/png", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Over the quota on its own; evicting everything else isn't enough.
+	if _, err := mc.Save("new", KindImage, []byte("123456789"), "image/png", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := mc.Get("new"); meta == nil {
+		t.Fatal("the entry just saved was evicted")
+	}
+	if meta, _ := mc.Get("old"); meta != nil {
+		t.Fatal("old entry kept over the quota")
+	}
+}
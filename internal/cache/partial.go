@@ -0,0 +1,362 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Partial is media being downloaded into the cache. Readers can follow the
+// file while it grows, so playback can start before the download is done.
+type Partial struct {
+	mc            *MediaCache
+	messageID     string
+	kind          Kind
+	mime          string
+	width, height int
+
+	mu sync.Mutex
+	// f is nil until Create.
+	f *os.File
+	// path moves from the partial directory into the cache on success.
+	path    string
+	size    int64
+	written int64
+	done    bool
+	err     error
+	// uncached is set when the media turned out too big for its quota. The
+	// file is deleted, but f stays open for readers until the Partial is
+	// garbage collected.
+	uncached bool
+	// changed is closed, and replaced, whenever more is written or the
+	// download ends.
+	changed chan struct{}
+}
+
+// partialDir holds downloads in progress. They don't survive a restart.
+func (mc *MediaCache) partialDir() string {
+	return filepath.Join(mc.dir, "partial")
+}
+
+// StartDownload returns the download in progress for messageID, or starts
+// one when there is none; started tells which. size is the expected
+// length, or -1 when unknown. Whoever started the download creates its file
+// with Create, fills it with Write and must end it with Finish.
+func (mc *MediaCache) StartDownload(messageID string, kind Kind, mime string, width, height int, size int64) (p *Partial, started bool, err error) {
+	mc.pmu.Lock()
+	defer mc.pmu.Unlock()
+	if p := mc.partials[messageID]; p != nil {
+		return p, false, nil
+	}
+
+	h := sha256.Sum256([]byte(messageID))
+	path := filepath.Join(mc.partialDir(), hex.EncodeToString(h[:]))
+	if size <= 0 {
+		size = -1
+	}
+	p = &Partial{
+		mc:        mc,
+		messageID: messageID,
+		kind:      kind,
+		mime:      mime,
+		width:     width,
+		height:    height,
+		path:      path,
+		size:      size,
+		changed:   make(chan struct{}),
+	}
+	if mc.partials == nil {
+		mc.partials = make(map[string]*Partial)
+	}
+	mc.partials[messageID] = p
+	return p, true, nil
+}
+
+// Downloading returns the download in progress for messageID, or nil.
+func (mc *MediaCache) Downloading(messageID string) *Partial {
+	mc.pmu.Lock()
+	defer mc.pmu.Unlock()
+	return mc.partials[messageID]
+}
+
+// notifyLocked wakes readers waiting for the file to change.
+func (p *Partial) notifyLocked() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Create creates the file the download is written to. It is left until the
+// download actually starts, so queued downloads hold no file open.
+func (p *Partial) Create() error {
+	f, err := os.OpenFile(p.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create partial media file: %v", err)
+	}
+	p.mu.Lock()
+	p.f = f
+	p.mu.Unlock()
+	return nil
+}
+
+// Write appends downloaded media. Create must have been called.
+func (p *Partial) Write(b []byte) (int, error) {
+	n, err := p.f.Write(b)
+	if n > 0 {
+		p.mu.Lock()
+		p.written += int64(n)
+		p.notifyLocked()
+		p.mu.Unlock()
+	}
+	return n, err
+}
+
+// Written is how much has been downloaded so far.
+func (p *Partial) Written() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.written
+}
+
+// Size is the full length of the media, or -1 while that isn't known.
+func (p *Partial) Size() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// Finish ends the download. Without an error the file joins the cache as
+// if it had been saved with Save; otherwise it is dropped and readers fail
+// with err. Media larger than its kind's whole quota isn't cached, but stays
+// readable through this Partial.
+func (p *Partial) Finish(err error) error {
+	cached := false
+	if err == nil {
+		cached, err = p.commit()
+	}
+	p.mu.Lock()
+	if err == nil && !cached {
+		p.uncached = true
+		os.Remove(p.path)
+	} else {
+		if p.f != nil {
+			p.f.Close()
+		}
+		if err != nil {
+			os.Remove(p.path)
+		}
+	}
+	p.mu.Unlock()
+
+	p.mc.pmu.Lock()
+	delete(p.mc.partials, p.messageID)
+	p.mc.pmu.Unlock()
+
+	p.mu.Lock()
+	p.done, p.err = true, err
+	if err == nil {
+		p.size = p.written
+	}
+	p.notifyLocked()
+	p.mu.Unlock()
+	return err
+}
+
+// commit moves the finished file into the cache and indexes it. It reports
+// false, leaving the file where it is, when the file exceeds its quota:
+// caching it would evict everything else of its kind first.
+func (p *Partial) commit() (bool, error) {
+	mc := p.mc
+	mc.mu.Lock()
+	quota := mc.quotas[p.kind]
+	mc.mu.Unlock()
+	size := p.Written()
+	if size > quota {
+		return false, nil
+	}
+	if p.f == nil {
+		return false, errors.New("partial media file was never created")
+	}
+
+	if _, err := p.f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, p.f); err != nil {
+		return false, fmt.Errorf("failed to hash media file: %v", err)
+	}
+	hashStr := hex.EncodeToString(h.Sum(nil))
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	// Readers opened from now on read the cached file.
+	path := filepath.Join(mc.dir, hashStr+mimeToExt(p.mime))
+	p.mu.Lock()
+	if _, err := os.Stat(path); err == nil {
+		os.Remove(p.path)
+	} else if err := os.Rename(p.path, path); err != nil {
+		p.mu.Unlock()
+		return false, fmt.Errorf("failed to move media file into the cache: %v", err)
+	}
+	p.path = path
+	p.mu.Unlock()
+
+	now := time.Now().Unix()
+	if _, err := mc.saveStmt.Exec(p.messageID, hashStr, p.mime, p.width, p.height, now, p.kind, size, now); err != nil {
+		return false, fmt.Errorf("failed to insert media index: %v", err)
+	}
+	if err := mc.evictKindLocked(p.kind, p.messageID); err != nil {
+		log.Println("media cache eviction failed:", err)
+	}
+	return true, nil
+}
+
+// Wait waits for the download to end and returns its error.
+func (p *Partial) Wait(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		done, err, changed := p.done, p.err, p.changed
+		p.mu.Unlock()
+		if done {
+			return err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// NewReader reads the media from the start, waiting for bytes that haven't
+// been downloaded yet until ctx is done.
+func (p *Partial) NewReader(ctx context.Context) (io.ReadSeekCloser, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done && p.err != nil {
+		return nil, p.err
+	}
+	r := &partialReader{p: p, ctx: ctx}
+	// A queued download has no file yet; it is opened on the first read.
+	if p.f != nil {
+		if err := r.openLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+type partialReader struct {
+	p   *Partial
+	ctx context.Context
+	f   *os.File
+	pos int64
+	// shared is set when f is the Partial's own file, which stays open.
+	shared bool
+}
+
+// openLocked opens the file r reads. Must be called with r.p.mu held.
+func (r *partialReader) openLocked() error {
+	if r.p.uncached {
+		r.f, r.shared = r.p.f, true
+		return nil
+	}
+	f, err := os.Open(r.p.path)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	return nil
+}
+
+func (r *partialReader) Read(b []byte) (int, error) {
+	for {
+		r.p.mu.Lock()
+		written, done, err, changed := r.p.written, r.p.done, r.p.err, r.p.changed
+		if r.f == nil && r.pos < written {
+			if err := r.openLocked(); err != nil {
+				r.p.mu.Unlock()
+				return 0, err
+			}
+		}
+		r.p.mu.Unlock()
+
+		if r.pos < written {
+			if avail := written - r.pos; int64(len(b)) > avail {
+				b = b[:avail]
+			}
+			n, err := r.f.ReadAt(b, r.pos)
+			r.pos += int64(n)
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+		if done {
+			if err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		select {
+		case <-changed:
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+	}
+}
+
+// Seek can't seek from the end until the size is known.
+func (r *partialReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		size := r.p.Size()
+		if size < 0 {
+			return 0, errors.New("media size is not known yet")
+		}
+		offset += size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *partialReader) Close() error {
+	if r.shared || r.f == nil {
+		return nil
+	}
+	return r.f.Close()
+}
+
+// Open opens a message's cached media and marks it as used. It returns a
+// nil file when the media isn't cached.
+func (mc *MediaCache) Open(messageID string) (*os.File, *MediaMeta, error) {
+	meta, err := mc.Get(messageID)
+	if err != nil || meta == nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(filepath.Join(mc.dir, meta.SHA256+mimeToExt(meta.Mime)))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open media file: %v", err)
+	}
+	mc.Touch(messageID)
+	return f, meta, nil
+}
@@ -0,0 +1,115 @@
+// Package ffmpeg runs the ffmpeg binary, when it is installed, for the
+// video work the standard library can't do. Callers treat ErrNotInstalled as
+// "do without".
+package ffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNotInstalled is returned when no ffmpeg binary is on PATH.
+var ErrNotInstalled = errors.New("ffmpeg is not installed")
+
+var lookPath = sync.OnceValues(func() (string, error) {
+	return exec.LookPath("ffmpeg")
+})
+
+// Available reports whether ffmpeg can be run.
+func Available() bool {
+	_, err := lookPath()
+	return err == nil
+}
+
+// Video is what Probe learns about a video file.
+type Video struct {
+	Duration time.Duration
+	// Poster is the first frame as a full-size JPEG, rotated the way the
+	// video is shown.
+	Poster []byte
+}
+
+// Probe reads a video's duration and first frame.
+func Probe(ctx context.Context, path string) (Video, error) {
+	bin, err := lookPath()
+	if err != nil {
+		return Video{}, ErrNotInstalled
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin,
+		"-hide_banner", "-nostdin",
+		"-i", path,
+		"-map", "0:v:0", "-frames:v", "1",
+		"-f", "image2pipe", "-c:v", "mjpeg", "-q:v", "3",
+		"pipe:1",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Video{}, fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		return Video{}, errors.New("ffmpeg produced no frame")
+	}
+	return Video{
+		Duration: parseDuration(stderr.Bytes()),
+		Poster:   stdout.Bytes(),
+	}, nil
+}
+
+// EncodeWebP converts an image (any format ffmpeg reads, usually PNG) to
+// a lossy WebP with libwebp at quality 0-100. ffmpeg builds without libwebp
+// fail here.
+func EncodeWebP(ctx context.Context, img []byte, quality int) ([]byte, error) {
+	bin, err := lookPath()
+	if err != nil {
+		return nil, ErrNotInstalled
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, bin,
+		"-hide_banner", "-nostdin",
+		"-f", "image2pipe", "-i", "pipe:0",
+		"-frames:v", "1",
+		"-c:v", "libwebp", "-quality", strconv.Itoa(quality),
+		"-f", "webp", "pipe:1",
+	)
+	cmd.Stdin = bytes.NewReader(img)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		return nil, errors.New("ffmpeg produced no image")
+	}
+	return stdout.Bytes(), nil
+}
+
+var durationRE = regexp.MustCompile(`Duration: (\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
+// parseDuration finds the container duration in ffmpeg's log, or returns 0.
+func parseDuration(log []byte) time.Duration {
+	m := durationRE.FindSubmatch(log)
+	if m == nil {
+		return 0
+	}
+	h, _ := strconv.Atoi(string(m[1]))
+	min, _ := strconv.Atoi(string(m[2]))
+	sec, _ := strconv.ParseFloat(string(m[3]), 64)
+	return time.Duration(h)*time.Hour + time.Duration(min)*time.Minute + time.Duration(sec*float64(time.Second))
+}
+
+func lastLine(b []byte) string {
+	b = bytes.TrimSpace(b)
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[i+1:]
+	}
+	return string(b)
+}
@@ -0,0 +1,17 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	log := []byte("Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'clip.mp4':\n" +
+		"  Duration: 00:01:05.50, start: 0.000000, bitrate: 1205 kb/s\n")
+	if got, want := parseDuration(log), time.Minute+5500*time.Millisecond; got != want {
+		t.Fatalf("parseDuration = %v, want %v", got, want)
+	}
+	if got := parseDuration([]byte("  Duration: N/A, bitrate: N/A")); got != 0 {
+		t.Fatalf("parseDuration(N/A) = %v, want 0", got)
+	}
+}
@@ -0,0 +1,241 @@
+// Package imaging holds the small amount of image processing the app needs
+// (cropping, scaling and JPEG re-encoding) using only the standard library.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+
+	// Registered for image.Decode.
+	_ "image/png"
+)
+
+// Decode decodes a JPEG, PNG or GIF image. GIFs yield their first frame.
+func Decode(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// toRGBA returns img as an *image.RGBA whose bounds start at the origin.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// CropSquare returns the centred square region of img.
+func CropSquare(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	rect := image.Rect(x0, y0, x0+side, y0+side)
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Rect, img, rect.Min, draw.Src)
+	return dst
+}
+
+// Resize scales img to w x h. Each destination pixel averages the source
+// pixels it covers, which gives clean downscales; upscaling falls back to
+// nearest-neighbour.
+func Resize(img image.Image, w, h int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := sy*src.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[off])
+					g += uint32(src.Pix[off+1])
+					b += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := y*dst.Stride + x*4
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG encodes img as a JPEG. Transparent areas are flattened onto
+// white, since JPEG has no alpha channel.
+func EncodeJPEG(img image.Image, quality int) ([]byte, error) {
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Rect, img, b.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// SquareJPEG centre-crops an encoded image to a square, scales it down to at
+// most size x size and re-encodes it as JPEG. Used for profile and group
+// pictures, which WhatsApp only accepts as square JPEGs.
+func SquareJPEG(data []byte, size, quality int) ([]byte, error) {
+	img, _, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	square := CropSquare(img)
+	side := min(square.Bounds().Dx(), size)
+	if side == 0 {
+		return nil, fmt.Errorf("image is empty")
+	}
+	return EncodeJPEG(Resize(square, side, side), quality)
+}
+
+// ThumbnailSize is the long edge of the JPEG thumbnails sent inline with
+// image and video messages, shown until the media is downloaded.
+const ThumbnailSize = 72
+
+// FitSize scales w x h down to fit within side x side, keeping the aspect
+// ratio. Sizes that already fit are returned unchanged.
+func FitSize(w, h, side int) (int, int) {
+	if w <= side && h <= side {
+		return w, h
+	}
+	if w >= h {
+		return side, max(1, h*side/w)
+	}
+	return max(1, w*side/h), side
+}
+
+// Thumbnail scales img down to ThumbnailSize on its long edge and encodes
+// it as a JPEG.
+func Thumbnail(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+	w, h := FitSize(b.Dx(), b.Dy(), ThumbnailSize)
+	return EncodeJPEG(Resize(img, w, h), 75)
+}
+
+// Profile is how PrepareOutgoing compresses an image: scaled down to
+// LongEdge on its longer side and re-encoded as JPEG at Quality. The zero
+// Profile sends the original with only its metadata stripped, as do all
+// profiles for animated or transparent images, which JPEG can't hold.
+type Profile struct {
+	LongEdge int
+	Quality  int
+}
+
+var (
+	// ProfileStandard matches what WhatsApp sends by default.
+	ProfileStandard = Profile{LongEdge: 1600, Quality: 80}
+	// ProfileHD matches WhatsApp's "HD quality" option.
+	ProfileHD = Profile{LongEdge: 4096, Quality: 90}
+)
+
+// Outgoing is an image prepared for sending.
+type Outgoing struct {
+	// Data is the image to upload: re-encoded, or the original with its
+	// metadata stripped.
+	Data []byte
+	// Mimetype is "image/jpeg" when Data was re-encoded, otherwise "".
+	Mimetype string
+	// Width and Height are the size as displayed, after EXIF orientation.
+	Width, Height int
+	Thumbnail     []byte
+}
+
+// PrepareOutgoing compresses an image according to p, strips its metadata
+// and measures and thumbnails it for an image message. Re-encoding applies
+// the EXIF orientation to the pixels, so the result is upright without it.
+func PrepareOutgoing(data []byte, p Profile) (Outgoing, error) {
+	stripped, orientation, err := StripMetadata(data)
+	if err != nil {
+		return Outgoing{}, err
+	}
+	img, format, err := Decode(stripped)
+	if err != nil {
+		return Outgoing{}, err
+	}
+	img = Orient(img, orientation)
+	out := Outgoing{
+		Data:   stripped,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+
+	if p != (Profile{}) && !animated(format, stripped) && opaque(img) {
+		w, h := FitSize(out.Width, out.Height, p.LongEdge)
+		resized := w != out.Width || h != out.Height
+		scaled := img
+		if resized {
+			scaled = Resize(img, w, h)
+		}
+		encoded, err := EncodeJPEG(scaled, p.Quality)
+		if err != nil {
+			return Outgoing{}, err
+		}
+		// A JPEG that needs no scaling may already be smaller than what
+		// re-encoding gives; keep it then.
+		if resized || format != "jpeg" || len(encoded) < len(stripped) {
+			out.Data, out.Mimetype = encoded, "image/jpeg"
+			out.Width, out.Height = w, h
+		}
+	}
+
+	if out.Thumbnail, err = Thumbnail(img); err != nil {
+		return Outgoing{}, err
+	}
+	return out, nil
+}
+
+// animated reports whether data is a GIF with more than one frame.
+func animated(format string, data []byte) bool {
+	if format != "gif" {
+		return false
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	return err == nil && len(g.Image) > 1
+}
+
+// opaque reports whether img has no transparent pixels. Images that can't
+// tell are treated as transparent, so they are never flattened.
+func opaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
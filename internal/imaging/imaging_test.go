@@ -0,0 +1,288 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSquareJPEGCropsAndScalesDown(t *testing.T) {
+	for _, tc := range []struct {
+		w, h, size, want int
+	}{
+		{1000, 800, 640, 640},
+		{300, 200, 640, 200}, // never upscaled
+		{200, 300, 96, 96},
+	} {
+		out, err := SquareJPEG(encodePNG(t, tc.w, tc.h), tc.size, 85)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("%dx%d: output is not a JPEG: %v", tc.w, tc.h, err)
+		}
+		if cfg.Width != tc.want || cfg.Height != tc.want {
+			t.Fatalf("%dx%d -> %dx%d, want %dx%d", tc.w, tc.h, cfg.Width, cfg.Height, tc.want, tc.want)
+		}
+	}
+}
+
+func TestSquareJPEGRejectsGarbage(t *testing.T) {
+	if _, err := SquareJPEG([]byte("not an image"), 640, 85); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+// withExif inserts an APP1 EXIF segment with the given orientation and a
+// recognisable GPS payload right after a JPEG's SOI marker.
+func withExif(t *testing.T, jpg []byte, orientation byte) []byte {
+	t.Helper()
+	tiff := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0,
+		2, 0,
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, orientation, 0, 0, 0,
+		0x25, 0x88, 4, 0, 1, 0, 0, 0, 38, 0, 0, 0, // GPS IFD pointer
+		0, 0, 0, 0,
+	}
+	tiff = append(tiff, "GPS 12.9716N 77.5946E"...)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xff, 0xe1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	seg = append(seg, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img, _, err := Decode(encodePNG(t, w, h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EncodeJPEG(img, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestStripMetadataKeepsOnlyOrientation(t *testing.T) {
+	jpg := withExif(t, encodeJPEG(t, 40, 20), 6)
+	out, orientation, err := StripMetadata(jpg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation != 6 {
+		t.Fatalf("orientation = %d, want 6", orientation)
+	}
+	if bytes.Contains(out, []byte("GPS 12.9716N")) {
+		t.Fatal("GPS data survived stripping")
+	}
+	// The orientation is still readable from the stripped file.
+	if _, again, err := StripMetadata(out); err != nil || again != 6 {
+		t.Fatalf("re-strip orientation = %d (%v), want 6", again, err)
+	}
+
+	prepared, err := PrepareOutgoing(jpg, Profile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prepared.Width != 20 || prepared.Height != 40 {
+		t.Fatalf("displayed size = %dx%d, want 20x40 after rotation", prepared.Width, prepared.Height)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(prepared.Thumbnail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width > ThumbnailSize || cfg.Height > ThumbnailSize || cfg.Height < cfg.Width {
+		t.Fatalf("thumbnail is %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestStripMetadataPNG(t *testing.T) {
+	src := encodePNG(t, 4, 4)
+	// Insert a tEXt chunk after IHDR (8-byte signature + 25-byte IHDR).
+	text := []byte("\x00\x00\x00\x0ctEXtComment\x00hi!!\x00\x00\x00\x00")
+	withText := append(append(append([]byte{}, src[:33]...), text...), src[33:]...)
+	out, _, err := StripMetadata(withText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, src) {
+		t.Fatal("tEXt chunk was not removed cleanly")
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255}) // top-left marker
+	for orientation, want := range map[int]image.Point{
+		1: {0, 0}, 2: {2, 0}, 3: {2, 1}, 4: {0, 1},
+		5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2},
+	} {
+		out := Orient(img, orientation)
+		if r, _, _, _ := out.At(want.X, want.Y).RGBA(); r != 0xffff {
+			t.Errorf("orientation %d: marker not at %v", orientation, want)
+		}
+	}
+}
+
+func TestPrepareOutgoingProfiles(t *testing.T) {
+	src := encodePNG(t, 2000, 500)
+	for _, tc := range []struct {
+		profile      Profile
+		w, h         int
+		wantMimetype string
+	}{
+		{ProfileStandard, 1600, 400, "image/jpeg"},
+		{ProfileHD, 2000, 500, "image/jpeg"}, // converted, not scaled
+		{Profile{}, 2000, 500, ""},
+	} {
+		out, err := PrepareOutgoing(src, tc.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Width != tc.w || out.Height != tc.h || out.Mimetype != tc.wantMimetype {
+			t.Fatalf("%+v: got %dx%d %q, want %dx%d %q", tc.profile, out.Width, out.Height, out.Mimetype, tc.w, tc.h, tc.wantMimetype)
+		}
+		if tc.wantMimetype == "" {
+			if !bytes.Equal(out.Data, src) {
+				t.Fatal("original quality changed the image")
+			}
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(out.Data))
+		if err != nil || cfg.Width != tc.w || cfg.Height != tc.h {
+			t.Fatalf("%+v: encoded %dx%d (%v), want %dx%d", tc.profile, cfg.Width, cfg.Height, err, tc.w, tc.h)
+		}
+	}
+
+	// Re-encoding bakes the EXIF orientation into the pixels.
+	rotated := withExif(t, encodeJPEG(t, 3200, 800), 6)
+	out, err := PrepareOutgoing(rotated, ProfileStandard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, orientation, _ := StripMetadata(out.Data); orientation != 1 {
+		t.Fatalf("re-encoded image still has orientation %d", orientation)
+	}
+	if out.Width != 400 || out.Height != 1600 {
+		t.Fatalf("rotated size = %dx%d, want 400x1600", out.Width, out.Height)
+	}
+}
+
+func TestPrepareOutgoingKeepsAnimationAndTransparency(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 2000, 500))
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, transparent); err != nil {
+		t.Fatal(err)
+	}
+
+	palette := color.Palette{color.Black, color.White}
+	frames := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 2000, 500), palette),
+			image.NewPaletted(image.Rect(0, 0, 2000, 500), palette),
+		},
+		Delay: []int{10, 10},
+	}
+	var gifBuf bytes.Buffer
+	if err := gif.EncodeAll(&gifBuf, frames); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, src := range map[string][]byte{"png": pngBuf.Bytes(), "gif": gifBuf.Bytes()} {
+		out, err := PrepareOutgoing(src, ProfileStandard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Mimetype != "" || !bytes.Equal(out.Data, src) {
+			t.Fatalf("%s: re-encoded to %q, want the original", name, out.Mimetype)
+		}
+		if out.Width != 2000 || out.Height != 500 || len(out.Thumbnail) == 0 {
+			t.Fatalf("%s: got %dx%d with %d byte thumbnail", name, out.Width, out.Height, len(out.Thumbnail))
+		}
+	}
+}
+
+func TestStickerCanvasCentresOnTransparency(t *testing.T) {
+	img, _, err := Decode(encodePNG(t, 200, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	canvas := StickerCanvas(img)
+	if canvas.Rect.Dx() != StickerSide || canvas.Rect.Dy() != StickerSide {
+		t.Fatalf("canvas is %v", canvas.Rect)
+	}
+	// 200x100 scales to 512x256, leaving 128 transparent rows above and below.
+	if a := canvas.NRGBAAt(256, 127).A; a != 0 {
+		t.Fatalf("padding alpha = %d, want 0", a)
+	}
+	if a := canvas.NRGBAAt(256, 128).A; a != 0xff {
+		t.Fatalf("image alpha = %d, want 255", a)
+	}
+}
+
+func TestStickerIsSmallSquareWebP(t *testing.T) {
+	for _, size := range [][2]int{{64, 64}, {1200, 700}} {
+		img, _, err := Decode(encodePNG(t, size[0], size[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := Sticker(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > MaxStickerBytes {
+			t.Fatalf("%v: sticker is %d bytes", size, len(data))
+		}
+		w, h, animated, err := WebPInfo(data)
+		if err != nil || w != StickerSide || h != StickerSide || animated {
+			t.Fatalf("%v: WebPInfo = %dx%d animated=%v, %v", size, w, h, animated, err)
+		}
+		if string(data[12:16]) != "VP8L" || int(binary.LittleEndian.Uint32(data[4:])) != len(data)-8 {
+			t.Fatalf("%v: bad RIFF header % x", size, data[:20])
+		}
+	}
+}
+
+func TestPrefixEncode(t *testing.T) {
+	// Inverse of the VP8L decoder's prefix code reading.
+	decode := func(code, extra int) int {
+		if code < 4 {
+			return code + 1
+		}
+		bits := (code - 2) >> 1
+		return (2+code&1)<<bits + extra + 1
+	}
+	for v := 1; v <= 4096; v++ {
+		code, bits, extra := prefixEncode(v)
+		if extra >= 1<<bits {
+			t.Fatalf("%d: extra %d doesn't fit %d bits", v, extra, bits)
+		}
+		if got := decode(code, extra); got != v {
+			t.Fatalf("prefixEncode(%d) = %d, %d decodes to %d", v, code, extra, got)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+var (
+	jpegSOI      = []byte{0xff, 0xd8}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+	iccHeader    = []byte("ICC_PROFILE\x00")
+	adobeHeader  = []byte("Adobe")
+)
+
+// StripMetadata removes EXIF (including GPS), XMP, IPTC and comments from a
+// JPEG or PNG without re-encoding it. Other formats are returned unchanged.
+// A JPEG's EXIF orientation is kept, since viewers need it to show the
+// photo upright; it is also returned (1 when absent or not a JPEG).
+func StripMetadata(data []byte) ([]byte, int, error) {
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		return stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		out, err := stripPNG(data)
+		return out, 1, err
+	}
+	return data, 1, nil
+}
+
+var errTruncated = errors.New("truncated image")
+
+func stripJPEG(data []byte) ([]byte, int, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, jpegSOI...)
+	orientation := 1
+	wroteOrientation := false
+	pos := len(jpegSOI)
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, 0, errTruncated
+		}
+		marker := data[pos+1]
+		if marker == 0xff { // fill byte
+			pos++
+			continue
+		}
+		if marker == 0xd9 || (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 {
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			if marker == 0xd9 {
+				return out, orientation, nil
+			}
+			continue
+		}
+		if pos+4 > len(data) {
+			return nil, 0, errTruncated
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, 0, errTruncated
+		}
+		segment, payload := data[pos:end], data[pos+4:end]
+
+		// The orientation goes in once the metadata at the start of the
+		// file is done, i.e. before the first non-APP0 segment.
+		if !wroteOrientation && marker != 0xe0 && marker != 0xe1 && orientation != 1 {
+			out = append(out, exifOrientationSegment(orientation)...)
+			wroteOrientation = true
+		}
+		keep := true
+		switch {
+		case marker == 0xe1:
+			if bytes.HasPrefix(payload, exifHeader) {
+				if o := exifOrientation(payload[len(exifHeader):]); o >= 1 && o <= 8 {
+					orientation = o
+				}
+			}
+			keep = false
+		case marker == 0xe2:
+			keep = bytes.HasPrefix(payload, iccHeader)
+		case marker == 0xee:
+			// Needed to decode CMYK/YCCK JPEGs correctly.
+			keep = bytes.HasPrefix(payload, adobeHeader)
+		case marker > 0xe0 && marker <= 0xef, marker == 0xfe:
+			keep = false
+		}
+		if keep {
+			out = append(out, segment...)
+		}
+		pos = end
+		if marker == 0xda {
+			// Entropy-coded data up to the end of the file; markers in it
+			// are image data, not metadata.
+			return append(out, data[pos:]...), orientation, nil
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure, or returns 0.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(bo.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	n := int(bo.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if bo.Uint16(tiff[entry:]) == 0x0112 {
+			return int(bo.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// exifOrientationSegment builds an APP1 segment holding only an EXIF
+// orientation tag.
+func exifOrientationSegment(orientation int) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD0 at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, // orientation, SHORT, count 1
+		0, 0, 0, 0, // no next IFD
+	}
+	seg := []byte{0xff, 0xe1, 0, 0}
+	seg = append(seg, exifHeader...)
+	seg = append(seg, tiff...)
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(seg)-2))
+	return seg
+}
+
+// pngMetadataChunks are the ancillary chunks that can carry personal data.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errTruncated
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, errTruncated
+		}
+		if !pngMetadataChunks[string(data[pos+4:pos+8])] {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return out, nil
+}
+
+// Orient applies an EXIF orientation (1-8) to img, returning it the way it
+// should be shown.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,66 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// WhatsApp sticker limits.
+const (
+	StickerSide = 512
+	// MaxStickerBytes is the largest static sticker WhatsApp accepts.
+	MaxStickerBytes = 100 << 10
+	// MaxAnimatedStickerBytes is the largest animated sticker.
+	MaxAnimatedStickerBytes = 500 << 10
+)
+
+// StickerCanvas scales img to fit StickerSide x StickerSide and centres it
+// on a transparent canvas of that size, as stickers must be square.
+func StickerCanvas(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Stickers are shown at full size, so small images are scaled up too.
+	if w >= h {
+		w, h = StickerSide, max(1, h*StickerSide/w)
+	} else {
+		w, h = max(1, w*StickerSide/h), StickerSide
+	}
+	scaled := Resize(img, w, h)
+	canvas := image.NewNRGBA(image.Rect(0, 0, StickerSide, StickerSide))
+	at := image.Pt((StickerSide-w)/2, (StickerSide-h)/2)
+	draw.Draw(canvas, scaled.Rect.Add(at), scaled, image.Point{}, draw.Src)
+	return canvas
+}
+
+// Posterize returns a copy of img with the bits lowest bits of each colour
+// channel cleared. Fewer distinct values make the lossless encoding smaller.
+func Posterize(img *image.NRGBA, bits int) *image.NRGBA {
+	out := image.NewNRGBA(img.Rect)
+	mask := byte(0xff << bits)
+	for i, v := range img.Pix {
+		if i%4 == 3 {
+			out.Pix[i] = v
+		} else {
+			out.Pix[i] = v & mask
+		}
+	}
+	return out
+}
+
+// Sticker encodes img as a static sticker: a StickerSide square lossless
+// WebP of at most MaxStickerBytes. Images too detailed for that are
+// posterized until they fit.
+func Sticker(img image.Image) ([]byte, error) {
+	canvas := StickerCanvas(img)
+	for bits := 0; bits <= 6; bits++ {
+		data, err := EncodeWebP(Posterize(canvas, bits))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= MaxStickerBytes {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("image is too detailed for a %d KB sticker", MaxStickerBytes>>10)
+}
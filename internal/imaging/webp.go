@@ -0,0 +1,637 @@
+package imaging
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// EncodeWebP encodes img as a lossless WebP (VP8L, RFC 9649).
+//
+// The encoder is deliberately small: it uses the subtract-green and
+// predictor transforms, one set of prefix codes and backward references
+// to the previous pixel and the one above. That is enough for stickers,
+// which are mostly flat colour on transparency.
+func EncodeWebP(img image.Image) ([]byte, error) {
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if w < 1 || h < 1 || w > 1<<14 || h > 1<<14 {
+		return nil, fmt.Errorf("cannot encode a %dx%d WebP", w, h)
+	}
+
+	argb := make([]uint32, w*h)
+	hasAlpha := false
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := src.Pix[y*src.Stride+x*4:]
+			r, g, b, a := uint32(p[0]), uint32(p[1]), uint32(p[2]), uint32(p[3])
+			if a == 0 {
+				// Invisible; zero it so it compresses to nothing.
+				r, g, b = 0, 0, 0
+			}
+			hasAlpha = hasAlpha || a != 0xff
+			argb[y*w+x] = a<<24 | r<<16 | g<<8 | b
+		}
+	}
+
+	var bw bitWriter
+	bw.write(0x2f, 8) // VP8L signature
+	bw.write(uint32(w-1), 14)
+	bw.write(uint32(h-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	// Transforms, in the order the encoder applies them.
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(argb)
+
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	modes, tilesW := choosePredictors(argb, w, h)
+	writeEntropyImage(&bw, modes, tilesW, false)
+	residuals := applyPredictors(argb, w, h, modes, tilesW)
+
+	bw.write(0, 1) // no more transforms
+	writeEntropyImage(&bw, residuals, w, true)
+
+	data := bw.bytes()
+	out := make([]byte, 0, 20+len(data)+1)
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(12+len(data)+len(data)%2))
+	out = append(out, "WEBPVP8L"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out, nil
+}
+
+// toNRGBA returns img as an *image.NRGBA whose bounds start at the origin.
+// WebP stores straight alpha, so this avoids a lossy round trip through
+// premultiplied RGBA.
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Rect, img, b.Min, draw.Src)
+	return nrgba
+}
+
+// WebPInfo reads the canvas size of a WebP and whether it is animated.
+func WebPInfo(data []byte) (width, height int, animated bool, err error) {
+	if len(data) < 30 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false, errors.New("not a WebP image")
+	}
+	chunk := data[12:]
+	switch string(chunk[:4]) {
+	case "VP8X":
+		flags := chunk[8]
+		w := int(chunk[12]) | int(chunk[13])<<8 | int(chunk[14])<<16
+		h := int(chunk[15]) | int(chunk[16])<<8 | int(chunk[17])<<16
+		return w + 1, h + 1, flags&0x02 != 0, nil
+	case "VP8L":
+		if chunk[8] != 0x2f {
+			return 0, 0, false, errors.New("bad VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(chunk[9:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, false, nil
+	case "VP8 ":
+		frame := chunk[8:]
+		if frame[3] != 0x9d || frame[4] != 0x01 || frame[5] != 0x2a {
+			return 0, 0, false, errors.New("bad VP8 start code")
+		}
+		return int(binary.LittleEndian.Uint16(frame[6:]) & 0x3fff), int(binary.LittleEndian.Uint16(frame[8:]) & 0x3fff), false, nil
+	}
+	return 0, 0, false, fmt.Errorf("unknown WebP chunk %q", chunk[:4])
+}
+
+const (
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// predictorBits sets the predictor tile size (1<<predictorBits).
+	predictorBits = 5
+
+	numLiteralCodes = 256
+	numLengthCodes  = 24
+	numDistanceCode = 40
+	// maxLength is the longest backward reference VP8L can code.
+	maxLength = 4096
+	// minLength is the shortest backward reference worth its prefix codes.
+	minLength = 3
+)
+
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+func channel(p uint32, shift uint) int { return int(p >> shift & 0xff) }
+
+// perChannel applies f to each of the four channels of its arguments.
+func perChannel(f func(a, b, c int) int, a, b, c uint32) uint32 {
+	var out uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		out |= uint32(f(channel(a, shift), channel(b, shift), channel(c, shift))&0xff) << shift
+	}
+	return out
+}
+
+func average2(a, b uint32) uint32 {
+	return perChannel(func(x, y, _ int) int { return (x + y) / 2 }, a, b, 0)
+}
+
+func clamp255(v int) int { return min(max(v, 0), 255) }
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// predict returns the prediction of VP8L predictor mode for a pixel with
+// left, top, top-left and top-right neighbours l, t, tl and tr.
+func predict(mode int, l, t, tl, tr uint32) uint32 {
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		var pl, pt int
+		for shift := uint(0); shift < 32; shift += 8 {
+			p := channel(l, shift) + channel(t, shift) - channel(tl, shift)
+			pl += abs(p - channel(l, shift))
+			pt += abs(p - channel(t, shift))
+		}
+		if pl < pt {
+			return l
+		}
+		return t
+	case 12:
+		return perChannel(func(a, b, c int) int { return clamp255(a + b - c) }, l, t, tl)
+	default: // 13
+		return perChannel(func(a, b, _ int) int { return clamp255(a + (a-b)/2) }, average2(l, t), tl, 0)
+	}
+}
+
+// predictionAt is what the decoder predicts for pixel (x, y) given the
+// tile's mode: the first row and column have fixed predictors.
+func predictionAt(argb []uint32, w, x, y, mode int) uint32 {
+	i := y*w + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-w]
+	}
+	// For the last column, "top-right" is the first pixel of this row,
+	// which is exactly where i-w+1 points.
+	return predict(mode, argb[i-1], argb[i-w], argb[i-w-1], argb[i-w+1])
+}
+
+func residual(p, pred uint32) uint32 {
+	return perChannel(func(a, b, _ int) int { return a - b }, p, pred, 0)
+}
+
+// choosePredictors picks, per tile, the mode with the smallest residuals.
+func choosePredictors(argb []uint32, w, h int) ([]uint32, int) {
+	tile := 1 << predictorBits
+	tilesW, tilesH := (w+tile-1)/tile, (h+tile-1)/tile
+	modes := make([]uint32, tilesW*tilesH)
+	for ty := 0; ty < tilesH; ty++ {
+		for tx := 0; tx < tilesW; tx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := ty * tile; y < min(h, (ty+1)*tile); y++ {
+					for x := tx * tile; x < min(w, (tx+1)*tile); x++ {
+						r := residual(argb[y*w+x], predictionAt(argb, w, x, y, mode))
+						for shift := uint(0); shift < 32; shift += 8 {
+							// Small residuals either way of zero are cheap.
+							cost += min(channel(r, shift), 256-channel(r, shift))
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesW+tx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+	return modes, tilesW
+}
+
+func applyPredictors(argb []uint32, w, h int, modes []uint32, tilesW int) []uint32 {
+	out := make([]uint32, len(argb))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			mode := int(modes[(y>>predictorBits)*tilesW+x>>predictorBits] >> 8 & 0xff)
+			out[y*w+x] = residual(argb[y*w+x], predictionAt(argb, w, x, y, mode))
+		}
+	}
+	return out
+}
+
+// symbol is one coded element of the image: a literal pixel, or a
+// backward reference of length pixels at distance code dist.
+type symbol struct {
+	pixel  uint32
+	length int
+	dist   int
+}
+
+// backwardRefs turns pixels into literals and copies of the previous
+// pixel or the pixel above.
+func backwardRefs(argb []uint32, w int) []symbol {
+	var syms []symbol
+	for i := 0; i < len(argb); {
+		run := func(d int) int {
+			if i < d {
+				return 0
+			}
+			n := 0
+			for i+n < len(argb) && n < maxLength && argb[i+n] == argb[i+n-d] {
+				n++
+			}
+			return n
+		}
+		left, up := run(1), run(w)
+		switch {
+		case up >= minLength && up >= left:
+			syms = append(syms, symbol{length: up, dist: 1}) // code 1 is (0, 1): the pixel above
+			i += up
+		case left >= minLength:
+			syms = append(syms, symbol{length: left, dist: 2}) // code 2 is (1, 0): the pixel to the left
+			i += left
+		default:
+			syms = append(syms, symbol{pixel: argb[i]})
+			i++
+		}
+	}
+	return syms
+}
+
+// prefixEncode splits a length or distance into its prefix code and extra
+// bits.
+func prefixEncode(v int) (code, extraBits, extra int) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	hi := 31
+	for d>>hi == 0 {
+		hi--
+	}
+	second := d >> (hi - 1) & 1
+	extraBits = hi - 1
+	return 2*hi + second, extraBits, d & (1<<extraBits - 1)
+}
+
+// writeEntropyImage writes an image with one prefix code group. The main
+// image additionally says it has no meta prefix codes.
+func writeEntropyImage(bw *bitWriter, argb []uint32, w int, main bool) {
+	bw.write(0, 1) // no color cache
+	if main {
+		bw.write(0, 1) // no meta prefix codes
+	}
+	syms := backwardRefs(argb, w)
+
+	green := make([]int, numLiteralCodes+numLengthCodes)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, numDistanceCode)
+	for _, s := range syms {
+		if s.length > 0 {
+			code, _, _ := prefixEncode(s.length)
+			green[numLiteralCodes+code]++
+			code, _, _ = prefixEncode(s.dist)
+			dist[code]++
+			continue
+		}
+		green[s.pixel>>8&0xff]++
+		red[s.pixel>>16&0xff]++
+		blue[s.pixel&0xff]++
+		alpha[s.pixel>>24]++
+	}
+	codes := [5]prefixCode{}
+	for i, hist := range [][]int{green, red, blue, alpha, dist} {
+		codes[i] = newPrefixCode(hist, 15)
+		codes[i].writeTo(bw)
+	}
+	for _, s := range syms {
+		if s.length > 0 {
+			code, n, extra := prefixEncode(s.length)
+			codes[0].writeSymbol(bw, numLiteralCodes+code)
+			bw.write(uint32(extra), n)
+			code, n, extra = prefixEncode(s.dist)
+			codes[4].writeSymbol(bw, code)
+			bw.write(uint32(extra), n)
+			continue
+		}
+		codes[0].writeSymbol(bw, int(s.pixel>>8&0xff))
+		codes[1].writeSymbol(bw, int(s.pixel>>16&0xff))
+		codes[2].writeSymbol(bw, int(s.pixel&0xff))
+		codes[3].writeSymbol(bw, int(s.pixel>>24))
+	}
+}
+
+// prefixCode is a canonical Huffman code.
+type prefixCode struct {
+	lengths []int
+	codes   []uint32 // bit-reversed, ready for the LSB-first writer
+	// used lists the symbols with a non-zero count.
+	used []int
+}
+
+func newPrefixCode(hist []int, maxBits int) prefixCode {
+	pc := prefixCode{lengths: make([]int, len(hist)), codes: make([]uint32, len(hist))}
+	for s, n := range hist {
+		if n > 0 {
+			pc.used = append(pc.used, s)
+		}
+	}
+	if len(pc.used) <= 1 {
+		// A single symbol takes no bits.
+		return pc
+	}
+	pc.lengths = huffmanLengths(hist, maxBits)
+
+	// Canonical codes: shorter codes first, then by symbol.
+	var count [16]int
+	for _, l := range pc.lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + uint32(count[l-1])) << 1
+		next[l] = code
+	}
+	for s, l := range pc.lengths {
+		if l == 0 {
+			continue
+		}
+		pc.codes[s] = reverseBits(next[l], l)
+		next[l]++
+	}
+	return pc
+}
+
+func reverseBits(v uint32, n int) uint32 {
+	var r uint32
+	for i := 0; i < n; i++ {
+		r = r<<1 | v>>i&1
+	}
+	return r
+}
+
+func (pc *prefixCode) writeSymbol(bw *bitWriter, s int) {
+	if len(pc.used) <= 1 {
+		return
+	}
+	bw.write(pc.codes[s], pc.lengths[s])
+}
+
+// codeLengthOrder is the order code length code lengths are stored in.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+func (pc *prefixCode) writeTo(bw *bitWriter) {
+	if len(pc.used) <= 1 {
+		// Simple code with one symbol.
+		s := 0
+		if len(pc.used) == 1 {
+			s = pc.used[0]
+		}
+		if s < 256 {
+			bw.write(1, 1) // simple
+			bw.write(0, 1) // one symbol
+			if s < 2 {
+				bw.write(0, 1)
+				bw.write(uint32(s), 1)
+			} else {
+				bw.write(1, 1)
+				bw.write(uint32(s), 8)
+			}
+			return
+		}
+		// Symbols past 255 can't be simple-coded; give it a one-bit code
+		// next to an unused partner instead.
+		pc.lengths[s], pc.lengths[0] = 1, 1
+		pc.codes[0], pc.codes[s] = 0, 1
+		pc.used = []int{0, s}
+	}
+
+	// Normal code: the code lengths, run-length coded with symbols 0-18
+	// and themselves Huffman coded.
+	type clSym struct{ sym, extra, extraBits int }
+	var cl []clSym
+	lengths := pc.lengths
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		n := 1
+		for i+n < len(lengths) && lengths[i+n] == l {
+			n++
+		}
+		i += n
+		if l == 0 {
+			for n > 0 {
+				switch {
+				case n >= 11:
+					k := min(n, 138)
+					cl = append(cl, clSym{18, k - 11, 7})
+					n -= k
+				case n >= 3:
+					cl = append(cl, clSym{17, n - 3, 3})
+					n = 0
+				default:
+					cl = append(cl, clSym{0, 0, 0})
+					n--
+				}
+			}
+			continue
+		}
+		// A literal, then repeats of it with 16 (which repeats the
+		// previous non-zero length).
+		cl = append(cl, clSym{l, 0, 0})
+		n--
+		for n >= 3 {
+			k := min(n, 6)
+			cl = append(cl, clSym{16, k - 3, 2})
+			n -= k
+		}
+		for ; n > 0; n-- {
+			cl = append(cl, clSym{l, 0, 0})
+		}
+	}
+	clHist := make([]int, 19)
+	for _, c := range cl {
+		clHist[c.sym]++
+	}
+	clCode := newPrefixCode(clHist, 7)
+	if len(clCode.used) == 1 {
+		// Give the lone code length symbol a real 1-bit code so the decoder
+		// has a complete tree to read it with.
+		s := clCode.used[0]
+		other := 0
+		if s == 0 {
+			other = 1
+		}
+		clCode.lengths[s], clCode.lengths[other] = 1, 1
+		clCode.codes[min(s, other)], clCode.codes[max(s, other)] = 0, 1
+		clCode.used = []int{min(s, other), max(s, other)}
+	}
+
+	numCodes := 19
+	for numCodes > 4 && clCode.lengths[codeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.write(0, 1) // normal
+	bw.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.write(uint32(clCode.lengths[codeLengthOrder[i]]), 3)
+	}
+	bw.write(0, 1) // max_symbol is the alphabet size
+	for _, c := range cl {
+		clCode.writeSymbol(bw, c.sym)
+		bw.write(uint32(c.extra), c.extraBits)
+	}
+}
+
+// huffmanLengths returns code lengths for hist no longer than maxBits. When
+// the optimal code is too deep, rare symbols are made less rare until it
+// fits.
+func huffmanLengths(hist []int, maxBits int) []int {
+	counts := append([]int(nil), hist...)
+	for floor := 1; ; floor *= 2 {
+		lengths := huffmanTree(counts)
+		deepest := 0
+		for _, l := range lengths {
+			deepest = max(deepest, l)
+		}
+		if deepest <= maxBits {
+			return lengths
+		}
+		for i, n := range hist {
+			if n > 0 {
+				counts[i] = max(n, floor)
+			}
+		}
+	}
+}
+
+type node struct {
+	weight      int
+	sym         int // leaf symbol, or -1
+	left, right *node
+}
+
+type nodeHeap []*node
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].sym < h[j].sym
+}
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x any)   { *h = append(*h, x.(*node)) }
+func (h *nodeHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+func huffmanTree(counts []int) []int {
+	var h nodeHeap
+	for s, n := range counts {
+		if n > 0 {
+			h = append(h, &node{weight: n, sym: s})
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 1 {
+		a := heap.Pop(&h).(*node)
+		b := heap.Pop(&h).(*node)
+		heap.Push(&h, &node{weight: a.weight + b.weight, sym: -1, left: a, right: b})
+	}
+	lengths := make([]int, len(counts))
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		if n.sym >= 0 {
+			lengths[n.sym] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(h[0], 0)
+	return lengths
+}
+
+// bitWriter writes bits least significant first, as VP8L reads them.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (bw *bitWriter) write(v uint32, n int) {
+	bw.acc |= uint64(v&(1<<n-1)) << bw.nbits
+	bw.nbits += uint(n)
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nbits = 0, 0
+	}
+	return bw.buf
+}
@@ -0,0 +1,57 @@
+package misc
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DownloadDir is the user's download directory: XDG_DOWNLOAD_DIR from
+// user-dirs.dirs when it is set, ~/Downloads otherwise.
+func DownloadDir() string {
+	home, _ := os.UserHomeDir()
+	if cdr, err := os.UserConfigDir(); err == nil {
+		if dir := readUserDir(filepath.Join(cdr, "user-dirs.dirs"), "XDG_DOWNLOAD_DIR", home); dir != "" {
+			return dir
+		}
+	}
+	return filepath.Join(home, "Downloads")
+}
+
+// readUserDir reads a directory from a user-dirs.dirs file, whose lines
+// look like XDG_DOWNLOAD_DIR="$HOME/Downloads". It returns "" when the file
+// doesn't set key, or sets it to the home directory, which the spec treats
+// as disabled.
+func readUserDir(path, key, home string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	dir := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || name != key {
+			continue
+		}
+		value, err := strconv.Unquote(value)
+		if err != nil {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(value, "$HOME"); ok {
+			value = home + rest
+		}
+		if !filepath.IsAbs(value) {
+			continue
+		}
+		dir = filepath.Clean(value)
+	}
+	if dir == filepath.Clean(home) {
+		return ""
+	}
+	return dir
+}
@@ -0,0 +1,81 @@
+package misc
+
+import (
+	"context"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	nmService   = "org.freedesktop.NetworkManager"
+	nmPath      = "/org/freedesktop/NetworkManager"
+	nmInterface = "org.freedesktop.NetworkManager"
+)
+
+// NetworkManager's NMMetered values that mean metered.
+const (
+	nmMeteredYes      = 1
+	nmMeteredGuessYes = 3
+)
+
+func isMetered(v dbus.Variant) bool {
+	metered, _ := v.Value().(uint32)
+	return metered == nmMeteredYes || metered == nmMeteredGuessYes
+}
+
+// IsMetered reports whether NetworkManager considers the connection
+// metered, like a phone hotspot. Without NetworkManager it reports false.
+func IsMetered() bool {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return false
+	}
+	v, err := conn.Object(nmService, nmPath).GetProperty(nmInterface + ".Metered")
+	if err != nil {
+		return false
+	}
+	return isMetered(v)
+}
+
+// WatchMetered calls onChange whenever NetworkManager's metered state
+// changes, until ctx is done. Without a system bus it returns an error at
+// once.
+func WatchMetered(ctx context.Context, onChange func(metered bool)) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return err
+	}
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(nmPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	}
+	if err := conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer conn.RemoveMatchSignal(match...)
+	signals := make(chan *dbus.Signal, 8)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case s, ok := <-signals:
+			if !ok {
+				return nil
+			}
+			if s.Path != nmPath || s.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(s.Body) < 2 {
+				continue
+			}
+			if iface, _ := s.Body[0].(string); iface != nmInterface {
+				continue
+			}
+			changed, _ := s.Body[1].(map[string]dbus.Variant)
+			if v, ok := changed["Metered"]; ok {
+				onChange(isMetered(v))
+			}
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package misc
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/lugvitc/whats4linux/internal/query"
 )
 
 const APP_NAME = "whats4linux"
@@ -16,6 +19,35 @@ func GetSQLiteAddress(dbName string) string {
 	return fmt.Sprintf("file:%s?_foreign_keys=on", path)
 }
 
+// ClearTables deletes every row of every table in tx's database.
+func ClearTables(tx *sql.Tx) error {
+	if _, err := tx.Exec(query.DeferForeignKeys); err != nil {
+		return err
+	}
+	rows, err := tx.Query(query.SelectTables)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, name := range tables {
+		if _, err := tx.Exec(`DELETE FROM "` + name + `"`); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
 func defaultConfigDir() string {
 	cdr, err := os.UserConfigDir()
 	if err != nil {
@@ -0,0 +1,197 @@
+// Package oggopus reads the duration of an Ogg/Opus file (the format of
+// WhatsApp voice notes) and draws a waveform for it, without decoding the
+// audio.
+package oggopus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WaveformSamples is the number of bars in a voice note waveform.
+const WaveformSamples = 64
+
+// sampleRate is the rate Opus granule positions and pre-skip are counted in.
+const sampleRate = 48000
+
+// Info describes a voice note.
+type Info struct {
+	Duration time.Duration
+	// Waveform holds WaveformSamples levels from 0 to 100.
+	Waveform []byte
+}
+
+// ErrNotOpus is returned for input that isn't an Ogg stream carrying Opus.
+var ErrNotOpus = errors.New("not an Ogg/Opus stream")
+
+// Parse reads an Ogg/Opus stream to its end.
+//
+// The waveform is estimated from packet sizes: Opus is variable-bitrate, so
+// loud or busy passages take more bytes than quiet ones, and silence
+// shrinks to a few bytes per packet. That is close enough for the bars
+// shown next to a voice note, which only need to follow speech and pauses.
+func Parse(r io.Reader) (Info, error) {
+	var (
+		br       = bufio.NewReader(r)
+		header   [27]byte
+		lacing   [255]byte
+		packet   []byte
+		packets  int
+		serial   uint32
+		preSkip  int64
+		granule  int64
+		samples  int64
+		sizes    []int
+		offsets  []int64 // start of each audio packet, in samples
+		haveHead bool
+	)
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if err == io.EOF && haveHead {
+				break
+			}
+			if !haveHead {
+				return Info{}, ErrNotOpus
+			}
+			return Info{}, fmt.Errorf("truncated ogg page: %w", err)
+		}
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			if !haveHead {
+				return Info{}, ErrNotOpus
+			}
+			return Info{}, errors.New("lost ogg page sync")
+		}
+		pageSerial := binary.LittleEndian.Uint32(header[14:])
+		if packets == 0 {
+			serial = pageSerial
+		}
+		nsegs := int(header[26])
+		if _, err := io.ReadFull(br, lacing[:nsegs]); err != nil {
+			return Info{}, fmt.Errorf("truncated ogg page: %w", err)
+		}
+		bodyLen := 0
+		for _, l := range lacing[:nsegs] {
+			bodyLen += int(l)
+		}
+		body := make([]byte, bodyLen)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return Info{}, fmt.Errorf("truncated ogg page: %w", err)
+		}
+		// Other logical streams (e.g. a chained video track) are skipped.
+		if pageSerial != serial {
+			continue
+		}
+		if g := int64(binary.LittleEndian.Uint64(header[6:])); g >= 0 {
+			granule = g
+		}
+
+		for _, l := range lacing[:nsegs] {
+			packet = append(packet, body[:l]...)
+			body = body[l:]
+			if l == 255 {
+				continue // the packet goes on in the next segment
+			}
+			switch packets {
+			case 0:
+				if len(packet) < 19 || !bytes.HasPrefix(packet, []byte("OpusHead")) {
+					return Info{}, ErrNotOpus
+				}
+				preSkip = int64(binary.LittleEndian.Uint16(packet[10:]))
+				haveHead = true
+			case 1:
+				// OpusTags
+			default:
+				offsets = append(offsets, samples)
+				sizes = append(sizes, len(packet))
+				samples += packetSamples(packet)
+			}
+			packets++
+			packet = packet[:0]
+		}
+	}
+
+	total := granule - preSkip
+	if total <= 0 {
+		total = samples - preSkip
+	}
+	return Info{
+		Duration: time.Duration(max(total, 0)) * time.Second / sampleRate,
+		Waveform: waveform(sizes, offsets, samples),
+	}, nil
+}
+
+// packetSamples returns the length of an Opus packet in 48 kHz samples,
+// from its TOC byte (RFC 6716, section 3.1).
+func packetSamples(packet []byte) int64 {
+	if len(packet) == 0 {
+		return 0
+	}
+	toc := packet[0]
+	config := toc >> 3
+	var frame int64
+	switch {
+	case config < 12: // SILK: 10, 20, 40, 60 ms
+		frame = [4]int64{480, 960, 1920, 2880}[config%4]
+	case config < 16: // hybrid: 10, 20 ms
+		frame = [2]int64{480, 960}[config%2]
+	default: // CELT: 2.5, 5, 10, 20 ms
+		frame = [4]int64{120, 240, 480, 960}[config%4]
+	}
+	frames := int64(1)
+	switch toc & 3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frames = int64(packet[1] & 0x3f)
+	}
+	return frame * frames
+}
+
+// waveform averages packet sizes over WaveformSamples equal stretches of
+// time and scales them to 0-100.
+func waveform(sizes []int, offsets []int64, total int64) []byte {
+	out := make([]byte, WaveformSamples)
+	if len(sizes) == 0 || total <= 0 {
+		return out
+	}
+	var sum [WaveformSamples]int
+	var n [WaveformSamples]int
+	for i, size := range sizes {
+		// A packet without samples at the very end starts at total.
+		slot := min(int(offsets[i]*WaveformSamples/total), WaveformSamples-1)
+		sum[slot] += size
+		n[slot]++
+	}
+	// Packets are larger than the silence floor only when there is sound;
+	// measure from the smallest packet so pauses drop to zero.
+	floor := sizes[0]
+	for _, s := range sizes {
+		floor = min(floor, s)
+	}
+	var avg [WaveformSamples]int
+	peak := 0
+	for i := range avg {
+		switch {
+		case n[i] > 0:
+			avg[i] = sum[i]/n[i] - floor
+		case i > 0:
+			avg[i] = avg[i-1] // fewer packets than bars
+		}
+		peak = max(peak, avg[i])
+	}
+	if peak == 0 {
+		return out
+	}
+	for i, v := range avg {
+		out[i] = byte(v * 100 / peak)
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package oggopus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// writePage appends an Ogg page holding whole packets. The CRC is left
+// zero; Parse doesn't check it.
+func writePage(buf *bytes.Buffer, granule int64, packets ...[]byte) {
+	var lacing, body []byte
+	for _, p := range packets {
+		n := len(p)
+		for n >= 255 {
+			lacing = append(lacing, 255)
+			n -= 255
+		}
+		lacing = append(lacing, byte(n))
+		body = append(body, p...)
+	}
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint64(header[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(header[14:], 1234)
+	header[26] = byte(len(lacing))
+	buf.Write(header)
+	buf.Write(lacing)
+	buf.Write(body)
+}
+
+func opusHead(preSkip uint16) []byte {
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1 // version
+	head[9] = 1 // channels
+	binary.LittleEndian.PutUint16(head[10:], preSkip)
+	binary.LittleEndian.PutUint32(head[12:], 48000)
+	return head
+}
+
+func TestParse(t *testing.T) {
+	const preSkip = 312
+	var buf bytes.Buffer
+	writePage(&buf, 0, opusHead(preSkip))
+	writePage(&buf, 0, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00"))
+
+	// 200 CELT packets of 20 ms: 2 s of speech, then 2 s of silence. The
+	// loud packets are long enough to need two lacing segments.
+	var granule int64
+	for page := 0; page < 20; page++ {
+		var packets [][]byte
+		for i := 0; i < 10; i++ {
+			size := 300
+			if page >= 10 {
+				size = 3
+			}
+			p := make([]byte, size)
+			p[0] = 31 << 3 // CELT fullband 20 ms, one frame
+			packets = append(packets, p)
+			granule += 960
+		}
+		writePage(&buf, granule+preSkip, packets...)
+	}
+
+	info, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Duration != 4*time.Second {
+		t.Fatalf("duration = %v, want 4s", info.Duration)
+	}
+	if len(info.Waveform) != WaveformSamples {
+		t.Fatalf("waveform has %d samples", len(info.Waveform))
+	}
+	if info.Waveform[0] != 100 || info.Waveform[WaveformSamples/2-1] != 100 {
+		t.Fatalf("speech half = %v, want 100", info.Waveform[:WaveformSamples/2])
+	}
+	if info.Waveform[WaveformSamples/2] != 0 || info.Waveform[WaveformSamples-1] != 0 {
+		t.Fatalf("silent half = %v, want 0", info.Waveform[WaveformSamples/2:])
+	}
+}
+
+func TestParseRejectsOtherFormats(t *testing.T) {
+	if _, err := Parse(bytes.NewReader([]byte("ID3\x04\x00 not ogg at all, this is an mp3"))); err != ErrNotOpus {
+		t.Fatalf("err = %v, want ErrNotOpus", err)
+	}
+	var vorbis bytes.Buffer
+	writePage(&vorbis, 0, []byte("\x01vorbis\x00\x00\x00\x00\x01\x44\xac\x00\x00"))
+	if _, err := Parse(&vorbis); err != ErrNotOpus {
+		t.Fatalf("vorbis err = %v, want ErrNotOpus", err)
+	}
+}
+
+func TestPacketSamples(t *testing.T) {
+	for _, tc := range []struct {
+		packet []byte
+		want   int64
+	}{
+		{[]byte{1 << 3}, 960},              // SILK 20 ms
+		{[]byte{3<<3 | 1}, 2 * 2880},       // SILK 60 ms, two frames
+		{[]byte{13 << 3}, 960},             // hybrid 20 ms
+		{[]byte{16<<3 | 3, 0x05}, 5 * 120}, // CELT 2.5 ms, five frames
+	} {
+		if got := packetSamples(tc.packet); got != tc.want {
+			t.Errorf("packetSamples(%x) = %d, want %d", tc.packet, got, tc.want)
+		}
+	}
+}
+
+func TestWaveformEmptyLastPacket(t *testing.T) {
+	// The second packet has no samples, so it starts at the very end.
+	got := waveform([]int{10, 0}, []int64{0, 960}, 960)
+	if len(got) != WaveformSamples {
+		t.Fatalf("waveform has %d samples, want %d", len(got), WaveformSamples)
+	}
+}
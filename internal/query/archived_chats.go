@@ -1,20 +1,12 @@
 package query
 
 const (
+	// archived_chats predates chats.archived_at; it is only read to migrate
+	// older databases.
 	CreateArchivedChatsTable = `
 	CREATE TABLE IF NOT EXISTS archived_chats (
 		chat_jid TEXT PRIMARY KEY,
 		archived_at INTEGER NOT NULL
 	);
 	`
-	UpsertArchivedChat = `
-	INSERT OR REPLACE INTO archived_chats (chat_jid, archived_at)
-	VALUES (?, ?);
-	`
-	DeleteArchivedChat = `
-	DELETE FROM archived_chats WHERE chat_jid = ?;
-	`
-	SelectArchivedChats = `
-	SELECT chat_jid, archived_at FROM archived_chats;
-	`
 )
@@ -0,0 +1,39 @@
+package query
+
+const (
+	// Local mirror of the server blocklist, keyed by canonical (PN) JID.
+	// Replaced wholesale on connect and patched by blocklist events.
+	CreateBlockedContactsTable = `
+	CREATE TABLE IF NOT EXISTS blocked_contacts (
+		jid TEXT PRIMARY KEY,
+		blocked_at INTEGER NOT NULL
+	);
+	`
+
+	InsertBlockedContact = `
+	INSERT OR IGNORE INTO blocked_contacts
+	(jid, blocked_at)
+	VALUES (?, ?)
+	`
+
+	DeleteBlockedContact = `
+	DELETE FROM blocked_contacts
+	WHERE jid = ?
+	`
+
+	DeleteAllBlockedContacts = `
+	DELETE FROM blocked_contacts
+	`
+
+	SelectBlockedContact = `
+	SELECT 1
+	FROM blocked_contacts
+	WHERE jid = ?
+	`
+
+	SelectAllBlockedContacts = `
+	SELECT jid
+	FROM blocked_contacts
+	ORDER BY blocked_at DESC, jid
+	`
+)
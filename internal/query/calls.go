@@ -0,0 +1,57 @@
+package query
+
+const (
+	// Call history in messages.db. Times are unix seconds; accepted_at and
+	// ended_at stay 0 until the call is picked up / over. creator_jid is the
+	// raw call-creator JID (possibly a LID) needed to reject the call.
+	CreateCallLogTable = `
+	CREATE TABLE IF NOT EXISTS call_log (
+		call_id TEXT PRIMARY KEY,
+		chat_jid TEXT NOT NULL,
+		caller_jid TEXT NOT NULL,
+		creator_jid TEXT NOT NULL,
+		group_jid TEXT DEFAULT '',
+		is_video BOOLEAN DEFAULT FALSE,
+		started_at INTEGER NOT NULL,
+		accepted_at INTEGER DEFAULT 0,
+		ended_at INTEGER DEFAULT 0,
+		rejected BOOLEAN DEFAULT FALSE,
+		end_reason TEXT DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_call_log_started_at ON call_log(started_at DESC);
+	`
+
+	// Call offers can be delivered more than once; keep the first.
+	InsertCallOffer = `
+	INSERT OR IGNORE INTO call_log
+	(call_id, chat_jid, caller_jid, creator_jid, group_jid, is_video, started_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	UpdateCallAccepted = `
+	UPDATE call_log
+	SET accepted_at = ?
+	WHERE call_id = ? AND accepted_at = 0 AND ended_at = 0
+	`
+
+	UpdateCallEnded = `
+	UPDATE call_log
+	SET ended_at = ?, end_reason = ?, rejected = rejected OR ?
+	WHERE call_id = ? AND ended_at = 0
+	`
+
+	SelectCallByID = `
+	SELECT call_id, chat_jid, caller_jid, creator_jid, group_jid, is_video,
+	       started_at, accepted_at, ended_at, rejected, end_reason
+	FROM call_log
+	WHERE call_id = ?
+	`
+
+	SelectCallLog = `
+	SELECT call_id, chat_jid, caller_jid, creator_jid, group_jid, is_video,
+	       started_at, accepted_at, ended_at, rejected, end_reason
+	FROM call_log
+	ORDER BY started_at DESC, call_id DESC
+	LIMIT ? OFFSET ?
+	`
+)
@@ -0,0 +1,166 @@
+package query
+
+const (
+	// chats holds one row per chat with everything the chat list shows, so
+	// the list is a single indexed read instead of a scan over messages.
+	// pinned_at / archived_at are 0 when not pinned / archived; muted_until
+	// follows muted_chats (-1 forever, 0 not muted).
+	CreateChatsTable = `
+	CREATE TABLE IF NOT EXISTS chats (
+		chat_jid TEXT PRIMARY KEY,
+		last_message_id TEXT NOT NULL DEFAULT '',
+		last_message_text TEXT NOT NULL DEFAULT '',
+		last_message_ts INTEGER NOT NULL DEFAULT 0,
+		last_sender_jid TEXT NOT NULL DEFAULT '',
+		last_sender_name TEXT NOT NULL DEFAULT '',
+		last_from_me BOOLEAN NOT NULL DEFAULT FALSE,
+		unread_count INTEGER NOT NULL DEFAULT 0,
+		pinned_at INTEGER NOT NULL DEFAULT 0,
+		archived_at INTEGER NOT NULL DEFAULT 0,
+		muted_until INTEGER NOT NULL DEFAULT 0,
+		display_name TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_chats_last_ts ON chats(last_message_ts DESC);
+	CREATE INDEX IF NOT EXISTS idx_chats_last_message ON chats(last_message_id);
+	`
+
+	CountChats = `
+	SELECT COUNT(*) FROM chats;
+	`
+
+	// One-time fill from an existing messages table and the per-flag tables
+	// that predate chats.
+	BackfillChatsFromMessages = `
+	INSERT OR IGNORE INTO chats
+	(chat_jid, last_message_id, last_message_text, last_message_ts, last_sender_jid, last_from_me)
+	SELECT chat_jid, message_id, COALESCE(text, ''), timestamp, sender_jid, is_from_me
+	FROM (
+		SELECT chat_jid, message_id, text, timestamp, sender_jid, is_from_me,
+			ROW_NUMBER() OVER (PARTITION BY chat_jid ORDER BY timestamp DESC) AS rn
+		FROM messages
+	)
+	WHERE rn = 1;
+	`
+	BackfillChatsPinned = `
+	INSERT INTO chats (chat_jid, pinned_at)
+	SELECT chat_jid, pinned_at FROM pinned_chats WHERE true
+	ON CONFLICT(chat_jid) DO UPDATE SET pinned_at = excluded.pinned_at;
+	`
+	BackfillChatsArchived = `
+	INSERT INTO chats (chat_jid, archived_at)
+	SELECT chat_jid, archived_at FROM archived_chats WHERE true
+	ON CONFLICT(chat_jid) DO UPDATE SET archived_at = excluded.archived_at;
+	`
+	BackfillChatsMuted = `
+	INSERT INTO chats (chat_jid, muted_until)
+	SELECT chat_jid, muted_until FROM muted_chats WHERE true
+	ON CONFLICT(chat_jid) DO UPDATE SET muted_until = excluded.muted_until;
+	`
+
+	// Records a stored message on its chat. The last-message columns only
+	// move forward in time, so history sync can't replace a newer live
+	// message. Unread counts add up, and a newer message of our own (sent
+	// here or on another device) means the chat was read.
+	UpsertChatLastMessage = `
+	INSERT INTO chats
+	(chat_jid, last_message_id, last_message_text, last_message_ts, last_sender_jid, last_sender_name, last_from_me, unread_count, display_name)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(chat_jid) DO UPDATE SET
+		last_message_id = CASE WHEN excluded.last_message_ts >= chats.last_message_ts THEN excluded.last_message_id ELSE chats.last_message_id END,
+		last_message_text = CASE WHEN excluded.last_message_ts >= chats.last_message_ts THEN excluded.last_message_text ELSE chats.last_message_text END,
+		last_sender_jid = CASE WHEN excluded.last_message_ts >= chats.last_message_ts THEN excluded.last_sender_jid ELSE chats.last_sender_jid END,
+		last_sender_name = CASE WHEN excluded.last_message_ts >= chats.last_message_ts THEN excluded.last_sender_name ELSE chats.last_sender_name END,
+		last_from_me = CASE WHEN excluded.last_message_ts >= chats.last_message_ts THEN excluded.last_from_me ELSE chats.last_from_me END,
+		last_message_ts = MAX(excluded.last_message_ts, chats.last_message_ts),
+		unread_count = CASE
+			WHEN excluded.last_from_me AND excluded.last_message_ts >= chats.last_message_ts THEN 0
+			ELSE chats.unread_count + excluded.unread_count
+		END,
+		display_name = CASE WHEN excluded.display_name <> '' THEN excluded.display_name ELSE chats.display_name END;
+	`
+
+	// Keeps the chat preview in step with edits and revokes of the message
+	// it shows.
+	UpdateChatLastMessageText = `
+	UPDATE chats SET last_message_text = ? WHERE last_message_id = ?;
+	`
+
+	// Rebuilds the last-message columns of a chat from messages, e.g. after
+	// its messages moved to another JID.
+	RefreshChatLastMessage = `
+	UPDATE chats SET
+		(last_message_id, last_message_text, last_message_ts, last_sender_jid, last_from_me) = (
+			SELECT message_id, COALESCE(text, ''), timestamp, sender_jid, is_from_me
+			FROM messages
+			WHERE chat_jid = chats.chat_jid
+			ORDER BY timestamp DESC
+			LIMIT 1
+		),
+		last_sender_name = ''
+	WHERE chat_jid = ? AND EXISTS (SELECT 1 FROM messages WHERE chat_jid = ?);
+	`
+
+	// Moves a chat row to a new JID unless one exists there already.
+	RenameChat = `
+	UPDATE OR IGNORE chats SET chat_jid = ? WHERE chat_jid = ?;
+	`
+	DeleteChat = `
+	DELETE FROM chats WHERE chat_jid = ?;
+	`
+
+	UpsertChatPinnedAt = `
+	INSERT INTO chats (chat_jid, pinned_at) VALUES (?, ?)
+	ON CONFLICT(chat_jid) DO UPDATE SET pinned_at = excluded.pinned_at;
+	`
+	UpsertChatArchivedAt = `
+	INSERT INTO chats (chat_jid, archived_at) VALUES (?, ?)
+	ON CONFLICT(chat_jid) DO UPDATE SET archived_at = excluded.archived_at;
+	`
+	UpsertChatMutedUntil = `
+	INSERT INTO chats (chat_jid, muted_until) VALUES (?, ?)
+	ON CONFLICT(chat_jid) DO UPDATE SET muted_until = excluded.muted_until;
+	`
+	SelectChatMutedUntil = `
+	SELECT muted_until FROM chats WHERE chat_jid = ?;
+	`
+
+	UpsertChatUnread = `
+	INSERT INTO chats (chat_jid, unread_count) VALUES (?, ?)
+	ON CONFLICT(chat_jid) DO UPDATE SET unread_count = excluded.unread_count;
+	`
+	// Marks a chat read, or unread (at least one unread message) when the
+	// second argument is false.
+	UpdateChatRead = `
+	UPDATE chats
+	SET unread_count = CASE WHEN ?2 THEN 0 ELSE MAX(unread_count, 1) END
+	WHERE chat_jid = ?1;
+	`
+	UpdateChatDisplayName = `
+	INSERT INTO chats (chat_jid, display_name) VALUES (?, ?)
+	ON CONFLICT(chat_jid) DO UPDATE SET display_name = excluded.display_name;
+	`
+
+	SelectChatExists = `
+	SELECT EXISTS (SELECT 1 FROM chats WHERE chat_jid = ? AND last_message_id <> '');
+	`
+
+	chatListColumns = `
+	SELECT chat_jid, last_message_id, last_message_text, last_message_ts, last_sender_jid, last_sender_name,
+		last_from_me, unread_count, pinned_at, archived_at, muted_until, display_name
+	FROM chats
+	`
+	// Chats with at least one message, newest first, walking
+	// idx_chats_last_ts. LIMIT -1 returns every row.
+	SelectChatListPage = chatListColumns + `
+	WHERE last_message_id <> ''
+	  AND chat_jid NOT LIKE '%@newsletter'
+	  AND chat_jid NOT LIKE '%@broadcast'
+	ORDER BY last_message_ts DESC
+	LIMIT ? OFFSET ?;
+	`
+	SelectChannelChatList = chatListColumns + `
+	WHERE last_message_id <> ''
+	  AND chat_jid LIKE '%@newsletter'
+	ORDER BY last_message_ts DESC;
+	`
+)
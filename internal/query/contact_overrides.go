@@ -0,0 +1,29 @@
+package query
+
+const (
+	// Local-only contact details in app.db: a nickname that takes precedence
+	// over WhatsApp names, free-form notes and a custom avatar color. Keyed by
+	// the contact's phone-number JID.
+	CreateContactOverridesTable = `
+	CREATE TABLE IF NOT EXISTS contact_overrides (
+		jid TEXT PRIMARY KEY,
+		nickname TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		color TEXT NOT NULL DEFAULT '',
+		updated_at INTEGER NOT NULL
+	);
+	`
+
+	UpsertContactOverride = `
+	INSERT OR REPLACE INTO contact_overrides (jid, nickname, notes, color, updated_at)
+	VALUES (?, ?, ?, ?, ?);
+	`
+
+	SelectAllContactOverrides = `
+	SELECT jid, nickname, notes, color FROM contact_overrides;
+	`
+
+	DeleteContactOverride = `
+	DELETE FROM contact_overrides WHERE jid = ?;
+	`
+)
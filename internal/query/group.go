@@ -62,4 +62,19 @@ const (
 	CountGroupsByParent = `
 	SELECT COUNT(*) FROM whats4linux_groups WHERE parent_jid = ?;
 	`
+
+	// Links (or, with empty values, unlinks) a stored group to a community.
+	UpdateGroupParent = `
+	UPDATE whats4linux_groups SET parent_jid = ?, parent_name = ? WHERE jid = ?;
+	`
+
+	// The announcement group is the community's default sub-group.
+	SelectAnnouncementGroupByParent = `
+	SELECT jid, name, topic, owner_jid, participant_count,
+	       COALESCE(parent_jid, ''), COALESCE(parent_name, ''),
+	       COALESCE(is_parent, 0), COALESCE(is_default_sub, 0)
+	FROM whats4linux_groups
+	WHERE parent_jid = ? AND is_default_sub = 1
+	LIMIT 1;
+	`
 )
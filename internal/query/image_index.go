@@ -1,23 +1,56 @@
 package query
 
 const (
-	// Image cache queries
+	// Media cache queries. The table predates caching anything but images,
+	// hence its name; kind tells the media types apart.
 	CreateImageIndexTable = `
 	CREATE TABLE IF NOT EXISTS image_index (
-		message_id TEXT PRIMARY KEY,
-		sha256     TEXT NOT NULL,
-		mime       TEXT,
-		width      INTEGER,
-		height     INTEGER,
-		created_at INTEGER
+		message_id  TEXT PRIMARY KEY,
+		sha256      TEXT NOT NULL,
+		mime        TEXT,
+		width       INTEGER,
+		height      INTEGER,
+		created_at  INTEGER,
+		kind        TEXT NOT NULL DEFAULT 'image',
+		size        INTEGER NOT NULL DEFAULT 0,
+		last_access INTEGER NOT NULL DEFAULT 0
 	);
 	CREATE INDEX IF NOT EXISTS idx_sha ON image_index (sha256);
 	`
 
+	// AddImageIndexKind / AddImageIndexSize / AddImageIndexLastAccess migrate
+	// image-only caches. The caller ignores the "duplicate column" error once
+	// the columns exist, and backfills the new columns the first time.
+	AddImageIndexKind = `
+	ALTER TABLE image_index ADD COLUMN kind TEXT NOT NULL DEFAULT 'image';
+	`
+	AddImageIndexSize = `
+	ALTER TABLE image_index ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+	`
+	AddImageIndexLastAccess = `
+	ALTER TABLE image_index ADD COLUMN last_access INTEGER NOT NULL DEFAULT 0;
+	`
+	BackfillAvatarKind = `
+	UPDATE image_index SET kind = 'avatar' WHERE message_id LIKE 'avatar\_%' ESCAPE '\';
+	`
+	BackfillLastAccess = `
+	UPDATE image_index SET last_access = COALESCE(created_at, 0) WHERE last_access = 0;
+	`
+	SelectUnsizedFiles = `
+	SELECT DISTINCT sha256, mime FROM image_index WHERE size = 0;
+	`
+	UpdateFileSize = `
+	UPDATE image_index SET size = ? WHERE sha256 = ? AND mime = ?;
+	`
+
+	CreateImageIndexKindIndex = `
+	CREATE INDEX IF NOT EXISTS idx_image_index_kind_access ON image_index (kind, last_access);
+	`
+
 	SaveImageIndex = `
 	INSERT OR REPLACE INTO image_index
-	(message_id, sha256, mime, width, height, created_at)
-	VALUES (?, ?, ?, ?, ?, ?)
+	(message_id, sha256, mime, width, height, created_at, kind, size, last_access)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	DeleteImageIndex = `
@@ -25,8 +58,10 @@ const (
 	WHERE message_id = ?
 	`
 
+	DeleteAllImageIndex = `DELETE FROM image_index;`
+
 	GetImageByID = `
-	SELECT message_id, sha256, mime, width, height, created_at
+	SELECT message_id, sha256, mime, width, height, created_at, kind, size, last_access
 	FROM image_index
 	WHERE message_id = ?
 	`
@@ -35,8 +70,34 @@ const (
 	// Use it with a dynamically built placeholder list, e.g.
 	// q := query.GetImagesByIDsPrefix + strings.Join(placeholders, ",") + ")"
 	GetImagesByIDsPrefix = `
-	SELECT message_id, sha256, mime, width, height, created_at
+	SELECT message_id, sha256, mime, width, height, created_at, kind, size, last_access
 	FROM image_index
 	WHERE message_id IN (
 	`
+
+	// TouchImagesByIDsPrefix marks entries as used, for LRU eviction. The
+	// first argument is the access time; build the list like
+	// GetImagesByIDsPrefix.
+	TouchImagesByIDsPrefix = `
+	UPDATE image_index SET last_access = ?
+	WHERE message_id IN (
+	`
+
+	CountFileReferences = `
+	SELECT COUNT(*) FROM image_index WHERE sha256 = ? AND mime = ?
+	`
+
+	// SelectKindUsage sums the files of one kind, counting each file once
+	// however many messages share it.
+	SelectKindUsage = `
+	SELECT COALESCE(SUM(size), 0) FROM (
+		SELECT MAX(size) AS size FROM image_index WHERE kind = ? GROUP BY sha256, mime
+	)
+	`
+
+	SelectEvictionCandidates = `
+	SELECT message_id, sha256, mime, size FROM image_index
+	WHERE kind = ?
+	ORDER BY last_access ASC
+	`
 )
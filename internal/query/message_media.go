@@ -15,7 +15,11 @@ const (
 		height INTEGER,
 		file_name TEXT,
 		gif_playback INTEGER DEFAULT 0,
-		thumbnail BLOB
+		thumbnail BLOB,
+		seconds INTEGER,
+		ptt INTEGER DEFAULT 0,
+		waveform BLOB,
+		file_length INTEGER
 	);
 	`
 
@@ -30,10 +34,26 @@ const (
 	ALTER TABLE message_media ADD COLUMN thumbnail BLOB;
 	`
 
+	// Audio/video length and voice note details.
+	AddSecondsColumn = `
+	ALTER TABLE message_media ADD COLUMN seconds INTEGER;
+	`
+	AddPTTColumn = `
+	ALTER TABLE message_media ADD COLUMN ptt INTEGER DEFAULT 0;
+	`
+	AddWaveformColumn = `
+	ALTER TABLE message_media ADD COLUMN waveform BLOB;
+	`
+	// AddFileLengthColumn stores the plaintext size, known before download.
+	AddFileLengthColumn = `
+	ALTER TABLE message_media ADD COLUMN file_length INTEGER;
+	`
+
 	InsertMessageMedia = `
 	INSERT OR REPLACE INTO message_media
-	(message_id, type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name, gif_playback, thumbnail)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	(message_id, type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name, gif_playback, thumbnail,
+	 seconds, ptt, waveform, file_length)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`
 
 	SelectGifPlaybackByMessageID = `
@@ -55,8 +75,29 @@ const (
 	`
 
 	SelectMessageMediaByMessageID = `
-	SELECT type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name
+	SELECT type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name, file_length
 	FROM message_media
 	WHERE message_id = ?;
 	`
+
+	// SelectRecentMediaMessageIDs lists messages with media sent since a
+	// time, newest first, for the auto-download prefetcher.
+	SelectRecentMediaMessageIDs = `
+	SELECT m.message_id
+	FROM messages m
+	JOIN message_media mm ON mm.message_id = m.message_id
+	WHERE m.timestamp >= ?
+	ORDER BY m.timestamp DESC
+	LIMIT ?;
+	`
+
+	// SelectChatMediaMessageIDs lists a chat's messages with media, oldest
+	// first.
+	SelectChatMediaMessageIDs = `
+	SELECT m.message_id
+	FROM messages m
+	JOIN message_media mm ON mm.message_id = m.message_id
+	WHERE m.chat_jid = ?
+	ORDER BY m.timestamp ASC, m.message_id ASC;
+	`
 )
@@ -44,6 +44,7 @@ const (
 	SelectDecodedMessageByChatAndID = `
 	SELECT m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded,
 	       mm.type, mm.file_name, mm.width, mm.height, mm.gif_playback,
+	       mm.seconds, mm.ptt, mm.waveform,
 	       lp.url, lp.title, lp.description,
 	       CASE WHEN length(COALESCE(lp.thumbnail, x'')) > 0 OR
 	                      (COALESCE(lp.direct_path, '') <> '' AND length(COALESCE(lp.media_key, x'')) > 0)
@@ -71,6 +72,7 @@ const (
 	SelectMessagesByChatBeforeCursor = `
 	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded,
 	       mm.type, mm.file_name, mm.width, mm.height, mm.gif_playback,
+	       mm.seconds, mm.ptt, mm.waveform,
 	       lp.url, lp.title, lp.description,
 	       CASE WHEN length(COALESCE(lp.thumbnail, x'')) > 0 OR
 	                      (COALESCE(lp.direct_path, '') <> '' AND length(COALESCE(lp.media_key, x'')) > 0)
@@ -91,6 +93,7 @@ const (
 	SelectLatestMessagesByChat = `
 	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded,
 	       mm.type, mm.file_name, mm.width, mm.height, mm.gif_playback,
+	       mm.seconds, mm.ptt, mm.waveform,
 	       lp.url, lp.title, lp.description,
 	       CASE WHEN length(COALESCE(lp.thumbnail, x'')) > 0 OR
 	                      (COALESCE(lp.direct_path, '') <> '' AND length(COALESCE(lp.media_key, x'')) > 0)
@@ -124,41 +127,22 @@ const (
 	LIMIT 1
 	`
 
-	// Chat list from messages.db
-	SelectDecodedChatList = `
-	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded, mm.type, mm.file_name
-	FROM (
-		SELECT 
-			message_id, chat_jid, sender_jid, timestamp, is_from_me, text, reply_to_message_id, edited, forwarded,
-			ROW_NUMBER() OVER (
-				PARTITION BY chat_jid
-				ORDER BY timestamp DESC
-			) AS rn
-		FROM messages
-	) AS m
-	LEFT JOIN message_media AS mm ON mm.message_id = m.message_id
-	WHERE rn = 1
-	  AND m.chat_jid NOT LIKE '%@newsletter'
-	  AND m.chat_jid NOT LIKE '%@broadcast'
-	ORDER BY m.timestamp DESC;
+	// Oldest real message of a chat, used to anchor on-demand history
+	// requests. System entries (e.g. calls) have no WhatsApp message ID.
+	SelectOldestMessageInChat = `
+	SELECT message_id, sender_jid, timestamp, is_from_me
+	FROM messages
+	WHERE chat_jid = ? AND type <> ?
+	ORDER BY timestamp ASC, message_id ASC
+	LIMIT 1;
 	`
 
-	// Same as SelectDecodedChatList but only Channels (newsletter feeds).
-	SelectDecodedChannelList = `
-	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded, mm.type, mm.file_name
-	FROM (
-		SELECT
-			message_id, chat_jid, sender_jid, timestamp, is_from_me, text, reply_to_message_id, edited, forwarded,
-			ROW_NUMBER() OVER (
-				PARTITION BY chat_jid
-				ORDER BY timestamp DESC
-			) AS rn
-		FROM messages
-	) AS m
-	LEFT JOIN message_media AS mm ON mm.message_id = m.message_id
-	WHERE rn = 1
-	  AND m.chat_jid LIKE '%@newsletter'
-	ORDER BY m.timestamp DESC;
+	SelectMessageExists = `
+	SELECT EXISTS (SELECT 1 FROM messages WHERE message_id = ?);
+	`
+
+	MarkMessageDeleted = `
+	UPDATE messages SET text = ?, has_media = 0 WHERE message_id = ?
 	`
 
 	UpdateMessagesChat = `
@@ -0,0 +1,76 @@
+package query
+
+const (
+	// Channel (newsletter) metadata cache in app.db, refreshed on connect and
+	// kept current by newsletter join/leave/mute events.
+	CreateNewslettersTable = `
+	CREATE TABLE IF NOT EXISTS whats4linux_newsletters (
+		jid TEXT PRIMARY KEY,
+		name TEXT,
+		description TEXT,
+		invite_code TEXT,
+		subscriber_count INTEGER DEFAULT 0,
+		verified INTEGER DEFAULT 0,
+		muted INTEGER DEFAULT 0,
+		role TEXT DEFAULT '',
+		updated_at INTEGER
+	);
+	`
+
+	DeleteAllNewsletters = `
+	DELETE FROM whats4linux_newsletters;
+	`
+
+	InsertOrReplaceNewsletter = `
+	INSERT OR REPLACE INTO whats4linux_newsletters
+	(jid, name, description, invite_code, subscriber_count, verified, muted, role, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	SelectAllNewsletters = `
+	SELECT jid, COALESCE(name, ''), COALESCE(description, ''), COALESCE(invite_code, ''),
+	       COALESCE(subscriber_count, 0), COALESCE(verified, 0), COALESCE(muted, 0), COALESCE(role, '')
+	FROM whats4linux_newsletters
+	ORDER BY name COLLATE NOCASE;
+	`
+
+	SelectNewsletterByJID = `
+	SELECT jid, COALESCE(name, ''), COALESCE(description, ''), COALESCE(invite_code, ''),
+	       COALESCE(subscriber_count, 0), COALESCE(verified, 0), COALESCE(muted, 0), COALESCE(role, '')
+	FROM whats4linux_newsletters
+	WHERE jid = ?;
+	`
+
+	UpdateNewsletterMuted = `
+	UPDATE whats4linux_newsletters SET muted = ? WHERE jid = ?;
+	`
+
+	DeleteNewsletter = `
+	DELETE FROM whats4linux_newsletters WHERE jid = ?;
+	`
+
+	// Channel messages are addressed by a per-channel server ID (needed for
+	// reactions and backfill cursors) rather than the message ID. Lives in
+	// messages.db next to the messages themselves.
+	CreateNewsletterMessagesTable = `
+	CREATE TABLE IF NOT EXISTS newsletter_messages (
+		message_id TEXT PRIMARY KEY,
+		chat_jid TEXT NOT NULL,
+		server_id INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_newsletter_messages_chat_server ON newsletter_messages(chat_jid, server_id);
+	`
+
+	UpsertNewsletterMessage = `
+	INSERT OR REPLACE INTO newsletter_messages (message_id, chat_jid, server_id)
+	VALUES (?, ?, ?);
+	`
+
+	SelectNewsletterServerID = `
+	SELECT server_id FROM newsletter_messages WHERE message_id = ?;
+	`
+
+	SelectOldestNewsletterServerID = `
+	SELECT COALESCE(MIN(server_id), 0) FROM newsletter_messages WHERE chat_jid = ?;
+	`
+)
@@ -1,22 +1,14 @@
 package query
 
 const (
+	// pinned_chats predates chats.pinned_at; it is only read to migrate
+	// older databases.
 	CreatePinnedChatsTable = `
 	CREATE TABLE IF NOT EXISTS pinned_chats (
 		chat_jid TEXT PRIMARY KEY,
 		pinned_at INTEGER NOT NULL
 	);
 	`
-	UpsertPinnedChat = `
-	INSERT OR REPLACE INTO pinned_chats (chat_jid, pinned_at)
-	VALUES (?, ?);
-	`
-	DeletePinnedChat = `
-	DELETE FROM pinned_chats WHERE chat_jid = ?;
-	`
-	SelectPinnedChats = `
-	SELECT chat_jid, pinned_at FROM pinned_chats;
-	`
 	// Pinned messages joined with their text for the chat banner. Expired pins
 	// (expiry seconds after pinned_at) are filtered out.
 	GetChatPinnedMessagesWithText = `
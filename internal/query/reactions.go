@@ -18,6 +18,15 @@ const (
 	VALUES (?, ?, ?)
 	`
 
+	// InsertReactionIfMessageExists is used for history batches, where the
+	// reacted-to message may not have been synced; a plain insert would fail
+	// the whole batch on the foreign key.
+	InsertReactionIfMessageExists = `
+	INSERT INTO reactions (message_id, sender_id, emoji)
+	SELECT ?1, ?2, ?3
+	WHERE EXISTS (SELECT 1 FROM messages WHERE message_id = ?1)
+	`
+
 	DeleteReaction = `
 	DELETE FROM reactions
 	WHERE message_id = ? AND sender_id = ? AND emoji = ?
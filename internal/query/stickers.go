@@ -0,0 +1,55 @@
+package query
+
+const (
+	// stickers remembers every sticker sent or received, keyed by the hash
+	// of its plaintext, pointing at the latest message that carried it (whose
+	// message_media row has the keys to download or resend it).
+	CreateStickersTable = `
+	CREATE TABLE IF NOT EXISTS stickers (
+		file_sha256 BLOB PRIMARY KEY,
+		message_id TEXT NOT NULL,
+		chat_jid TEXT NOT NULL,
+		is_animated INTEGER DEFAULT 0,
+		last_used INTEGER NOT NULL,
+		favorited_at INTEGER DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_stickers_last_used ON stickers(last_used DESC);
+	`
+
+	UpsertSticker = `
+	INSERT INTO stickers (file_sha256, message_id, chat_jid, is_animated, last_used)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(file_sha256) DO UPDATE SET
+		message_id = excluded.message_id,
+		chat_jid = excluded.chat_jid,
+		last_used = excluded.last_used
+	WHERE excluded.last_used >= stickers.last_used;
+	`
+
+	SelectRecentStickers = `
+	SELECT s.file_sha256, s.message_id, s.chat_jid, s.is_animated, s.last_used, s.favorited_at
+	FROM stickers s
+	JOIN message_media mm ON mm.message_id = s.message_id
+	ORDER BY s.last_used DESC
+	LIMIT ?;
+	`
+
+	SelectFavoriteStickers = `
+	SELECT s.file_sha256, s.message_id, s.chat_jid, s.is_animated, s.last_used, s.favorited_at
+	FROM stickers s
+	JOIN message_media mm ON mm.message_id = s.message_id
+	WHERE s.favorited_at > 0
+	ORDER BY s.favorited_at DESC;
+	`
+
+	UpdateStickerFavorite = `
+	UPDATE stickers SET favorited_at = ? WHERE file_sha256 = ?;
+	`
+
+	SelectStickerMedia = `
+	SELECT s.is_animated, mm.url, mm.mimetype, mm.direct_path, mm.media_key, mm.file_sha256, mm.file_enc_sha256, mm.width, mm.height, mm.file_length
+	FROM stickers s
+	JOIN message_media mm ON mm.message_id = s.message_id
+	WHERE s.file_sha256 = ?;
+	`
+)
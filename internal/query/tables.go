@@ -0,0 +1,15 @@
+package query
+
+const (
+	// SelectTables lists a database's own tables, to empty it.
+	SelectTables = `
+	SELECT name FROM sqlite_master
+	WHERE type = 'table' AND name NOT LIKE 'sqlite_%';
+	`
+
+	// DeferForeignKeys lets a transaction empty tables in any order.
+	DeferForeignKeys = `PRAGMA defer_foreign_keys = ON;`
+
+	// Vacuum rebuilds the file so deleted rows don't linger on disk.
+	Vacuum = `VACUUM;`
+)
@@ -1,18 +1,43 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// ErrMediaNotFound is returned by a MediaSource for messages without media.
+var ErrMediaNotFound = errors.New("media not found")
+
+// Media is a message's media as served under /media/.
+type Media struct {
+	Content io.ReadSeekCloser
+	Mime    string
+	// Size is the full length, or -1 while a download of unknown length
+	// is still running.
+	Size    int64
+	ModTime time.Time
+}
+
+// MediaSource opens message media, downloading it if need be. Content may
+// still be downloading, in which case reads wait for it until ctx is done.
+type MediaSource interface {
+	OpenMedia(ctx context.Context, messageID string) (*Media, error)
+}
+
 type AssetFileServer struct {
 	http.Handler
+	media MediaSource
 }
 
-func NewAssetFileServer() *AssetFileServer {
-	return &AssetFileServer{}
+func NewAssetFileServer(media MediaSource) *AssetFileServer {
+	return &AssetFileServer{media: media}
 }
 
 func (h *AssetFileServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
@@ -38,5 +63,43 @@ func (h *AssetFileServer) ServeHTTP(res http.ResponseWriter, req *http.Request)
 		http.ServeFile(res, req, fullPath)
 		return
 	}
+	if strings.HasPrefix(req.URL.Path, "/media/") {
+		h.serveMedia(res, req, strings.TrimPrefix(req.URL.Path, "/media/"))
+		return
+	}
 	res.WriteHeader(http.StatusNotFound)
 }
+
+// serveMedia serves /media/<messageID>, with Range support once the size
+// is known. Media of unknown size is streamed whole as it downloads.
+func (h *AssetFileServer) serveMedia(res http.ResponseWriter, req *http.Request, messageID string) {
+	if messageID == "" || filepath.Base(messageID) != messageID {
+		res.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if h.media == nil {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	media, err := h.media.OpenMedia(req.Context(), messageID)
+	if errors.Is(err, ErrMediaNotFound) {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Failed to open media", messageID+":", err)
+		res.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer media.Content.Close()
+
+	res.Header().Set("Content-Type", media.Mime)
+	if media.Size >= 0 {
+		http.ServeContent(res, req, "", media.ModTime, media.Content)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		io.Copy(res, media.Content)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeMedia map[string]string
+
+func (f fakeMedia) OpenMedia(ctx context.Context, messageID string) (*Media, error) {
+	data, ok := f[messageID]
+	if !ok {
+		return nil, ErrMediaNotFound
+	}
+	return &Media{
+		Content: nopCloser{strings.NewReader(data)},
+		Mime:    "audio/ogg",
+		Size:    int64(len(data)),
+		ModTime: time.Unix(1, 0),
+	}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+func TestServeMediaRange(t *testing.T) {
+	h := NewAssetFileServer(fakeMedia{"msg": "0123456789"})
+
+	req := httptest.NewRequest(http.MethodGet, "/media/msg", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "audio/ogg" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	for path, want := range map[string]int{
+		"/media/missing": http.StatusNotFound,
+		"/media/":        http.StatusBadRequest,
+		"/media/a/b":     http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+)
+
+// ReplaceBlocklist overwrites the local blocklist with a full copy from the
+// server.
+func (ms *MessageStore) ReplaceBlocklist(jids []string) error {
+	now := time.Now().Unix()
+	return ms.runSync(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query.DeleteAllBlockedContacts); err != nil {
+			return err
+		}
+		for _, jid := range jids {
+			if _, err := tx.Exec(query.InsertBlockedContact, jid, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetBlocked adds a contact to or removes it from the local blocklist.
+func (ms *MessageStore) SetBlocked(jid string, blocked bool) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		if !blocked {
+			_, err := tx.Exec(query.DeleteBlockedContact, jid)
+			return err
+		}
+		_, err := tx.Exec(query.InsertBlockedContact, jid, time.Now().Unix())
+		return err
+	})
+}
+
+// IsBlocked reports whether a contact is on the local blocklist.
+func (ms *MessageStore) IsBlocked(jid string) bool {
+	var one int
+	return ms.db.QueryRow(query.SelectBlockedContact, jid).Scan(&one) == nil
+}
+
+// GetBlockedJIDs returns the local blocklist, most recently blocked first.
+func (ms *MessageStore) GetBlockedJIDs() ([]string, error) {
+	rows, err := ms.db.Query(query.SelectAllBlockedContacts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jids := []string{}
+	for rows.Next() {
+		var jid string
+		if err := rows.Scan(&jid); err != nil {
+			return nil, err
+		}
+		jids = append(jids, jid)
+	}
+	return jids, rows.Err()
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// CallLogEntry is a row of the call history.
+type CallLogEntry struct {
+	CallID     string `json:"call_id"`
+	ChatJID    string `json:"chat_jid"`
+	CallerJID  string `json:"caller_jid"`
+	CreatorJID string `json:"-"`
+	GroupJID   string `json:"group_jid,omitempty"`
+	IsVideo    bool   `json:"is_video"`
+	StartedAt  int64  `json:"started_at"`
+	AcceptedAt int64  `json:"accepted_at"`
+	EndedAt    int64  `json:"ended_at"`
+	Rejected   bool   `json:"rejected"`
+	EndReason  string `json:"end_reason,omitempty"`
+	// Duration is in seconds; 0 for calls that were never picked up.
+	Duration int64 `json:"duration"`
+	Missed   bool  `json:"missed"`
+}
+
+func scanCallLogEntry(scanner interface{ Scan(dest ...any) error }) (*CallLogEntry, error) {
+	var e CallLogEntry
+	err := scanner.Scan(
+		&e.CallID, &e.ChatJID, &e.CallerJID, &e.CreatorJID, &e.GroupJID, &e.IsVideo,
+		&e.StartedAt, &e.AcceptedAt, &e.EndedAt, &e.Rejected, &e.EndReason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if e.AcceptedAt > 0 && e.EndedAt >= e.AcceptedAt {
+		e.Duration = e.EndedAt - e.AcceptedAt
+	}
+	e.Missed = e.EndedAt > 0 && e.AcceptedAt == 0 && !e.Rejected
+	return &e, nil
+}
+
+// CallTimelineID is the messages-table ID of a call's timeline entry.
+func CallTimelineID(callID string) string {
+	return "call-" + callID
+}
+
+func formatCallDuration(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	if d >= time.Hour {
+		return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// callKind is e.g. "voice call" or "group video call".
+func callKind(e *CallLogEntry) string {
+	kind := "voice call"
+	if e.IsVideo {
+		kind = "video call"
+	}
+	if e.GroupJID != "" {
+		kind = "group " + kind
+	}
+	return kind
+}
+
+func answered(e *CallLogEntry) bool {
+	return e.AcceptedAt > 0 && !e.Rejected
+}
+
+// CallSummary is the one-line description of a call, e.g. "Missed voice call"
+// or "Video call · 4:05".
+func CallSummary(e *CallLogEntry) string {
+	kind := callKind(e)
+	switch {
+	case e.Rejected:
+		return "Declined " + kind
+	case !answered(e):
+		return "Missed " + kind
+	}
+	return strings.ToUpper(kind[:1]) + kind[1:] + " · " + formatCallDuration(e.Duration)
+}
+
+// describeCall renders the timeline card for a finished call.
+func describeCall(e *CallLogEntry) string {
+	icon := "📞"
+	if e.IsVideo {
+		icon = "📹"
+	}
+	if !answered(e) {
+		return `<div class="msg-card msg-call">` + icon + ` <b>` + esc(CallSummary(e)) + `</b></div>`
+	}
+	kind := callKind(e)
+	return `<div class="msg-card msg-call">` + icon + ` <b>` + esc(strings.ToUpper(kind[:1])+kind[1:]) + `</b>` +
+		`<div class="msg-card-note">` + formatCallDuration(e.Duration) + `</div></div>`
+}
+
+// RecordCallOffer stores a ringing call. Repeated offers for the same call
+// are ignored.
+func (ms *MessageStore) RecordCallOffer(e CallLogEntry) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.InsertCallOffer,
+			e.CallID, e.ChatJID, e.CallerJID, e.CreatorJID, e.GroupJID, e.IsVideo, e.StartedAt)
+		return err
+	})
+}
+
+// MarkCallAccepted records that a call was picked up (on another device).
+func (ms *MessageStore) MarkCallAccepted(callID string, acceptedAt int64) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.UpdateCallAccepted, acceptedAt, callID)
+		return err
+	})
+}
+
+// FinishCall closes a call and adds its entry to the chat timeline in the
+// same transaction. It returns the finished entry, or nil when the call is
+// unknown or was already finished (terminate events can repeat).
+func (ms *MessageStore) FinishCall(callID string, endedAt int64, reason string, rejected bool) (*CallLogEntry, error) {
+	var entry *CallLogEntry
+	err := ms.runSync(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query.UpdateCallEnded, endedAt, reason, rejected, callID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		e, err := scanCallLogEntry(tx.QueryRow(query.SelectCallByID, callID))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Stmt(ms.stmtInsertMessage).Exec(
+			CallTimelineID(e.CallID),
+			e.ChatJID,
+			e.CallerJID,
+			e.StartedAt,
+			false,
+			describeCall(e),
+			false,
+			"",
+			false,
+			false,
+			mtypes.MessageTypeCall,
+		)
+		if err != nil {
+			return err
+		}
+		// A missed call counts as unread, like on the phone.
+		unread := 0
+		if e.Missed {
+			unread = 1
+		}
+		_, err = tx.Stmt(ms.stmtUpsertChat).Exec(
+			e.ChatJID,
+			CallTimelineID(e.CallID),
+			CallSummary(e),
+			e.StartedAt,
+			e.CallerJID,
+			"",
+			false,
+			unread,
+			"",
+		)
+		if err != nil {
+			return err
+		}
+		entry = e
+		return nil
+	})
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetCall returns a single call log entry.
+func (ms *MessageStore) GetCall(callID string) (*CallLogEntry, error) {
+	return scanCallLogEntry(ms.db.QueryRow(query.SelectCallByID, callID))
+}
+
+// GetCallLog returns the call history, newest first.
+func (ms *MessageStore) GetCallLog(limit, offset int) ([]CallLogEntry, error) {
+	rows, err := ms.db.Query(query.SelectCallLog, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []CallLogEntry{}
+	for rows.Next() {
+		e, err := scanCallLogEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ChatMessage represents a chat in the chat list
+type ChatMessage struct {
+	JID           types.JID
+	LastMessageID string
+	MessageText   string
+	MessageTime   int64
+	// Sender is "You" for our own messages, otherwise the sender's push name
+	// or, without one, the number.
+	Sender         string
+	SenderJID      string
+	SenderPushName string
+	FromMe         bool
+	Unread         int
+	// PinnedAt and ArchivedAt are 0 when the chat isn't pinned / archived.
+	PinnedAt   int64
+	ArchivedAt int64
+	// MutedUntil is unix seconds, -1 for forever and 0 when not muted.
+	MutedUntil int64
+	// DisplayName is the name WhatsApp gave the chat (history sync name or
+	// the contact's push name); callers prefer their own contact data.
+	DisplayName string
+}
+
+// Muted reports whether the chat is muted right now.
+func (cm ChatMessage) Muted() bool {
+	return isMuted(cm.MutedUntil)
+}
+
+// backfillChats fills a new chats table from messages and the older
+// pin/archive/mute tables. It does nothing once chats has rows.
+func backfillChats(tx *sql.Tx) error {
+	var n int
+	if err := tx.QueryRow(query.CountChats).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	for _, q := range []string{
+		query.BackfillChatsFromMessages,
+		query.BackfillChatsPinned,
+		query.BackfillChatsArchived,
+		query.BackfillChatsMuted,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertChat records a stored message on its chat row.
+func (r *messageRow) upsertChat(st *txStatements, unread int) error {
+	info := r.info
+	_, err := st.upsertChat.Exec(
+		info.Chat.String(),
+		info.ID,
+		r.preview,
+		info.Timestamp.Unix(),
+		info.Sender.String(),
+		info.PushName,
+		info.IsFromMe,
+		unread,
+		r.displayName,
+	)
+	return err
+}
+
+// moveChat moves a chat row (pin, mute and unread state included) from one
+// JID to another after its messages moved, then rebuilds its last message.
+func moveChat(tx *sql.Tx, from, to string) error {
+	if _, err := tx.Exec(query.RenameChat, to, from); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query.DeleteChat, from); err != nil {
+		return err
+	}
+	_, err := tx.Exec(query.RefreshChatLastMessage, to, to)
+	return err
+}
+
+// hasChat reports whether a chat has any message in the chat list.
+func (ms *MessageStore) hasChat(chat types.JID) bool {
+	var exists bool
+	if err := ms.db.QueryRow(query.SelectChatExists, chat.String()).Scan(&exists); err != nil {
+		log.Println("Failed to look up chat:", err)
+	}
+	return exists
+}
+
+// GetChatList returns the regular chat list (channels/broadcast excluded),
+// newest first.
+func (ms *MessageStore) GetChatList() []ChatMessage {
+	return ms.GetChatListPage(-1, 0)
+}
+
+// GetChatListPage returns limit chats of the chat list starting at offset,
+// newest first. A negative limit returns all of them.
+func (ms *MessageStore) GetChatListPage(limit, offset int) []ChatMessage {
+	return ms.chatListFromQuery(query.SelectChatListPage, limit, offset)
+}
+
+// GetChannelList returns only Channel (newsletter) feeds.
+func (ms *MessageStore) GetChannelList() []ChatMessage {
+	return ms.chatListFromQuery(query.SelectChannelChatList)
+}
+
+func (ms *MessageStore) chatListFromQuery(q string, args ...any) []ChatMessage {
+	rows, err := ms.db.Query(q, args...)
+	if err != nil {
+		log.Println("Failed to query chat list:", err)
+		return []ChatMessage{}
+	}
+	defer rows.Close()
+
+	chatList := []ChatMessage{}
+	for rows.Next() {
+		var (
+			cm      ChatMessage
+			chatJID string
+		)
+		if err := rows.Scan(
+			&chatJID,
+			&cm.LastMessageID,
+			&cm.MessageText,
+			&cm.MessageTime,
+			&cm.SenderJID,
+			&cm.SenderPushName,
+			&cm.FromMe,
+			&cm.Unread,
+			&cm.PinnedAt,
+			&cm.ArchivedAt,
+			&cm.MutedUntil,
+			&cm.DisplayName,
+		); err != nil {
+			log.Println("Failed to scan chat list row:", err)
+			continue
+		}
+		jid, err := types.ParseJID(chatJID)
+		if err != nil {
+			continue
+		}
+		cm.JID = jid
+		cm.Sender = chatSender(cm.FromMe, cm.SenderPushName, cm.SenderJID)
+		chatList = append(chatList, cm)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Failed to read chat list:", err)
+	}
+	return chatList
+}
+
+func chatSender(fromMe bool, pushName, senderJID string) string {
+	switch {
+	case fromMe:
+		return "You"
+	case pushName != "":
+		return pushName
+	}
+	if jid, err := types.ParseJID(senderJID); err == nil {
+		return jid.User
+	}
+	return senderJID
+}
+
+// SetChatPinned stores whether a chat is pinned in the chat list.
+func (ms *MessageStore) SetChatPinned(chatJID string, pinned bool, ts int64) error {
+	if !pinned {
+		ts = 0
+	}
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.UpsertChatPinnedAt, chatJID, ts)
+		return err
+	})
+}
+
+// SetChatArchived stores whether a chat is archived.
+func (ms *MessageStore) SetChatArchived(chatJID string, archived bool, ts int64) error {
+	if !archived {
+		ts = 0
+	}
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.UpsertChatArchivedAt, chatJID, ts)
+		return err
+	})
+}
+
+// SetChatRead clears a chat's unread count, or marks it unread (at least one
+// unread message) when read is false.
+func (ms *MessageStore) SetChatRead(chatJID string, read bool) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.UpdateChatRead, chatJID, read)
+		return err
+	})
+}
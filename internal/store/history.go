@@ -0,0 +1,218 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// OldestMessage returns the oldest stored message of a chat in the shape
+// whatsmeow needs to anchor an on-demand history request. It returns
+// sql.ErrNoRows when nothing is stored for the chat.
+func (ms *MessageStore) OldestMessage(chatJID string) (*types.MessageInfo, error) {
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		id, sender string
+		ts         int64
+		isFromMe   bool
+	)
+	err = ms.db.QueryRow(query.SelectOldestMessageInChat, chatJID, mtypes.MessageTypeCall).Scan(&id, &sender, &ts, &isFromMe)
+	if err != nil {
+		return nil, err
+	}
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, IsFromMe: isFromMe},
+		ID:            id,
+		Timestamp:     time.Unix(ts, 0),
+	}
+	if senderJID, err := types.ParseJID(sender); err == nil {
+		info.Sender = senderJID
+	}
+	return info, nil
+}
+
+// historyBatchSize is how many writes a history-sync transaction holds.
+// Batches go through the bulk queue, so live messages wait for at most one.
+const historyBatchSize = 500
+
+// HistoryMessage is a message from a history-sync conversation together with
+// its rendered HTML.
+type HistoryMessage struct {
+	Event      *events.Message
+	ParsedHTML string
+}
+
+// HistoryChat is the chat-level state a history-sync conversation carries.
+type HistoryChat struct {
+	// Name is the chat's name on the phone (contact or group name).
+	Name string
+	// Unread is the phone's unread count, or -1 when the sync doesn't say.
+	Unread int
+}
+
+// historyWrite is one write of a history batch.
+type historyWrite func(tx *sql.Tx, st *txStatements) error
+
+// IngestHistoryConversation stores the messages of one history-sync
+// conversation. It applies the same rules as ProcessMessageEvent, but
+// writes in large transactions on the bulk queue, and takes the chat's name
+// and unread count from the phone. It returns how many messages were stored.
+func (ms *MessageStore) IngestHistoryConversation(ctx context.Context, sd store.LIDStore, msgs []HistoryMessage, chat HistoryChat) int {
+	if len(msgs) == 0 {
+		return 0
+	}
+	ms.migrateChatlist(ctx, sd, msgs[0].Event.Info.Chat)
+
+	// Resolve each LID once per conversation instead of once per message.
+	canonical := make(map[types.JID]types.JID)
+	canonicalise := func(jid *types.JID) {
+		if c, ok := canonical[*jid]; ok {
+			*jid = c
+			return
+		}
+		orig := *jid
+		updateCanonicalJID(ctx, sd, jid)
+		canonical[orig] = *jid
+	}
+
+	var (
+		inserts, updates []historyWrite
+		reacted          []string
+	)
+	for i := range msgs {
+		hm := &msgs[i]
+		msg := hm.Event
+		canonicalise(&msg.Info.Chat)
+		canonicalise(&msg.Info.Sender)
+
+		protoMsg := msg.Message.GetProtocolMessage()
+		switch {
+		case msg.Message.GetReactionMessage() != nil:
+			reaction := msg.Message.GetReactionMessage()
+			targetID := reaction.GetKey().GetID()
+			emoji := reaction.GetText()
+			sender := msg.Info.Sender.String()
+			reacted = append(reacted, targetID)
+			updates = append(updates, func(tx *sql.Tx, st *txStatements) error {
+				if _, err := st.deleteReaction.Exec(targetID, sender); err != nil || emoji == "" {
+					return err
+				}
+				_, err := st.insertReaction.Exec(targetID, sender, emoji)
+				return err
+			})
+		case protoMsg != nil && protoMsg.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT:
+			targetID := protoMsg.GetKey().GetID()
+			newContent := protoMsg.GetEditedMessage()
+			if targetID == "" || newContent == nil {
+				continue
+			}
+			parsedHTML := hm.ParsedHTML
+			updates = append(updates, func(tx *sql.Tx, _ *txStatements) error {
+				return ms.updateMessageContent(tx, targetID, newContent, parsedHTML)
+			})
+		case protoMsg != nil && protoMsg.GetType() == waE2E.ProtocolMessage_REVOKE:
+			targetID := protoMsg.GetKey().GetID()
+			if targetID == "" {
+				continue
+			}
+			updates = append(updates, func(tx *sql.Tx, _ *txStatements) error {
+				return markMessageDeleted(tx, targetID)
+			})
+		case ShouldSkipMessage(msg.Message) && msg.Message.GetPinInChatMessage() == nil:
+			continue
+		default:
+			row := buildMessageRow(&msg.Info, msg.Message, hm.ParsedHTML)
+			inserts = append(inserts, row.write)
+		}
+	}
+
+	// Rows first, so edits, revokes and reactions find their targets even
+	// when they came earlier in the conversation.
+	stored := ms.writeHistory(inserts)
+	ms.writeHistory(updates)
+
+	if len(reacted) > 0 {
+		// Reload reactions from the database on next read.
+		underlying, mu := ms.reactionCache.GetMapWithMutex()
+		mu.Lock()
+		for _, id := range reacted {
+			delete(underlying, id)
+		}
+		mu.Unlock()
+	}
+	if stored > 0 {
+		ms.applyHistoryChat(msgs[0].Event.Info.Chat.String(), chat)
+	}
+	return stored
+}
+
+// applyHistoryChat stores the chat name and unread count from history sync.
+// The unread count replaces what the messages added up to, since the phone
+// knows which of them were read.
+func (ms *MessageStore) applyHistoryChat(chatJID string, chat HistoryChat) {
+	err := ms.runBulk(func(tx *sql.Tx) error {
+		if chat.Name != "" {
+			if _, err := tx.Exec(query.UpdateChatDisplayName, chatJID, chat.Name); err != nil {
+				return err
+			}
+		}
+		if chat.Unread < 0 {
+			return nil
+		}
+		_, err := tx.Exec(query.UpsertChatUnread, chatJID, chat.Unread)
+		return err
+	})
+	if err != nil {
+		log.Println("Failed to store history chat state:", err)
+	}
+}
+
+// writeHistory runs writes in historyBatchSize transactions on the bulk
+// queue and returns how many succeeded. A failed batch is retried one write
+// per transaction so a single bad message doesn't drop its neighbours.
+func (ms *MessageStore) writeHistory(writes []historyWrite) int {
+	ok := 0
+	for start := 0; start < len(writes); start += historyBatchSize {
+		batch := writes[start:min(start+historyBatchSize, len(writes))]
+		err := ms.runBulk(func(tx *sql.Tx) error {
+			st := ms.txStatements(tx)
+			for _, w := range batch {
+				if err := w(tx, st); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			ok += len(batch)
+			continue
+		}
+		log.Println("History batch failed, retrying one by one:", err)
+		failed := 0
+		for _, w := range batch {
+			err := ms.runBulk(func(tx *sql.Tx) error {
+				return w(tx, ms.txStatements(tx))
+			})
+			if err != nil {
+				failed++
+				continue
+			}
+			ok++
+		}
+		if failed > 0 {
+			log.Printf("History sync: %d write(s) failed", failed)
+		}
+	}
+	return ok
+}
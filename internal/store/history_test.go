@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	wastore "go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// noLIDs is a LIDStore without any mappings.
+type noLIDs struct{ wastore.LIDStore }
+
+func (noLIDs) GetLIDForPN(context.Context, types.JID) (types.JID, error) {
+	return types.EmptyJID, nil
+}
+
+func historyMessage(chat types.JID, id string, ts int64, msg *waE2E.Message) HistoryMessage {
+	return HistoryMessage{Event: &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+			ID:            id,
+			Timestamp:     time.Unix(ts, 0),
+		},
+		Message: msg,
+	}}
+}
+
+func TestIngestHistoryConversation(t *testing.T) {
+	ms := newTestMessageStore(t)
+	chat := types.NewJID("15550003333", types.DefaultUserServer)
+	text := func(s string) *waE2E.Message { return &waE2E.Message{Conversation: proto.String(s)} }
+
+	// Newest first, as history sync sends them: the reaction and the edit
+	// come before the messages they target.
+	msgs := []HistoryMessage{
+		historyMessage(chat, "R1", 400, &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+			Key:  &waCommon.MessageKey{ID: proto.String("M1")},
+			Text: proto.String("👍"),
+		}}),
+		historyMessage(chat, "E1", 350, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+			Key:           &waCommon.MessageKey{ID: proto.String("M2")},
+			EditedMessage: text("second, edited"),
+		}}),
+		historyMessage(chat, "M3", 300, text("third")),
+		historyMessage(chat, "M2", 200, text("second")),
+		historyMessage(chat, "M1", 100, text("first")),
+		// A reaction to a message that was never synced must not fail the batch.
+		historyMessage(chat, "R2", 50, &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+			Key:  &waCommon.MessageKey{ID: proto.String("MISSING")},
+			Text: proto.String("❤️"),
+		}}),
+	}
+
+	if stored := ms.IngestHistoryConversation(context.Background(), noLIDs{}, msgs, HistoryChat{Name: "Alice", Unread: 2}); stored != 3 {
+		t.Fatalf("stored = %d, want 3", stored)
+	}
+
+	page, err := ms.GetDecodedMessagesPaged(chat.String(), 0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messageIDs(page); len(got) != 3 || got[0] != "M1" || got[2] != "M3" {
+		t.Fatalf("stored messages = %v, want M1 M2 M3", got)
+	}
+	edited, err := ms.GetDecodedMessage(chat.String(), "M2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !edited.Edited {
+		t.Fatal("edit from history was not applied")
+	}
+	reactions, err := ms.GetReactionsByMessageID("M1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reactions) != 1 || reactions[0].Emoji != "👍" {
+		t.Fatalf("reactions = %+v, want one 👍", reactions)
+	}
+	list := ms.GetChatList()
+	if len(list) != 1 || list[0].MessageTime != 300 || list[0].DisplayName != "Alice" || list[0].Unread != 2 {
+		t.Fatalf("chat list = %+v, want the newest message at 300, named Alice with 2 unread", list)
+	}
+}
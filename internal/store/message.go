@@ -36,14 +36,6 @@ type ExtendedMessage struct {
 	Reactions        []Reaction
 }
 
-// ChatMessage represents a chat in the chat list
-type ChatMessage struct {
-	JID         types.JID
-	MessageText string
-	MessageTime int64
-	Sender      string
-}
-
 // DecodedMessage represents a message from messages.db with decoded fields
 type DecodedMessage struct {
 	Type             mtypes.MediaType    `json:"type"`
@@ -97,9 +89,38 @@ type MediaMessageContent struct {
 	GifPlayback bool         `json:"gifPlayback,omitempty"`
 	Width       int          `json:"width,omitempty"`
 	Height      int          `json:"height,omitempty"`
+	Seconds     int          `json:"seconds,omitempty"`
+	PTT         bool         `json:"ptt,omitempty"`
+	Waveform    []int        `json:"waveform,omitempty"`
 	ContextInfo *ContextInfo `json:"contextInfo,omitempty"`
 }
 
+// playbackDetails are the stored length and voice note details of audio
+// and video.
+type playbackDetails struct {
+	seconds  int
+	ptt      bool
+	waveform []byte
+}
+
+// setPlayback adds playback details to audio and video content.
+func (c *DecodedMessageContent) setPlayback(p playbackDetails) {
+	if c.VideoMessage != nil {
+		c.VideoMessage.Seconds = p.seconds
+	}
+	if c.AudioMessage != nil {
+		c.AudioMessage.Seconds = p.seconds
+		c.AudioMessage.PTT = p.ptt
+		if len(p.waveform) > 0 {
+			// As numbers: a []byte would reach the frontend as base64.
+			c.AudioMessage.Waveform = make([]int, len(p.waveform))
+			for i, v := range p.waveform {
+				c.AudioMessage.Waveform[i] = int(v)
+			}
+		}
+	}
+}
+
 type DocumentMessageContent struct {
 	Caption     string       `json:"caption,omitempty"`
 	FileName    string       `json:"fileName,omitempty"`
@@ -123,17 +144,22 @@ type writeRequest struct {
 type MessageStore struct {
 	db *sql.DB
 
-	// [chatJID.User] = ChatMessage
-	chatListMap   misc.VMap[string, ChatMessage]
 	reactionCache misc.NMap[string, string, []string]
 
-	stmtInsertMessage *sql.Stmt
-	stmtInsertMedia   *sql.Stmt
-	stmtUpdateMessage *sql.Stmt
-	stmtUpdateMedia   *sql.Stmt
-
-	writeMu    sync.RWMutex
-	writeCh    chan writeRequest
+	stmtInsertMessage  *sql.Stmt
+	stmtInsertMedia    *sql.Stmt
+	stmtUpdateMessage  *sql.Stmt
+	stmtUpdateMedia    *sql.Stmt
+	stmtInsertPreview  *sql.Stmt
+	stmtInsertReaction *sql.Stmt
+	stmtDeleteReaction *sql.Stmt
+	stmtUpsertChat     *sql.Stmt
+
+	writeMu sync.RWMutex
+	writeCh chan writeRequest
+	// bulkCh carries history-sync batches; the writer only takes from it
+	// when no write from writeCh is waiting.
+	bulkCh     chan writeRequest
 	writerDone chan struct{}
 	closed     bool
 }
@@ -146,9 +172,9 @@ func NewMessageStore() (*MessageStore, error) {
 
 	ms := &MessageStore{
 		db:            db,
-		chatListMap:   misc.NewVMap[string, ChatMessage](),
 		reactionCache: misc.NewNMap[string, string, []string](),
 		writeCh:       make(chan writeRequest, 100),
+		bulkCh:        make(chan writeRequest, 4),
 		writerDone:    make(chan struct{}),
 	}
 
@@ -171,6 +197,11 @@ func NewMessageStore() (*MessageStore, error) {
 		if _, aerr := tx.Exec(query.AddThumbnailColumn); aerr != nil && !strings.Contains(aerr.Error(), "duplicate column") {
 			return aerr
 		}
+		for _, q := range []string{query.AddSecondsColumn, query.AddPTTColumn, query.AddWaveformColumn, query.AddFileLengthColumn} {
+			if _, aerr := tx.Exec(q); aerr != nil && !strings.Contains(aerr.Error(), "duplicate column") {
+				return aerr
+			}
+		}
 		_, err = tx.Exec(query.CreatePinnedMessagesTable)
 		if err != nil {
 			return err
@@ -191,13 +222,31 @@ func NewMessageStore() (*MessageStore, error) {
 		if err != nil {
 			return err
 		}
+		if _, err = tx.Exec(query.CreateChatsTable); err != nil {
+			return err
+		}
 		_, err = tx.Exec(query.CreateReadReceiptsTable)
 		if err != nil {
 			return err
 		}
+		_, err = tx.Exec(query.CreateNewsletterMessagesTable)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query.CreateCallLogTable)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query.CreateBlockedContactsTable)
+		if err != nil {
+			return err
+		}
 		if _, err = tx.Exec(query.CreateLinkPreviewsTable); err != nil {
 			return err
 		}
+		if _, err = tx.Exec(query.CreateStickersTable); err != nil {
+			return err
+		}
 		// Add poster-download key columns to pre-existing link_previews tables.
 		for _, mig := range []string{
 			query.AddLinkPreviewDirectPath, query.AddLinkPreviewMediaKey,
@@ -207,7 +256,7 @@ func NewMessageStore() (*MessageStore, error) {
 				return aerr
 			}
 		}
-		return nil
+		return backfillChats(tx)
 	})
 
 	if err != nil {
@@ -228,6 +277,18 @@ func NewMessageStore() (*MessageStore, error) {
 	if err == nil {
 		ms.stmtUpdateMedia, err = db.Prepare(query.UpdateMessageMediaByMessageID)
 	}
+	if err == nil {
+		ms.stmtInsertPreview, err = db.Prepare(query.InsertLinkPreview)
+	}
+	if err == nil {
+		ms.stmtInsertReaction, err = db.Prepare(query.InsertReactionIfMessageExists)
+	}
+	if err == nil {
+		ms.stmtDeleteReaction, err = db.Prepare(query.DeleteReactionsByMessageIDAndSenderID)
+	}
+	if err == nil {
+		ms.stmtUpsertChat, err = db.Prepare(query.UpsertChatLastMessage)
+	}
 
 	if err != nil {
 		_ = ms.Close()
@@ -239,26 +300,57 @@ func NewMessageStore() (*MessageStore, error) {
 
 func (ms *MessageStore) runWriter() {
 	defer close(ms.writerDone)
-	for req := range ms.writeCh {
-		tx, err := ms.db.BeginTx(context.Background(), nil)
-		if err == nil {
-			err = req.job(tx)
-			if err != nil {
-				if rollbackErr := tx.Rollback(); rollbackErr != nil {
-					err = errors.Join(err, rollbackErr)
-				}
+	// A nil channel is never ready in a select, so a drained and closed
+	// queue simply drops out.
+	writeCh, bulkCh := ms.writeCh, ms.bulkCh
+	for writeCh != nil || bulkCh != nil {
+		// Live writes always go first.
+		select {
+		case req, ok := <-writeCh:
+			if !ok {
+				writeCh = nil
 			} else {
-				err = tx.Commit()
+				ms.execWrite(req)
 			}
+			continue
+		default:
 		}
+		select {
+		case req, ok := <-writeCh:
+			if !ok {
+				writeCh = nil
+				continue
+			}
+			ms.execWrite(req)
+		case req, ok := <-bulkCh:
+			if !ok {
+				bulkCh = nil
+				continue
+			}
+			ms.execWrite(req)
+		}
+	}
+}
 
-		if req.done != nil {
-			req.done <- err
-			close(req.done)
-		} else if err != nil {
-			log.Println("asynchronous message-store write failed:", err)
+func (ms *MessageStore) execWrite(req writeRequest) {
+	tx, err := ms.db.BeginTx(context.Background(), nil)
+	if err == nil {
+		err = req.job(tx)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+		} else {
+			err = tx.Commit()
 		}
 	}
+
+	if req.done != nil {
+		req.done <- err
+		close(req.done)
+	} else if err != nil {
+		log.Println("asynchronous message-store write failed:", err)
+	}
 }
 
 func (ms *MessageStore) runSync(job writeJob) error {
@@ -269,16 +361,43 @@ func (ms *MessageStore) runSync(job writeJob) error {
 	return <-done
 }
 
+// runBulk is runSync for bulk work that may wait behind live writes.
+func (ms *MessageStore) runBulk(job writeJob) error {
+	done := make(chan error, 1)
+	if err := ms.enqueue(ms.bulkCh, writeRequest{job: job, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
 func (ms *MessageStore) enqueueWrite(req writeRequest) error {
+	return ms.enqueue(ms.writeCh, req)
+}
+
+func (ms *MessageStore) enqueue(ch chan writeRequest, req writeRequest) error {
 	ms.writeMu.RLock()
 	defer ms.writeMu.RUnlock()
 	if ms.closed {
 		return errors.New("message store is closed")
 	}
-	ms.writeCh <- req
+	ch <- req
 	return nil
 }
 
+// Wipe deletes everything the store holds. It stays open, so callers
+// running alongside see an empty store rather than a closed one.
+func (ms *MessageStore) Wipe() error {
+	if err := ms.runSync(misc.ClearTables); err != nil {
+		return err
+	}
+	underlying, mu := ms.reactionCache.GetMapWithMutex()
+	mu.Lock()
+	clear(underlying)
+	mu.Unlock()
+	_, err := ms.db.Exec(query.Vacuum)
+	return err
+}
+
 // Close drains committed writes, closes prepared statements, and then closes
 // the database. Callers must stop the WhatsApp event source before calling it.
 func (ms *MessageStore) Close() error {
@@ -289,6 +408,7 @@ func (ms *MessageStore) Close() error {
 	}
 	ms.closed = true
 	close(ms.writeCh)
+	close(ms.bulkCh)
 	ms.writeMu.Unlock()
 	<-ms.writerDone
 
@@ -298,6 +418,10 @@ func (ms *MessageStore) Close() error {
 		ms.stmtInsertMedia,
 		ms.stmtUpdateMessage,
 		ms.stmtUpdateMedia,
+		ms.stmtInsertPreview,
+		ms.stmtInsertReaction,
+		ms.stmtDeleteReaction,
+		ms.stmtUpsertChat,
 	} {
 		if stmt != nil {
 			closeErr = errors.Join(closeErr, stmt.Close())
@@ -424,6 +548,8 @@ func (ms *MessageStore) MigrateLIDToPN(ctx context.Context, sd store.LIDStore) e
 			sender string
 			oC, oS string
 		)
+		// old chat JID -> new chat JID, to move the chat list rows after
+		movedChats := make(map[string]string)
 
 		for rows.Next() {
 			if err := rows.Scan(&msgID, &chat, &sender); err != nil {
@@ -462,6 +588,17 @@ func (ms *MessageStore) MigrateLIDToPN(ctx context.Context, sd store.LIDStore) e
 				log.Println("Failed to update message during LID to PN migration:", err)
 				continue
 			}
+			if cc {
+				movedChats[oC] = chatJid.String()
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for from, to := range movedChats {
+			if err := moveChat(tx, from, to); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -473,7 +610,7 @@ func (ms *MessageStore) migrateChatlist(ctx context.Context, sd store.LIDStore,
 		// not a jid, skip
 		return
 	}
-	if _, ok := ms.chatListMap.Get(chat.User); ok {
+	if ms.hasChat(chat) {
 		// not a new jid, skip
 		return
 	}
@@ -487,7 +624,7 @@ func (ms *MessageStore) migrateChatlist(ctx context.Context, sd store.LIDStore,
 		return
 	}
 	// check if lid has a chatlist entry (means there are messages for this lid chat)
-	if _, ok := ms.chatListMap.Get(lid.User); !ok {
+	if !ms.hasChat(lid) {
 		// no messages for this lid chat, nothing to migrate
 		return
 	}
@@ -500,19 +637,30 @@ func (ms *MessageStore) migrateChatlist(ctx context.Context, sd store.LIDStore,
 			chat.String(),
 			lid.String(),
 		)
-		return err
+		if err != nil {
+			return err
+		}
+		return moveChat(tx, lid.String(), chat.String())
 	}); err != nil {
 		log.Printf("Failed to migrate messages.chat marker from LID %s to PN %s: %v\n", lid.String(), chat.String(), err)
 		return
 	}
 	log.Printf("Migrated messages.chat marker from LID %s to PN %s\n", lid.String(), chat.String())
-
-	// delete lid chatlist entry from cache
-	ms.chatListMap.Delete(lid.User)
 }
 
 // ProcessMessageEvent processes a new message event and stores it in messages.db
 func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDStore, msg *events.Message, parsedHTML string) string {
+	return ms.processMessageEvent(ctx, sd, msg, parsedHTML, false)
+}
+
+// ProcessBlockedMessageEvent is ProcessMessageEvent for a group message from
+// a blocked sender: it is stored, but neither moves its chat up the chat list
+// nor counts as unread.
+func (ms *MessageStore) ProcessBlockedMessageEvent(ctx context.Context, sd store.LIDStore, msg *events.Message, parsedHTML string) string {
+	return ms.processMessageEvent(ctx, sd, msg, parsedHTML, true)
+}
+
+func (ms *MessageStore) processMessageEvent(ctx context.Context, sd store.LIDStore, msg *events.Message, parsedHTML string, quiet bool) string {
 	ms.migrateChatlist(ctx, sd, msg.Info.Chat)
 
 	updateCanonicalJID(ctx, sd, &msg.Info.Chat)
@@ -567,179 +715,280 @@ func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDSto
 		return ""
 	}
 
-	chat := msg.Info.Chat.User
-
-	// Update chatListMap with the new latest message
-	var messageText string
-	if parsedHTML != "" {
-		messageText = parsedHTML
-	} else {
-		messageText = ExtractMessageText(msg.Message)
-	}
-	sender := msg.Info.PushName
-	if sender == "" && msg.Info.Sender.User != "" {
-		sender = msg.Info.Sender.User
+	err := ms.insertMessage(&msg.Info, msg.Message, parsedHTML, quiet)
+	if err != nil {
+		log.Println("Failed to insert message:", err)
+		return ""
 	}
-
-	if msg.Info.IsFromMe {
-		sender = "You"
+	if msg.Info.Chat.Server == types.NewsletterServer && msg.Info.ServerID != 0 {
+		if err := ms.SetNewsletterServerID(msg.Info.ID, msg.Info.Chat.String(), msg.Info.ServerID); err != nil {
+			log.Println("Failed to store channel message server ID:", err)
+		}
 	}
+	return msg.Info.ID
+}
 
-	chatMsg := ChatMessage{
-		JID:         msg.Info.Chat,
-		MessageText: messageText,
-		MessageTime: msg.Info.Timestamp.Unix(),
-		Sender:      sender,
-	}
+// messageRow is a message prepared for insertion. Building it needs no
+// database access, so a history batch can build many rows up front and write
+// them in one transaction.
+type messageRow struct {
+	info             *types.MessageInfo
+	text             string
+	replyToMessageID string
+	forwarded        bool
+	messageType      mtypes.MessageType
+	emc              wa.ExtendedMediaContent
+	mediaType        mtypes.MediaType
+	width, height    int
+	fileName         string
+	fileLength       uint64
+	gifPlayback      bool
+	thumbnail        []byte
+	// seconds is the length of audio and video; ptt and waveform are set
+	// for voice notes.
+	seconds  uint32
+	ptt      bool
+	waveform []byte
+	// stickerSHA identifies a sticker for the recent and favorite lists.
+	stickerSHA      []byte
+	stickerAnimated bool
+
+	// preview is the chat list text; displayName names a 1:1 chat after the
+	// other party's push name. countUnread counts a new incoming message
+	// as unread.
+	preview     string
+	displayName string
+	countUnread bool
+	// quiet rows leave the chat list alone.
+	quiet bool
+
+	hasPreview              bool
+	lpURL, lpTitle, lpDesc  string
+	lpDirectPath            string
+	lpThumb, lpMediaKey     []byte
+	lpFileSHA, lpFileEncSHA []byte
+
+	// pin / unpin are set for pin-in-chat messages. An unpin only removes
+	// the pin; no message row is written for it.
+	pin            bool
+	unpin          bool
+	pinnedID       string
+	pinDurationSec uint32
+}
 
-	ms.chatListMap.Set(chat, chatMsg)
+// txStatements are the insert statements bound to one write transaction.
+type txStatements struct {
+	insertMessage  *sql.Stmt
+	insertMedia    *sql.Stmt
+	insertPreview  *sql.Stmt
+	insertReaction *sql.Stmt
+	deleteReaction *sql.Stmt
+	upsertChat     *sql.Stmt
+}
 
-	err := ms.InsertMessage(&msg.Info, msg.Message, parsedHTML)
-	if err != nil {
-		log.Println("Failed to insert message:", err)
-		return ""
+func (ms *MessageStore) txStatements(tx *sql.Tx) *txStatements {
+	return &txStatements{
+		insertMessage:  tx.Stmt(ms.stmtInsertMessage),
+		insertMedia:    tx.Stmt(ms.stmtInsertMedia),
+		insertPreview:  tx.Stmt(ms.stmtInsertPreview),
+		insertReaction: tx.Stmt(ms.stmtInsertReaction),
+		deleteReaction: tx.Stmt(ms.stmtDeleteReaction),
+		upsertChat:     tx.Stmt(ms.stmtUpsertChat),
 	}
-	return msg.Info.ID
 }
 
-// InsertMessage inserts a new message into messages.db
-func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Message, parsedHTML string) error {
+func buildMessageRow(info *types.MessageInfo, msg *waE2E.Message, parsedHTML string) *messageRow {
 	msg = UnwrapMessage(msg)
-	var (
-		text, fileName, replyToMessageID string
-		forwarded                        = false
-		emc                              wa.ExtendedMediaContent
-		mediaType                        mtypes.MediaType
-		width, height                    int
-	)
-
-	var messageType mtypes.MessageType
+	r := &messageRow{info: info, messageType: mtypes.MessageTypeNormal}
 
 	// todo: add a flush system on pin expiry
-	switch {
-	case msg.PinInChatMessage != nil && msg.PinInChatMessage.Key != nil:
-		pin := msg.PinInChatMessage
-		switch *pin.Type {
+	if pin := msg.GetPinInChatMessage(); pin != nil && pin.Key != nil {
+		switch pin.GetType() {
 		case waE2E.PinInChatMessage_PIN_FOR_ALL:
-			var dur uint32
-			if msg.GetMessageContextInfo() != nil {
-				dur = *msg.GetMessageContextInfo().MessageAddOnDurationInSecs
-			}
-			err := ms.runSync(func(tx *sql.Tx) error {
-				_, err := tx.Exec(query.InsertPinnedMessages, pin.Key.ID, info.Chat.String(), info.Sender.String(), info.Timestamp.Unix(), dur)
-				return err
-			})
-			if err != nil {
-				return err
-			}
+			r.pin = true
+			r.pinnedID = pin.GetKey().GetID()
+			r.pinDurationSec = msg.GetMessageContextInfo().GetMessageAddOnDurationInSecs()
 		case waE2E.PinInChatMessage_UNPIN_FOR_ALL:
 			// do not process the message further
-			return ms.runSync(func(tx *sql.Tx) error {
-				_, err := tx.Exec(query.DeletePinnedMessageByMessageId, pin.Key.ID)
-				return err
-			})
+			r.unpin = true
+			r.pinnedID = pin.GetKey().GetID()
+			return r
 		default:
-			log.Println("unknown pin type", pin.Type, "in message:", msg)
+			log.Println("unknown pin type", pin.GetType(), "in message:", msg)
 		}
-		messageType = mtypes.MessageTypeMessagePinned
-	default:
-		messageType = mtypes.MessageTypeNormal
+		r.messageType = mtypes.MessageTypeMessagePinned
 	}
 
-	text, fileName, replyToMessageID, forwarded, emc, mediaType, width, height = extractMessageContent(msg)
+	r.text, r.fileName, r.replyToMessageID, r.forwarded, r.emc, r.mediaType, r.width, r.height = extractMessageContent(msg)
+	if fl, ok := r.emc.(interface{ GetFileLength() uint64 }); ok {
+		r.fileLength = fl.GetFileLength()
+	}
 
 	// gifPlayback marks a video that should loop like a GIF. GetVideoMessage is
 	// nil-safe and returns false for non-video messages.
-	gifPlayback := msg.GetVideoMessage().GetGifPlayback()
+	r.gifPlayback = msg.GetVideoMessage().GetGifPlayback()
 
 	// Embedded preview thumbnail (WhatsApp ships a small JPEG in the message) so
 	// videos show a preview + play button in the list without downloading them.
-	var thumbnail []byte
 	if v := msg.GetVideoMessage(); v != nil {
-		thumbnail = v.GetJPEGThumbnail()
+		r.thumbnail = v.GetJPEGThumbnail()
 	} else if p := msg.GetPtvMessage(); p != nil {
-		thumbnail = p.GetJPEGThumbnail()
+		r.thumbnail = p.GetJPEGThumbnail()
 	} else if i := msg.GetImageMessage(); i != nil {
-		thumbnail = i.GetJPEGThumbnail()
+		r.thumbnail = i.GetJPEGThumbnail()
+	}
+
+	if a := msg.GetAudioMessage(); a != nil {
+		r.seconds, r.ptt, r.waveform = a.GetSeconds(), a.GetPTT(), a.GetWaveform()
+	} else if v := msg.GetVideoMessage(); v != nil {
+		r.seconds = v.GetSeconds()
+	}
+
+	if s := msg.GetStickerMessage(); s != nil {
+		r.stickerSHA, r.stickerAnimated = s.GetFileSHA256(), s.GetIsAnimated()
 	}
 
 	// Link preview (title/description/thumbnail) from a text message with a URL.
 	// The poster image is usually a downloadable reference rather than embedded,
 	// so keep its keys to fetch it lazily later.
-	var lpURL, lpTitle, lpDesc, lpDirectPath string
-	var lpThumb, lpMediaKey, lpFileSHA, lpFileEncSHA []byte
 	if etm := msg.GetExtendedTextMessage(); etm != nil && (etm.GetTitle() != "" || len(etm.GetJPEGThumbnail()) > 0 || etm.GetThumbnailDirectPath() != "") {
-		lpURL = etm.GetMatchedText()
-		lpTitle = etm.GetTitle()
-		lpDesc = etm.GetDescription()
-		lpThumb = etm.GetJPEGThumbnail()
-		lpDirectPath = etm.GetThumbnailDirectPath()
-		lpMediaKey = etm.GetMediaKey()
-		lpFileSHA = etm.GetThumbnailSHA256()
-		lpFileEncSHA = etm.GetThumbnailEncSHA256()
+		r.lpURL = etm.GetMatchedText()
+		r.lpTitle = etm.GetTitle()
+		r.lpDesc = etm.GetDescription()
+		r.lpThumb = etm.GetJPEGThumbnail()
+		r.lpDirectPath = etm.GetThumbnailDirectPath()
+		r.lpMediaKey = etm.GetMediaKey()
+		r.lpFileSHA = etm.GetThumbnailSHA256()
+		r.lpFileEncSHA = etm.GetThumbnailEncSHA256()
 	}
-	hasPreview := lpTitle != "" || len(lpThumb) > 0 || lpDirectPath != ""
+	r.hasPreview = r.lpTitle != "" || len(r.lpThumb) > 0 || r.lpDirectPath != ""
 
 	if parsedHTML != "" {
-		text = parsedHTML
+		r.text = parsedHTML
 	}
 
 	// Message types with no plain-text body (polls, locations, contacts,
 	// invites, events…) render as prebuilt HTML cards.
-	if text == "" && emc == nil {
+	if r.text == "" && r.emc == nil {
 		if special, ok := DescribeSpecialMessage(msg); ok {
-			text = special
+			r.text = special
 		}
 	}
 
-	return ms.runSync(func(tx *sql.Tx) error {
-		_, err := tx.Stmt(ms.stmtInsertMessage).Exec(
-			info.ID,
-			info.Chat.String(),
-			info.Sender.String(),
-			info.Timestamp.Unix(),
-			info.IsFromMe,
-			text,
-			emc != nil,
-			replyToMessageID,
-			false,
-			forwarded,
-			messageType,
-		)
-		if err != nil {
+	r.preview = parsedHTML
+	if r.preview == "" {
+		r.preview = ExtractMessageText(msg)
+	}
+	if !info.IsFromMe && info.Chat.Server == types.DefaultUserServer {
+		r.displayName = info.PushName
+	}
+	return r
+}
+
+// write stores the row (and its pin, link preview and media rows).
+func (r *messageRow) write(tx *sql.Tx, st *txStatements) error {
+	info := r.info
+	if r.unpin {
+		_, err := tx.Exec(query.DeletePinnedMessageByMessageId, r.pinnedID)
+		return err
+	}
+	if r.pin {
+		if _, err := tx.Exec(query.InsertPinnedMessages, r.pinnedID, info.Chat.String(), info.Sender.String(), info.Timestamp.Unix(), r.pinDurationSec); err != nil {
 			return err
 		}
-		if hasPreview {
-			if _, perr := tx.Exec(query.InsertLinkPreview, info.ID, lpURL, lpTitle, lpDesc, lpThumb,
-				lpDirectPath, lpMediaKey, lpFileSHA, lpFileEncSHA); perr != nil {
-				return perr
-			}
+	}
+
+	unread := 0
+	if r.countUnread && !r.quiet && r.messageType == mtypes.MessageTypeNormal {
+		// Redelivered messages must not be counted twice.
+		var exists bool
+		if err := tx.QueryRow(query.SelectMessageExists, info.ID).Scan(&exists); err != nil {
+			return err
 		}
-		// no media to process
-		if emc == nil {
-			return nil
-		}
-		_, err = tx.Stmt(ms.stmtInsertMedia).Exec(
-			info.ID,
-			mediaType,
-			emc.GetURL(),
-			emc.GetMimetype(),
-			emc.GetDirectPath(),
-			emc.GetMediaKey(),
-			emc.GetFileSHA256(),
-			emc.GetFileEncSHA256(),
-			width, height,
-			fileName,
-			gifPlayback,
-			thumbnail,
-		)
+		if !exists {
+			unread = 1
+		}
+	}
+
+	_, err := st.insertMessage.Exec(
+		info.ID,
+		info.Chat.String(),
+		info.Sender.String(),
+		info.Timestamp.Unix(),
+		info.IsFromMe,
+		r.text,
+		r.emc != nil,
+		r.replyToMessageID,
+		false,
+		r.forwarded,
+		r.messageType,
+	)
+	if err != nil {
 		return err
+	}
+	if !r.quiet {
+		if err := r.upsertChat(st, unread); err != nil {
+			return err
+		}
+	}
+	if r.hasPreview {
+		if _, err := st.insertPreview.Exec(info.ID, r.lpURL, r.lpTitle, r.lpDesc, r.lpThumb,
+			r.lpDirectPath, r.lpMediaKey, r.lpFileSHA, r.lpFileEncSHA); err != nil {
+			return err
+		}
+	}
+	// no media to process
+	if r.emc == nil {
+		return nil
+	}
+	_, err = st.insertMedia.Exec(
+		info.ID,
+		r.mediaType,
+		r.emc.GetURL(),
+		r.emc.GetMimetype(),
+		r.emc.GetDirectPath(),
+		r.emc.GetMediaKey(),
+		r.emc.GetFileSHA256(),
+		r.emc.GetFileEncSHA256(),
+		r.width, r.height,
+		r.fileName,
+		r.gifPlayback,
+		r.thumbnail,
+		r.seconds,
+		r.ptt,
+		r.waveform,
+		r.fileLength,
+	)
+	if err != nil || len(r.stickerSHA) == 0 {
+		return err
+	}
+	_, err = tx.Exec(query.UpsertSticker, r.stickerSHA, info.ID, info.Chat.String(), r.stickerAnimated, info.Timestamp.Unix())
+	return err
+}
+
+// InsertMessage inserts a new message into messages.db and updates its chat.
+// Incoming messages count as unread.
+func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Message, parsedHTML string) error {
+	return ms.insertMessage(info, msg, parsedHTML, false)
+}
+
+func (ms *MessageStore) insertMessage(info *types.MessageInfo, msg *waE2E.Message, parsedHTML string, quiet bool) error {
+	row := buildMessageRow(info, msg, parsedHTML)
+	row.countUnread = !info.IsFromMe
+	row.quiet = quiet
+	return ms.runSync(func(tx *sql.Tx) error {
+		return row.write(tx, ms.txStatements(tx))
 	})
 }
 
 // UpdateMessageContent updates an existing message's content
 func (ms *MessageStore) UpdateMessageContent(messageID string, content *waE2E.Message, parsedHTML string) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		return ms.updateMessageContent(tx, messageID, content, parsedHTML)
+	})
+}
 
+func (ms *MessageStore) updateMessageContent(tx *sql.Tx, messageID string, content *waE2E.Message, parsedHTML string) error {
 	var (
 		text, fileName string
 		emc            wa.ExtendedMediaContent
@@ -757,33 +1006,38 @@ func (ms *MessageStore) UpdateMessageContent(messageID string, content *waE2E.Me
 		text = parsedHTML
 	}
 
-	return ms.runSync(func(tx *sql.Tx) error {
-		_, err := tx.Stmt(ms.stmtUpdateMessage).Exec(
-			text,
-			messageID,
-		)
-		if err != nil {
-			return err
-		}
-		// no media to process
-		if emc == nil {
-			return nil
-		}
-
-		_, err = tx.Stmt(ms.stmtUpdateMedia).Exec(
-			mediaType,
-			emc.GetURL(),
-			emc.GetMimetype(),
-			emc.GetDirectPath(),
-			emc.GetMediaKey(),
-			emc.GetFileSHA256(),
-			emc.GetFileEncSHA256(),
-			width, height,
-			fileName,
-			messageID,
-		)
+	_, err := tx.Stmt(ms.stmtUpdateMessage).Exec(
+		text,
+		messageID,
+	)
+	if err != nil {
 		return err
-	})
+	}
+	preview := parsedHTML
+	if preview == "" {
+		preview = ExtractMessageText(content)
+	}
+	if _, err := tx.Exec(query.UpdateChatLastMessageText, preview, messageID); err != nil {
+		return err
+	}
+	// no media to process
+	if emc == nil {
+		return nil
+	}
+
+	_, err = tx.Stmt(ms.stmtUpdateMedia).Exec(
+		mediaType,
+		emc.GetURL(),
+		emc.GetMimetype(),
+		emc.GetDirectPath(),
+		emc.GetMediaKey(),
+		emc.GetFileSHA256(),
+		emc.GetFileEncSHA256(),
+		width, height,
+		fileName,
+		messageID,
+	)
+	return err
 }
 
 // GetMessageWithRaw returns a message with its raw protobuf content for media download
@@ -827,6 +1081,7 @@ func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*
 			mimetype      sql.NullString
 			directPath    sql.NullString
 			fileName      sql.NullString
+			fileLength    sql.NullInt64
 			mediaKey      []byte
 			fileSHA256    []byte
 			fileEncSHA256 []byte
@@ -843,6 +1098,7 @@ func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*
 			&width,
 			&height,
 			&fileName,
+			&fileLength,
 		)
 		if err != nil {
 			log.Println("GetMessageWithMedia media query error:", err)
@@ -853,6 +1109,7 @@ func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*
 			mediaKey, fileSHA256, fileEncSHA256,
 			url.String,
 			mimetype.String,
+			fileName.String, uint64(fileLength.Int64),
 			width, height,
 			mtypes.MediaType(mediaType),
 		)
@@ -917,6 +1174,8 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 			url           sql.NullString
 			mimetype      sql.NullString
 			directPath    sql.NullString
+			fileName      sql.NullString
+			fileLength    sql.NullInt64
 			mediaKey      []byte
 			fileSHA256    []byte
 			fileEncSHA256 []byte
@@ -932,6 +1191,8 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 			&fileEncSHA256,
 			&width,
 			&height,
+			&fileName,
+			&fileLength,
 		)
 		if err != nil {
 			return nil, err
@@ -941,6 +1202,7 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 			mediaKey, fileSHA256, fileEncSHA256,
 			url.String,
 			mimetype.String,
+			fileName.String, uint64(fileLength.Int64),
 			width, height,
 			mtypes.MediaType(mediaType),
 		)
@@ -964,87 +1226,43 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 	}, nil
 }
 
-// GetChatList returns the chat list from messages.db
-// GetChatList returns the regular chat list (channels/broadcast excluded).
-func (ms *MessageStore) GetChatList() []ChatMessage {
-	return ms.chatListFromQuery(query.SelectDecodedChatList)
-}
-
-// GetChannelList returns only Channel (newsletter) feeds.
-func (ms *MessageStore) GetChannelList() []ChatMessage {
-	return ms.chatListFromQuery(query.SelectDecodedChannelList)
-}
-
-func (ms *MessageStore) chatListFromQuery(q string) []ChatMessage {
-	rows, err := ms.db.Query(q)
+// RecentMediaMessageIDs lists up to limit messages with media sent since
+// since, newest first.
+func (ms *MessageStore) RecentMediaMessageIDs(since time.Time, limit int) ([]string, error) {
+	rows, err := ms.db.Query(query.SelectRecentMediaMessageIDs, since.Unix(), limit)
 	if err != nil {
-		log.Println("Failed to query chat list:", err)
-		return []ChatMessage{}
+		return nil, err
 	}
 	defer rows.Close()
 
-	var chatList []ChatMessage
-
+	ids := []string{}
 	for rows.Next() {
-		var (
-			messageID string
-			chatJID   string
-			senderJID string
-			timestamp int64
-			isFromMe  bool
-			msgType   sql.NullInt32
-			text      sql.NullString
-			replyTo   sql.NullString
-			fileName  sql.NullString
-			edited    bool
-			forwarded bool
-		)
-
-		if err := rows.Scan(
-			&messageID,
-			&chatJID,
-			&senderJID,
-			&timestamp,
-			&isFromMe,
-			&text,
-			&replyTo,
-			&edited,
-			&forwarded,
-			&msgType,
-			&fileName,
-		); err != nil {
-			log.Println("Failed to scan chat list row:", err)
-			continue
-		}
-
-		jid, err := types.ParseJID(chatJID)
-		if err != nil {
-			continue
-		}
-
-		// Check per-chat cache first
-		if cachedChat, ok := ms.chatListMap.Get(jid.User); ok {
-			chatList = append(chatList, cachedChat)
-			continue
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
 
-		var messageText string
-		if text.Valid {
-			messageText = text.String
-		}
+// ChatMediaMessageIDs lists a chat's messages with media, oldest first.
+func (ms *MessageStore) ChatMediaMessageIDs(chatJID string) ([]string, error) {
+	rows, err := ms.db.Query(query.SelectChatMediaMessageIDs, chatJID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		chatMsg := ChatMessage{
-			JID:         jid,
-			MessageText: messageText,
-			MessageTime: timestamp,
-			Sender:      senderJID,
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
-
-		// Cache per-chat entry
-		ms.chatListMap.Set(jid.User, chatMsg)
-		chatList = append(chatList, chatMsg)
+		ids = append(ids, id)
 	}
-	return chatList
+	return ids, rows.Err()
 }
 
 // GetReactionsByMessageID returns all reactions for a message
@@ -1254,6 +1472,7 @@ type decodedPageRow struct {
 	width       int
 	height      int
 	gif         bool
+	playback    playbackDetails
 	linkPreview *DecodedLinkPreview
 }
 
@@ -1303,6 +1522,9 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			fileName           sql.NullString
 			width, height      sql.NullInt64
 			gif                sql.NullBool
+			seconds            sql.NullInt64
+			ptt                sql.NullBool
+			waveform           []byte
 			previewURL         sql.NullString
 			previewTitle       sql.NullString
 			previewDescription sql.NullString
@@ -1324,6 +1546,9 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			&width,
 			&height,
 			&gif,
+			&seconds,
+			&ptt,
+			&waveform,
 			&previewURL,
 			&previewTitle,
 			&previewDescription,
@@ -1360,6 +1585,7 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			width:       int(width.Int64),
 			height:      int(height.Int64),
 			gif:         gif.Bool,
+			playback:    playbackDetails{int(seconds.Int64), ptt.Bool, waveform},
 			linkPreview: linkPreview,
 		})
 	}
@@ -1408,6 +1634,7 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			item.gif,
 			contextInfo,
 		)
+		item.message.Content.setPlayback(item.playback)
 		messages = append(messages, item.message)
 	}
 
@@ -1659,6 +1886,9 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 		fileName           sql.NullString
 		width, height      sql.NullInt64
 		gif                sql.NullBool
+		seconds            sql.NullInt64
+		ptt                sql.NullBool
+		waveform           []byte
 		previewURL         sql.NullString
 		previewTitle       sql.NullString
 		previewDescription sql.NullString
@@ -1680,6 +1910,9 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 			&width,
 			&height,
 			&gif,
+			&seconds,
+			&ptt,
+			&waveform,
 			&previewURL,
 			&previewTitle,
 			&previewDescription,
@@ -1743,77 +1976,11 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 		gif.Bool,
 		contextInfo,
 	)
+	msg.Content.setPlayback(playbackDetails{int(seconds.Int64), ptt.Bool, waveform})
 
 	return &msg, nil
 }
 
-// GetDecodedChatList returns the chat list from messages.db with the latest message for each chat
-func (ms *MessageStore) GetDecodedChatList() ([]DecodedMessage, error) {
-	rows, err := ms.db.Query(query.SelectDecodedChatList)
-	if err != nil {
-		log.Println("Failed to query decoded chat list:", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var messages []DecodedMessage
-
-	for rows.Next() {
-		var (
-			messageId         string
-			chat              string
-			sender            string
-			timestamp         int64
-			isFromMe          bool
-			text              sql.NullString
-			replyTo           sql.NullString
-			edited, forwarded bool
-			msgType           sql.NullInt32
-			fileName          sql.NullString
-		)
-
-		err := rows.Scan(
-			&messageId,
-			&chat,
-			&sender,
-			&timestamp,
-			&isFromMe,
-			&text,
-			&replyTo,
-			&edited,
-			&forwarded,
-			&msgType,
-			&fileName,
-		)
-		if err != nil {
-			log.Println("Failed to scan decoded message for chat list:", err)
-			continue
-		}
-
-		msg := DecodedMessage{
-			Type:             mtypes.MediaType(msgType.Int32),
-			Edited:           edited,
-			Forwarded:        forwarded,
-			ReplyToMessageID: replyTo.String,
-			Info: DecodedMessageInfo{
-				ID:        messageId,
-				Timestamp: time.Unix(timestamp, 0).Format(time.RFC3339),
-				IsFromMe:  isFromMe,
-				PushName:  "",
-				Sender:    sender,
-				Chat:      chat,
-			},
-		}
-
-		// Populate Content for frontend rendering
-		msg.Content = ms.buildDecodedContent(chat, messageId, text.String, msg.ReplyToMessageID, fileName.String, msg.Type)
-
-		messages = append(messages, msg)
-	}
-
-	return messages, nil
-}
-
 // ---- Pins ----
 
 // PinnedMessage is a pinned message row joined with its stored text, used by
@@ -1857,67 +2024,21 @@ func (ms *MessageStore) ApplyMessagePin(chatJID, senderJID, messageID string, pi
 	return err
 }
 
-// SetChatPinned stores whether a chat is pinned in the chat list.
-func (ms *MessageStore) SetChatPinned(chatJID string, pinned bool, ts int64) error {
-	if pinned {
-		_, err := ms.db.Exec(query.UpsertPinnedChat, chatJID, ts)
-		return err
-	}
-	_, err := ms.db.Exec(query.DeletePinnedChat, chatJID)
-	return err
-}
+// deletedMessageHTML replaces the content of revoked messages.
+const deletedMessageHTML = `<i>🚫 This message was deleted</i>`
 
-// GetPinnedChats returns chat JID -> pinned-at for every pinned chat.
-func (ms *MessageStore) GetPinnedChats() map[string]int64 {
-	pins := make(map[string]int64)
-	rows, err := ms.db.Query(query.SelectPinnedChats)
-	if err != nil {
-		return pins
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var jid string
-		var ts int64
-		if rows.Scan(&jid, &ts) == nil {
-			pins[jid] = ts
-		}
-	}
-	return pins
+// MarkMessageDeleted replaces a revoked message's content with a deleted
+// marker, mirroring WhatsApp's "This message was deleted".
+func (ms *MessageStore) MarkMessageDeleted(messageID string) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		return markMessageDeleted(tx, messageID)
+	})
 }
 
-// SetChatArchived stores whether a chat is archived.
-func (ms *MessageStore) SetChatArchived(chatJID string, archived bool, ts int64) error {
-	if archived {
-		_, err := ms.db.Exec(query.UpsertArchivedChat, chatJID, ts)
+func markMessageDeleted(tx *sql.Tx, messageID string) error {
+	if _, err := tx.Exec(query.MarkMessageDeleted, deletedMessageHTML, messageID); err != nil {
 		return err
 	}
-	_, err := ms.db.Exec(query.DeleteArchivedChat, chatJID)
-	return err
-}
-
-// GetArchivedChats returns chat JID -> archived-at for every archived chat.
-func (ms *MessageStore) GetArchivedChats() map[string]int64 {
-	archived := make(map[string]int64)
-	rows, err := ms.db.Query(query.SelectArchivedChats)
-	if err != nil {
-		return archived
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var jid string
-		var ts int64
-		if rows.Scan(&jid, &ts) == nil {
-			archived[jid] = ts
-		}
-	}
-	return archived
-}
-
-// MarkMessageDeleted replaces a revoked message's content with a deleted
-// marker, mirroring WhatsApp's "This message was deleted".
-func (ms *MessageStore) MarkMessageDeleted(messageID string) error {
-	_, err := ms.db.Exec(
-		`UPDATE messages SET text = ?, has_media = 0 WHERE message_id = ?`,
-		`<i>🚫 This message was deleted</i>`, messageID)
+	_, err := tx.Exec(query.UpdateChatLastMessageText, deletedMessageHTML, messageID)
 	return err
 }
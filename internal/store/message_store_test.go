@@ -1,12 +1,18 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/lugvitc/whats4linux/internal/misc"
 	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
 )
 
 func newTestMessageStore(t *testing.T) *MessageStore {
@@ -199,3 +205,297 @@ func TestRunSyncReturnsBeginFailureWithoutBlocking(t *testing.T) {
 		t.Fatal("runSync blocked after transaction begin failed")
 	}
 }
+
+func TestNewsletterServerIDCursor(t *testing.T) {
+	ms := newTestMessageStore(t)
+	const chat = "123@newsletter"
+
+	if got := ms.OldestNewsletterServerID(chat); got != 0 {
+		t.Fatalf("empty channel cursor = %d, want 0", got)
+	}
+	for id, serverID := range map[string]int{"a": 120, "b": 101, "c": 150} {
+		if err := ms.SetNewsletterServerID(id, chat, serverID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.SetNewsletterServerID("other", "456@newsletter", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ms.OldestNewsletterServerID(chat); got != 101 {
+		t.Fatalf("oldest server ID = %d, want 101", got)
+	}
+	got, err := ms.GetNewsletterServerID("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 150 {
+		t.Fatalf("server ID of c = %d, want 150", got)
+	}
+}
+
+func TestFinishCallAddsTimelineEntryOnce(t *testing.T) {
+	ms := newTestMessageStore(t)
+	const chat = "15550001111@s.whatsapp.net"
+
+	err := ms.RecordCallOffer(CallLogEntry{
+		CallID:     "CALL1",
+		ChatJID:    chat,
+		CallerJID:  chat,
+		CreatorJID: chat,
+		IsVideo:    true,
+		StartedAt:  1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.MarkCallAccepted("CALL1", 1010); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := ms.FinishCall("CALL1", 1255, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || entry.Duration != 245 || entry.Missed {
+		t.Fatalf("finished call = %+v, want 245s answered call", entry)
+	}
+	if got := CallSummary(entry); got != "Video call · 4:05" {
+		t.Fatalf("summary = %q", got)
+	}
+
+	again, err := ms.FinishCall("CALL1", 1300, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != nil {
+		t.Fatalf("second terminate finished the call again: %+v", again)
+	}
+
+	msgs, err := ms.GetDecodedMessagesPaged(chat, 0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := messageIDs(msgs); len(ids) != 1 || ids[0] != CallTimelineID("CALL1") {
+		t.Fatalf("timeline = %v, want one call entry", ids)
+	}
+}
+
+func TestBlocklistReplaceAndPatch(t *testing.T) {
+	ms := newTestMessageStore(t)
+	const a, b = "111@s.whatsapp.net", "222@s.whatsapp.net"
+
+	if err := ms.ReplaceBlocklist([]string{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SetBlocked(a, false); err != nil {
+		t.Fatal(err)
+	}
+	if ms.IsBlocked(a) || !ms.IsBlocked(b) {
+		t.Fatalf("blocked a=%v b=%v, want a unblocked and b blocked", ms.IsBlocked(a), ms.IsBlocked(b))
+	}
+	if err := ms.ReplaceBlocklist(nil); err != nil {
+		t.Fatal(err)
+	}
+	jids, err := ms.GetBlockedJIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jids) != 0 {
+		t.Fatalf("blocklist after replace = %v, want empty", jids)
+	}
+}
+
+func TestOldestMessageSkipsCallEntries(t *testing.T) {
+	ms := newTestMessageStore(t)
+	const chat = "15550002222@s.whatsapp.net"
+
+	if _, err := ms.OldestMessage(chat); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("empty chat: err = %v, want sql.ErrNoRows", err)
+	}
+
+	insertTestMessage(t, ms, "B", chat, 200, "")
+	insertTestMessage(t, ms, "A", chat, 200, "")
+	insertTestMessage(t, ms, "C", chat, 300, "")
+	if err := ms.RecordCallOffer(CallLogEntry{CallID: "OLD", ChatJID: chat, CallerJID: chat, CreatorJID: chat, StartedAt: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ms.FinishCall("OLD", 110, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	oldest, err := ms.OldestMessage(chat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest.ID != "A" || oldest.Timestamp.Unix() != 200 || oldest.Chat.String() != chat {
+		t.Fatalf("oldest = %s at %d in %s, want A at 200", oldest.ID, oldest.Timestamp.Unix(), oldest.Chat)
+	}
+}
+
+func TestChatListTracksMessages(t *testing.T) {
+	ms := newTestMessageStore(t)
+	// Same user part on two servers: these used to share a chat list entry.
+	pn := types.NewJID("15550004444", types.DefaultUserServer)
+	lid := types.NewJID("15550004444", types.HiddenUserServer)
+	info := func(chat types.JID, id string, ts int64, fromMe bool) *types.MessageInfo {
+		return &types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: chat, IsFromMe: fromMe},
+			ID:            id,
+			PushName:      "Bob",
+			Timestamp:     time.Unix(ts, 0),
+		}
+	}
+	text := func(s string) *waE2E.Message { return &waE2E.Message{Conversation: proto.String(s)} }
+	insert := func(i *types.MessageInfo, s string) {
+		t.Helper()
+		if err := ms.InsertMessage(i, text(s), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insert(info(pn, "P1", 100, false), "hi")
+	insert(info(pn, "P2", 200, false), "there")
+	insert(info(pn, "P2", 200, false), "there") // redelivery
+	insert(info(lid, "L1", 150, false), "other")
+
+	list := ms.GetChatList()
+	if len(list) != 2 || list[0].JID != pn || list[1].JID != lid {
+		t.Fatalf("chat list = %+v, want %s then %s", list, pn, lid)
+	}
+	if got := list[0]; got.MessageText != "there" || got.Unread != 2 || got.Sender != "Bob" || got.DisplayName != "Bob" {
+		t.Fatalf("chat entry = %+v, want \"there\" from Bob with 2 unread", got)
+	}
+	if page := ms.GetChatListPage(1, 1); len(page) != 1 || page[0].JID != lid {
+		t.Fatalf("second page = %+v, want %s", page, lid)
+	}
+
+	if err := ms.UpdateMessageContent("P2", text("there!"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := ms.GetChatList()[0].MessageText; got != "there!" {
+		t.Fatalf("preview after edit = %q", got)
+	}
+	if err := ms.MarkMessageDeleted("P2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ms.GetChatList()[0].MessageText; got != deletedMessageHTML {
+		t.Fatalf("preview after revoke = %q", got)
+	}
+
+	// An older message doesn't replace the preview; our reply reads the chat.
+	insert(info(pn, "P0", 50, false), "old")
+	insert(info(pn, "P3", 300, true), "reply")
+	if got := ms.GetChatList()[0]; got.LastMessageID != "P3" || got.Unread != 0 || got.Sender != "You" {
+		t.Fatalf("chat entry = %+v, want our reply P3 and nothing unread", got)
+	}
+
+	if err := ms.SetChatRead(lid.String(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SetChatPinned(lid.String(), true, 400); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.SetChatMuted(lid.String(), -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := ms.GetChatList()[1]; got.Unread != 0 || got.PinnedAt != 400 || !got.Muted() || !ms.IsChatMuted(lid.String()) {
+		t.Fatalf("chat entry = %+v, want read, pinned at 400 and muted", got)
+	}
+}
+
+func TestVoiceNoteDetailsAreStored(t *testing.T) {
+	ms := newTestMessageStore(t)
+	chat := types.NewJID("123", types.DefaultUserServer)
+	info := &types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: chat},
+		ID:            "voice-note",
+		Timestamp:     time.Unix(100, 0),
+	}
+	msg := &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+		Mimetype:   proto.String("audio/ogg; codecs=opus"),
+		DirectPath: proto.String("/v/voice"),
+		Seconds:    proto.Uint32(7),
+		PTT:        proto.Bool(true),
+		Waveform:   []byte{0, 50, 100},
+	}}
+	if err := ms.InsertMessage(info, msg, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(content *DecodedMessageContent) {
+		t.Helper()
+		audio := content.AudioMessage
+		if audio == nil || audio.Seconds != 7 || !audio.PTT || len(audio.Waveform) != 3 || audio.Waveform[2] != 100 {
+			t.Fatalf("audio content = %#v, want a 7s voice note with its waveform", audio)
+		}
+	}
+	page, err := ms.GetDecodedMessagesPaged(chat.String(), 0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 {
+		t.Fatalf("got %d messages, want 1", len(page))
+	}
+	check(page[0].Content)
+	message, err := ms.GetDecodedMessage(chat.String(), "voice-note")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(message.Content)
+}
+
+func TestWipeEmptiesOpenStore(t *testing.T) {
+	ms := newTestMessageStore(t)
+	const chat = "15550001111@s.whatsapp.net"
+	insertTestMessage(t, ms, "A", chat, 1000, "")
+	insertTestMessage(t, ms, "B", chat, 1001, "A")
+
+	if err := ms.Wipe(); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := ms.GetDecodedMessagesPaged(chat, 0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("messages after wipe = %v", messageIDs(msgs))
+	}
+	// Still open for writes.
+	insertTestMessage(t, ms, "C", chat, 1002, "")
+}
+
+func TestBlockedGroupMessageLeavesChatListAlone(t *testing.T) {
+	ms := newTestMessageStore(t)
+	group := types.NewJID("120363000000000001", types.GroupServer)
+	message := func(id, sender string, ts int64) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: group, Sender: types.NewJID(sender, types.DefaultUserServer), IsGroup: true},
+				ID:            id,
+				Timestamp:     time.Unix(ts, 0),
+			},
+			Message: &waE2E.Message{Conversation: proto.String(id)},
+		}
+	}
+	friend := message("friend", "111", 100)
+	if err := ms.InsertMessage(&friend.Info, friend.Message, ""); err != nil {
+		t.Fatal(err)
+	}
+	// The chat already exists, so no LID lookups are needed.
+	if ms.ProcessBlockedMessageEvent(context.Background(), nil, message("blocked", "222", 200), "") == "" {
+		t.Fatal("message from a blocked sender wasn't stored")
+	}
+
+	list := ms.GetChatList()
+	if len(list) != 1 || list[0].LastMessageID != "friend" || list[0].Unread != 1 {
+		t.Fatalf("chat list = %+v, want the friend's message, 1 unread", list)
+	}
+	msgs, err := ms.GetDecodedMessagesPaged(group.String(), 0, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("stored %v, want both messages", messageIDs(msgs))
+	}
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// SetNewsletterServerID records the server-assigned ID of a channel message.
+// Channel reactions and history backfill address messages by this ID.
+func (ms *MessageStore) SetNewsletterServerID(messageID, chatJID string, serverID types.MessageServerID) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.UpsertNewsletterMessage, messageID, chatJID, serverID)
+		return err
+	})
+}
+
+// GetNewsletterServerID returns the server ID of a stored channel message.
+func (ms *MessageStore) GetNewsletterServerID(messageID string) (types.MessageServerID, error) {
+	var serverID types.MessageServerID
+	err := ms.db.QueryRow(query.SelectNewsletterServerID, messageID).Scan(&serverID)
+	return serverID, err
+}
+
+// OldestNewsletterServerID returns the lowest stored server ID of a channel,
+// or 0 when none of its messages are stored yet.
+func (ms *MessageStore) OldestNewsletterServerID(chatJID string) types.MessageServerID {
+	var serverID types.MessageServerID
+	if err := ms.db.QueryRow(query.SelectOldestNewsletterServerID, chatJID).Scan(&serverID); err != nil {
+		return 0
+	}
+	return serverID
+}
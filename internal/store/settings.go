@@ -3,6 +3,7 @@ package store
 import (
 	"encoding/json"
 	"errors"
+	"maps"
 	"os"
 	"path/filepath"
 	"sync"
@@ -15,6 +16,25 @@ import (
 // notifications on/off switch.
 const notificationsKey = "notifications_enabled"
 
+// proxyKey is the app_settings.json key for the proxy URL used for the
+// WhatsApp connection, media and avatar downloads.
+const proxyKey = "proxy_url"
+
+// sendQualityKey is the app_settings.json key for how outgoing images are
+// compressed ("standard", "hd" or "original").
+const sendQualityKey = "send_quality"
+
+// mediaCacheQuotasKey is the app_settings.json key for the media cache
+// size of each kind of media, in megabytes.
+const mediaCacheQuotasKey = "media_cache_quotas"
+
+// autoDownloadKey is the app_settings.json key for the auto-download rules.
+const autoDownloadKey = "auto_download"
+
+// backendKeys are settings owned by the backend rather than the settings
+// view.
+var backendKeys = []string{notificationsKey, proxyKey, sendQualityKey, mediaCacheQuotasKey, autoDownloadKey}
+
 // notificationsEnabled caches the global notification switch so the hot
 // notify path can read it without touching the settings map (which is not
 // safe for concurrent access).
@@ -58,9 +78,11 @@ func SaveSettings(data map[string]any) error {
 	// The frontend saves its own settings snapshot, which doesn't include
 	// backend-owned keys — carry them over so a generic save can't clobber
 	// them (that reset the notification switch back to its default).
-	if _, ok := data[notificationsKey]; !ok {
-		if cur, ok := settingsInstance.data[notificationsKey]; ok {
-			data[notificationsKey] = cur
+	for _, key := range backendKeys {
+		if _, ok := data[key]; !ok {
+			if cur, ok := settingsInstance.data[key]; ok {
+				data[key] = cur
+			}
 		}
 	}
 	settingsInstance.data = data
@@ -84,17 +106,140 @@ func SetNotificationsEnabled(enabled bool) error {
 
 	settingsInstance.mu.Lock()
 	defer settingsInstance.mu.Unlock()
+	return settingsInstance.setLocked(notificationsKey, enabled)
+}
 
-	// Copy-on-write so concurrent GetSettings readers never observe a map
-	// mutation mid-flight.
-	newData := make(map[string]any, len(settingsInstance.data)+1)
-	for k, v := range settingsInstance.data {
-		newData[k] = v
+// GetProxyURL returns the configured proxy URL, or "" for a direct
+// connection.
+func GetProxyURL() string {
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	v, _ := settingsInstance.data[proxyKey].(string)
+	return v
+}
+
+// SetProxyURL persists the proxy URL to app_settings.json. An empty URL
+// removes the setting.
+func SetProxyURL(proxyURL string) error {
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	if proxyURL == "" {
+		return settingsInstance.setLocked(proxyKey, nil)
 	}
-	newData[notificationsKey] = enabled
-	settingsInstance.data = newData
+	return settingsInstance.setLocked(proxyKey, proxyURL)
+}
 
-	return settingsInstance.writeLocked()
+// GetSendQuality returns the image send quality, or "" when never set.
+func GetSendQuality() string {
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	v, _ := settingsInstance.data[sendQualityKey].(string)
+	return v
+}
+
+// SetSendQuality persists the image send quality to app_settings.json.
+func SetSendQuality(quality string) error {
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	return settingsInstance.setLocked(sendQualityKey, quality)
+}
+
+// GetMediaCacheQuotas returns the configured media cache size per kind, in
+// megabytes. Kinds that were never configured are absent.
+func GetMediaCacheQuotas() map[string]int64 {
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	raw, _ := settingsInstance.data[mediaCacheQuotasKey].(map[string]any)
+	quotas := make(map[string]int64, len(raw))
+	for kind, v := range raw {
+		// JSON numbers decode as float64.
+		if mb, ok := v.(float64); ok {
+			quotas[kind] = int64(mb)
+		}
+	}
+	return quotas
+}
+
+// SetMediaCacheQuotas persists the media cache size per kind, in megabytes.
+func SetMediaCacheQuotas(quotas map[string]int64) error {
+	raw := make(map[string]any, len(quotas))
+	for kind, mb := range quotas {
+		raw[kind] = float64(mb)
+	}
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	return settingsInstance.setLocked(mediaCacheQuotasKey, raw)
+}
+
+// AutoDownloadRule says which chats a type of media is downloaded from
+// without being asked for.
+type AutoDownloadRule struct {
+	Contacts bool `json:"contacts"`
+	Groups   bool `json:"groups"`
+	Channels bool `json:"channels"`
+	// MaxSizeMB skips larger media; 0 means no limit.
+	MaxSizeMB int64 `json:"max_size_mb"`
+}
+
+// AutoDownload is the auto-download policy. Rules are keyed by media type:
+// "image", "audio", "video" and "document".
+type AutoDownload struct {
+	Rules map[string]AutoDownloadRule `json:"rules"`
+	// PauseOnMetered stops auto-downloading on metered connections.
+	PauseOnMetered bool `json:"pause_on_metered"`
+}
+
+// DefaultAutoDownload fetches images and voice notes, like WhatsApp on
+// mobile data, and leaves larger media to be asked for.
+func DefaultAutoDownload() AutoDownload {
+	return AutoDownload{
+		Rules: map[string]AutoDownloadRule{
+			"image":    {Contacts: true, Groups: true, Channels: true, MaxSizeMB: 16},
+			"audio":    {Contacts: true, Groups: true, MaxSizeMB: 16},
+			"video":    {MaxSizeMB: 64},
+			"document": {MaxSizeMB: 16},
+		},
+		PauseOnMetered: true,
+	}
+}
+
+// GetAutoDownload returns the auto-download policy, DefaultAutoDownload
+// when it was never set.
+func GetAutoDownload() AutoDownload {
+	settingsInstance.mu.Lock()
+	raw, ok := settingsInstance.data[autoDownloadKey]
+	settingsInstance.mu.Unlock()
+	policy := DefaultAutoDownload()
+	if !ok {
+		return policy
+	}
+	// The settings map holds decoded JSON; go through JSON again for the
+	// struct.
+	data, err := json.Marshal(raw)
+	if err == nil {
+		policy.Rules = nil
+		err = json.Unmarshal(data, &policy)
+	}
+	if err != nil {
+		return DefaultAutoDownload()
+	}
+	return policy
+}
+
+// SetAutoDownload persists the auto-download policy.
+func SetAutoDownload(policy AutoDownload) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	settingsInstance.mu.Lock()
+	defer settingsInstance.mu.Unlock()
+	return settingsInstance.setLocked(autoDownloadKey, raw)
 }
 
 // notificationsEnabledFrom extracts the switch from a settings map, defaulting
@@ -108,6 +253,24 @@ func notificationsEnabledFrom(data map[string]any) bool {
 	return true
 }
 
+// setLocked sets key to v, or removes it when v is nil, and persists the
+// settings. The map is copied on write so concurrent GetSettings readers
+// never observe a mutation mid-flight. The caller must hold
+// settingsInstance.mu.
+func (s *settings) setLocked(key string, v any) error {
+	newData := maps.Clone(s.data)
+	if newData == nil {
+		newData = make(map[string]any)
+	}
+	if v == nil {
+		delete(newData, key)
+	} else {
+		newData[key] = v
+	}
+	s.data = newData
+	return s.writeLocked()
+}
+
 // writeLocked persists the current settings map to disk. The caller must hold
 // settingsInstance.mu.
 func (s *settings) writeLocked() error {
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"github.com/lugvitc/whats4linux/internal/wa"
+)
+
+// StoredSticker is a sticker seen in a sent or received message. The
+// frontend shows it by downloading the media of MessageID.
+type StoredSticker struct {
+	// ID is the hex SHA-256 of the sticker file.
+	ID         string `json:"id"`
+	MessageID  string `json:"messageId"`
+	ChatJID    string `json:"chatId"`
+	IsAnimated bool   `json:"isAnimated"`
+	LastUsed   int64  `json:"lastUsed"`
+	Favorite   bool   `json:"favorite"`
+}
+
+func scanStoredStickers(rows *sql.Rows) ([]StoredSticker, error) {
+	defer rows.Close()
+	var out []StoredSticker
+	for rows.Next() {
+		var (
+			s           StoredSticker
+			sha         []byte
+			favoritedAt int64
+		)
+		if err := rows.Scan(&sha, &s.MessageID, &s.ChatJID, &s.IsAnimated, &s.LastUsed, &favoritedAt); err != nil {
+			return nil, err
+		}
+		s.ID = hex.EncodeToString(sha)
+		s.Favorite = favoritedAt > 0
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// RecentStickers returns up to limit stickers, most recently used first.
+func (ms *MessageStore) RecentStickers(limit int) ([]StoredSticker, error) {
+	rows, err := ms.db.Query(query.SelectRecentStickers, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanStoredStickers(rows)
+}
+
+// FavoriteStickers returns the favorite stickers, latest favorite first.
+func (ms *MessageStore) FavoriteStickers() ([]StoredSticker, error) {
+	rows, err := ms.db.Query(query.SelectFavoriteStickers)
+	if err != nil {
+		return nil, err
+	}
+	return scanStoredStickers(rows)
+}
+
+// SetStickerFavorite adds a sticker to or removes it from the favorites.
+func (ms *MessageStore) SetStickerFavorite(id string, favorite bool) error {
+	sha, err := hex.DecodeString(id)
+	if err != nil {
+		return fmt.Errorf("invalid sticker id %q", id)
+	}
+	var favoritedAt int64
+	if favorite {
+		favoritedAt = time.Now().UnixNano()
+	}
+	return ms.runSync(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query.UpdateStickerFavorite, favoritedAt, sha)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("unknown sticker %s", id)
+		}
+		return nil
+	})
+}
+
+// StickerMedia returns the keys of a stored sticker, so it can be sent
+// again without re-uploading it.
+func (ms *MessageStore) StickerMedia(id string) (*wa.Media, bool, error) {
+	sha, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid sticker id %q", id)
+	}
+	var (
+		animated      bool
+		url           sql.NullString
+		mimetype      sql.NullString
+		directPath    sql.NullString
+		mediaKey      []byte
+		fileSHA256    []byte
+		fileEncSHA256 []byte
+		width, height sql.NullInt64
+		fileLength    sql.NullInt64
+	)
+	err = ms.db.QueryRow(query.SelectStickerMedia, sha).Scan(
+		&animated, &url, &mimetype, &directPath, &mediaKey, &fileSHA256, &fileEncSHA256, &width, &height, &fileLength,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return wa.NewMedia(
+		directPath.String,
+		mediaKey, fileSHA256, fileEncSHA256,
+		url.String,
+		mimetype.String,
+		"", uint64(fileLength.Int64),
+		int(width.Int64), int(height.Int64),
+		mtypes.MediaTypeSticker,
+	), animated, nil
+}
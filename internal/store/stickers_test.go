@@ -0,0 +1,82 @@
+package store
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+func insertTestSticker(t *testing.T, ms *MessageStore, id string, sha byte, timestamp int64) {
+	t.Helper()
+	info := &types.MessageInfo{
+		ID:        id,
+		Timestamp: time.Unix(timestamp, 0),
+		MessageSource: types.MessageSource{
+			Chat:   types.NewJID("123", types.DefaultUserServer),
+			Sender: types.NewJID("123", types.DefaultUserServer),
+		},
+	}
+	msg := &waE2E.Message{StickerMessage: &waE2E.StickerMessage{
+		URL:        proto.String("https://mmg.whatsapp.net/" + id),
+		DirectPath: proto.String("/" + id),
+		Mimetype:   proto.String("image/webp"),
+		FileSHA256: []byte{sha},
+		MediaKey:   []byte("key-" + id),
+		Width:      proto.Uint32(512),
+		Height:     proto.Uint32(512),
+		FileLength: proto.Uint64(uint64(timestamp)),
+	}}
+	if err := ms.InsertMessage(info, msg, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStickersAreTrackedFromMessages(t *testing.T) {
+	ms := newTestMessageStore(t)
+	insertTestSticker(t, ms, "first", 1, 100)
+	insertTestSticker(t, ms, "other", 2, 200)
+	insertTestSticker(t, ms, "again", 1, 300)
+	// A redelivered old message doesn't make a sticker recent.
+	insertTestSticker(t, ms, "old", 2, 50)
+
+	recent, err := ms.RecentStickers(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || recent[0].MessageID != "again" || recent[1].MessageID != "other" {
+		t.Fatalf("recent = %+v, want again then other", recent)
+	}
+
+	id := hex.EncodeToString([]byte{2})
+	if err := ms.SetStickerFavorite(id, true); err != nil {
+		t.Fatal(err)
+	}
+	favorites, err := ms.FavoriteStickers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(favorites) != 1 || favorites[0].ID != id || !favorites[0].Favorite {
+		t.Fatalf("favorites = %+v", favorites)
+	}
+	if err := ms.SetStickerFavorite(id, false); err != nil {
+		t.Fatal(err)
+	}
+	if favorites, _ = ms.FavoriteStickers(); len(favorites) != 0 {
+		t.Fatalf("favorites after removal = %+v", favorites)
+	}
+	if err := ms.SetStickerFavorite("ff", true); err == nil {
+		t.Fatal("favoriting an unknown sticker succeeded")
+	}
+
+	media, _, err := ms.StickerMedia(hex.EncodeToString([]byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media.GetDirectPath() != "/again" || string(media.GetMediaKey()) != "key-again" || media.GetFileLength() != 300 {
+		t.Fatalf("sticker media = %q %q %d bytes, want the latest message's", media.GetDirectPath(), media.GetMediaKey(), media.GetFileLength())
+	}
+}
@@ -6,4 +6,7 @@ const (
 	MessageTypeNormal MessageType = iota
 
 	MessageTypeMessagePinned
+
+	// MessageTypeCall is a system entry for a finished voice/video call.
+	MessageTypeCall
 )
@@ -0,0 +1,205 @@
+// Package vcard reads and writes the part of vCard 3.0 the app uses for
+// contacts: names, phone numbers (with WhatsApp's waid parameter), notes and
+// X- extension properties.
+package vcard
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Card is one contact.
+type Card struct {
+	FN       string
+	Nickname string
+	Note     string
+	Tels     []Tel
+	// Ext holds X- properties by upper-case name.
+	Ext map[string]string
+}
+
+// Tel is a phone number. WAID is the WhatsApp user (digits only) when the
+// card came from WhatsApp.
+type Tel struct {
+	Number string
+	WAID   string
+}
+
+// Digits returns the number as digits only, preferring the WhatsApp ID.
+func (t Tel) Digits() string {
+	s := t.WAID
+	if s == "" {
+		s = t.Number
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// Parse reads every card in data. Unknown properties are skipped.
+func Parse(data string) ([]Card, error) {
+	var (
+		cards []Card
+		cur   *Card
+	)
+	for n, line := range unfold(data) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing ':'", n+1)
+		}
+		switch name {
+		case "BEGIN":
+			if cur != nil {
+				return nil, fmt.Errorf("line %d: nested BEGIN", n+1)
+			}
+			cur = &Card{}
+			continue
+		case "END":
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: END without BEGIN", n+1)
+			}
+			cards = append(cards, *cur)
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("line %d: property outside a card", n+1)
+		}
+		switch {
+		case name == "FN":
+			cur.FN = unescape(value)
+		case name == "NICKNAME":
+			cur.Nickname = unescape(value)
+		case name == "NOTE":
+			cur.Note = unescape(value)
+		case name == "TEL":
+			tel := Tel{Number: unescape(value)}
+			for _, p := range params {
+				if k, v, ok := strings.Cut(p, "="); ok && strings.EqualFold(k, "waid") {
+					tel.WAID = v
+				}
+			}
+			cur.Tels = append(cur.Tels, tel)
+		case strings.HasPrefix(name, "X-"):
+			if cur.Ext == nil {
+				cur.Ext = make(map[string]string)
+			}
+			cur.Ext[name] = unescape(value)
+		}
+	}
+	if cur != nil {
+		return nil, errors.New("card without END")
+	}
+	return cards, nil
+}
+
+// unfold splits data into logical lines, joining folded continuation lines.
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	var lines []string
+	for _, l := range strings.Split(data, "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// splitLine splits "group.NAME;param;param:value" into its upper-case name,
+// its parameters and its raw value.
+func splitLine(line string) (name string, params []string, value string, ok bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, "", false
+	}
+	parts := strings.Split(head, ";")
+	name = strings.ToUpper(parts[0])
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name, parts[1:], value, true
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+// Encode writes cards as vCard 3.0.
+func Encode(cards []Card) string {
+	var b strings.Builder
+	for _, c := range cards {
+		b.WriteString("BEGIN:VCARD\r\nVERSION:3.0\r\n")
+		writeProp(&b, "FN", escape(c.FN))
+		if c.Nickname != "" {
+			writeProp(&b, "NICKNAME", escape(c.Nickname))
+		}
+		for _, t := range c.Tels {
+			name := "TEL;TYPE=CELL"
+			if t.WAID != "" {
+				name += ";waid=" + t.WAID
+			}
+			writeProp(&b, name, escape(t.Number))
+		}
+		if c.Note != "" {
+			writeProp(&b, "NOTE", escape(c.Note))
+		}
+		for _, k := range slices.Sorted(maps.Keys(c.Ext)) {
+			writeProp(&b, k, escape(c.Ext[k]))
+		}
+		b.WriteString("END:VCARD\r\n")
+	}
+	return b.String()
+}
+
+// writeProp writes one property, folded at 75 bytes without splitting a
+// UTF-8 sequence.
+func writeProp(b *strings.Builder, name, value string) {
+	line := name + ":" + value
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the folding space.
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
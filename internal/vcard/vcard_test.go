@@ -0,0 +1,58 @@
+package vcard
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWhatsAppAndFoldedCards(t *testing.T) {
+	data := "BEGIN:VCARD\nVERSION:3.0\nFN:Alice\nitem1.TEL;type=CELL;waid=919876543210:+91 98765 43210\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Bob\\, Jr.\r\nNOTE:first line\\nsecond \r\n line\r\nX-WHATS4LINUX-COLOR:#112233\r\nEND:VCARD\r\n"
+	cards, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 2 {
+		t.Fatalf("got %d cards, want 2", len(cards))
+	}
+	if got := cards[0]; got.FN != "Alice" || len(got.Tels) != 1 || got.Tels[0].Digits() != "919876543210" {
+		t.Fatalf("card 0 = %+v", got)
+	}
+	if got := cards[1]; got.FN != "Bob, Jr." || got.Note != "first line\nsecond line" || got.Ext["X-WHATS4LINUX-COLOR"] != "#112233" {
+		t.Fatalf("card 1 = %+v", got)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	in := []Card{{
+		FN:       "Zoë; the \"long\" name",
+		Nickname: "Z",
+		Note:     strings.Repeat("ü", 60) + "\nend",
+		Tels:     []Tel{{Number: "+1 415 555 0123", WAID: "14155550123"}},
+		Ext:      map[string]string{"X-WHATS4LINUX-COLOR": "#abcdef"},
+	}}
+	out := Encode(in)
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Fatalf("line longer than 75 bytes: %q", line)
+		}
+	}
+	cards, err := Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 1 {
+		t.Fatalf("got %d cards, want 1", len(cards))
+	}
+	got := cards[0]
+	if got.FN != in[0].FN || got.Nickname != "Z" || got.Note != in[0].Note ||
+		len(got.Tels) != 1 || got.Tels[0] != in[0].Tels[0] || got.Ext["X-WHATS4LINUX-COLOR"] != "#abcdef" {
+		t.Fatalf("round trip = %+v, want %+v", got, in[0])
+	}
+}
+
+func TestParseRejectsUnterminatedCard(t *testing.T) {
+	if _, err := Parse("BEGIN:VCARD\nFN:Alice\n"); err == nil {
+		t.Fatal("expected an error for a card without END")
+	}
+}
@@ -2,6 +2,7 @@ package wa
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/lugvitc/whats4linux/internal/settings"
 	_ "github.com/mattn/go-sqlite3"
@@ -10,10 +11,10 @@ import (
 	waLog "go.mau.fi/whatsmeow/util/log"
 )
 
-func NewClient(ctx context.Context, container *sqlstore.Container) *whatsmeow.Client {
+func NewClient(ctx context.Context, container *sqlstore.Container) (*whatsmeow.Client, error) {
 	deviceStore, err := container.GetFirstDevice(ctx)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to load device: %w", err)
 	}
 	clientLog := waLog.Stdout("Client", settings.GetLogLevel(), true)
 	cli := whatsmeow.NewClient(deviceStore, clientLog)
@@ -21,5 +22,5 @@ func NewClient(ctx context.Context, container *sqlstore.Container) *whatsmeow.Cl
 	// events (whatsmeow drops them unless the flag is set), so archive/pin/
 	// mute state synced from the phone would never reach our handlers.
 	cli.EmitAppStateEventsOnFullSync = true
-	return cli
+	return cli, nil
 }
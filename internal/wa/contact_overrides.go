@@ -0,0 +1,70 @@
+package wa
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+)
+
+// ContactOverride is what the user set for a contact locally.
+type ContactOverride struct {
+	JID      string
+	Nickname string
+	Notes    string
+	// Color is a "#rrggbb" avatar color, or "" for the default.
+	Color string
+}
+
+// IsEmpty reports whether the override sets nothing.
+func (o ContactOverride) IsEmpty() bool {
+	return o.Nickname == "" && o.Notes == "" && o.Color == ""
+}
+
+// FetchContactOverrides returns every override keyed by JID.
+func (cw *AppDatabase) FetchContactOverrides() (map[string]ContactOverride, error) {
+	rows, err := cw.db.Query(query.SelectAllContactOverrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := make(map[string]ContactOverride)
+	for rows.Next() {
+		var o ContactOverride
+		if err := rows.Scan(&o.JID, &o.Nickname, &o.Notes, &o.Color); err != nil {
+			return nil, fmt.Errorf("failed to scan contact override row: %w", err)
+		}
+		overrides[o.JID] = o
+	}
+	return overrides, rows.Err()
+}
+
+// StoreContactOverrides upserts overrides in one transaction. An override
+// that sets nothing is deleted.
+func (cw *AppDatabase) StoreContactOverrides(overrides ...ContactOverride) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	tx, err := cw.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for _, o := range overrides {
+		if o.IsEmpty() {
+			_, err = tx.Exec(query.DeleteContactOverride, o.JID)
+		} else {
+			_, err = tx.Exec(query.UpsertContactOverride, o.JID, o.Nickname, o.Notes, o.Color, now)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store contact override %s: %w", o.JID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
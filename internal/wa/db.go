@@ -25,6 +25,12 @@ func NewAppDatabase(ctx context.Context) (*AppDatabase, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Unlike the caches created in Initialise, overrides are local data
+	// needed before the client connects.
+	if _, err := db.Exec(query.CreateContactOverridesTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create contact_overrides table: %w", err)
+	}
 	return &AppDatabase{
 		db:  db,
 		ctx: ctx,
@@ -52,6 +58,14 @@ func (cw *AppDatabase) Initialise(client *whatsmeow.Client) error {
 		}
 	}
 
+	if _, err := cw.db.Exec(query.CreateNewslettersTable); err != nil {
+		return fmt.Errorf("failed to create whats4linux_newsletters table: %w", err)
+	}
+	// Channels are secondary to groups; a failed refresh keeps the old cache.
+	if err := cw.FetchAndStoreNewsletters(client); err != nil {
+		log.Println("newsletter cache refresh failed:", err)
+	}
+
 	err = cw.FetchAndStoreGroups(client)
 	if err != nil {
 		return fmt.Errorf("failed to fetch and store groups: %w", err)
@@ -289,6 +303,40 @@ func (cw *AppDatabase) FetchCommunities() ([]Group, error) {
 	return groups, rows.Err()
 }
 
+// SetGroupParent links a stored group to a community, or unlinks it when
+// parentJID is empty, so the cached community view stays consistent without a
+// full FetchAndStoreGroups refresh. Reports whether a row was updated.
+func (cw *AppDatabase) SetGroupParent(jid, parentJID, parentName string) (bool, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if parentJID == "" {
+		parentName = ""
+	}
+	res, err := cw.db.Exec(query.UpdateGroupParent, parentJID, parentName, jid)
+	if err != nil {
+		return false, fmt.Errorf("failed to update parent of group %s: %w", jid, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// FetchAnnouncementGroup returns the stored announcement (default sub-)group
+// of a community.
+func (cw *AppDatabase) FetchAnnouncementGroup(parentJID string) (*Group, error) {
+	g, err := scanGroup(cw.db.QueryRow(query.SelectAnnouncementGroupByParent, parentJID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("announcement group for %s not found", parentJID)
+		}
+		return nil, fmt.Errorf("failed to scan group row: %w", err)
+	}
+	return g, nil
+}
+
 // CountLinkedGroups returns how many stored groups link to parentJID.
 func (cw *AppDatabase) CountLinkedGroups(parentJID string) (int, error) {
 	var n int
@@ -314,6 +362,25 @@ func (cw *AppDatabase) ParentCommunityName(parentJID string) string {
 	return name
 }
 
+// Wipe deletes every row of the application database, leaving it open.
+func (cw *AppDatabase) Wipe() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	tx, err := cw.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := misc.ClearTables(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = cw.db.Exec(query.Vacuum)
+	return err
+}
+
 func (cw *AppDatabase) Close() error {
 	return cw.db.Close()
 }
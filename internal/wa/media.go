@@ -24,6 +24,8 @@ type Media struct {
 	fileEncSHA256 []byte
 	url           string
 	mimetype      string
+	fileName      string
+	fileLength    uint64
 	mediaType     types.MediaType
 	width, height int
 }
@@ -32,6 +34,7 @@ func NewMedia(
 	directPath string,
 	mediaKey, fileSHA256, fileEncSHA256 []byte,
 	url, mimetype string,
+	fileName string, fileLength uint64,
 	width, height int,
 	mediaType types.MediaType,
 
@@ -43,6 +46,8 @@ func NewMedia(
 		fileEncSHA256: fileEncSHA256,
 		url:           url,
 		mimetype:      mimetype,
+		fileName:      fileName,
+		fileLength:    fileLength,
 		width:         width,
 		height:        height,
 		mediaType:     mediaType,
@@ -84,3 +89,13 @@ func (em *Media) GetMimetype() string {
 func (em *Media) GetDimensions() (width, height int) {
 	return em.width, em.height
 }
+
+// GetFileName is a document's original name, if it has one.
+func (em *Media) GetFileName() string {
+	return em.fileName
+}
+
+// GetFileLength is the plaintext size, or 0 when unknown.
+func (em *Media) GetFileLength() uint64 {
+	return em.fileLength
+}
@@ -0,0 +1,179 @@
+package wa
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Newsletter is a cached channel (newsletter) row.
+type Newsletter struct {
+	JID             string
+	Name            string
+	Description     string
+	InviteCode      string
+	SubscriberCount int
+	Verified        bool
+	Muted           bool
+	Role            string
+}
+
+// NewsletterFromMetadata converts whatsmeow channel metadata into a cache row.
+func NewsletterFromMetadata(meta *types.NewsletterMetadata) Newsletter {
+	n := Newsletter{
+		JID:             meta.ID.String(),
+		Name:            meta.ThreadMeta.Name.Text,
+		Description:     meta.ThreadMeta.Description.Text,
+		InviteCode:      meta.ThreadMeta.InviteCode,
+		SubscriberCount: meta.ThreadMeta.SubscriberCount,
+		Verified:        meta.ThreadMeta.VerificationState == types.NewsletterVerificationStateVerified,
+	}
+	if meta.ViewerMeta != nil {
+		n.Muted = meta.ViewerMeta.Mute == types.NewsletterMuteOn
+		n.Role = string(meta.ViewerMeta.Role)
+	}
+	return n
+}
+
+func scanNewsletter(scanner interface{ Scan(dest ...any) error }) (*Newsletter, error) {
+	var n Newsletter
+	var verified, muted int
+	err := scanner.Scan(
+		&n.JID, &n.Name, &n.Description, &n.InviteCode,
+		&n.SubscriberCount, &verified, &muted, &n.Role,
+	)
+	if err != nil {
+		return nil, err
+	}
+	n.Verified = verified != 0
+	n.Muted = muted != 0
+	return &n, nil
+}
+
+func newsletterArgs(n Newsletter) []any {
+	verified, muted := 0, 0
+	if n.Verified {
+		verified = 1
+	}
+	if n.Muted {
+		muted = 1
+	}
+	return []any{
+		n.JID, n.Name, n.Description, n.InviteCode,
+		n.SubscriberCount, verified, muted, n.Role, time.Now().Unix(),
+	}
+}
+
+// FetchAndStoreNewsletters replaces the channel cache with the channels the
+// user currently follows.
+func (cw *AppDatabase) FetchAndStoreNewsletters(client *whatsmeow.Client) error {
+	newsletters, err := client.GetSubscribedNewsletters(cw.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch subscribed newsletters: %w", err)
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	tx, err := cw.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Clear stale rows so unfollowed channels disappear.
+	if _, err := tx.Exec(query.DeleteAllNewsletters); err != nil {
+		return fmt.Errorf("failed to clear newsletters: %w", err)
+	}
+	stmt, err := tx.Prepare(query.InsertOrReplaceNewsletter)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, meta := range newsletters {
+		if meta == nil {
+			continue
+		}
+		if _, err := stmt.Exec(newsletterArgs(NewsletterFromMetadata(meta))...); err != nil {
+			return fmt.Errorf("failed to insert newsletter %s: %w", meta.ID.String(), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// StoreNewsletter upserts a single channel row.
+func (cw *AppDatabase) StoreNewsletter(n Newsletter) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if _, err := cw.db.Exec(query.InsertOrReplaceNewsletter, newsletterArgs(n)...); err != nil {
+		return fmt.Errorf("failed to upsert newsletter %s: %w", n.JID, err)
+	}
+	return nil
+}
+
+// FetchNewsletters returns every cached channel, ordered by name.
+func (cw *AppDatabase) FetchNewsletters() ([]Newsletter, error) {
+	rows, err := cw.db.Query(query.SelectAllNewsletters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query newsletters: %w", err)
+	}
+	defer rows.Close()
+
+	var newsletters []Newsletter
+	for rows.Next() {
+		n, err := scanNewsletter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan newsletter row: %w", err)
+		}
+		newsletters = append(newsletters, *n)
+	}
+	return newsletters, rows.Err()
+}
+
+// FetchNewsletter returns a single cached channel.
+func (cw *AppDatabase) FetchNewsletter(jid string) (*Newsletter, error) {
+	n, err := scanNewsletter(cw.db.QueryRow(query.SelectNewsletterByJID, jid))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("newsletter with JID %s not found", jid)
+		}
+		return nil, fmt.Errorf("failed to scan newsletter row: %w", err)
+	}
+	return n, nil
+}
+
+// SetNewsletterMuted records a channel's mute state.
+func (cw *AppDatabase) SetNewsletterMuted(jid string, muted bool) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	m := 0
+	if muted {
+		m = 1
+	}
+	if _, err := cw.db.Exec(query.UpdateNewsletterMuted, m, jid); err != nil {
+		return fmt.Errorf("failed to update newsletter %s: %w", jid, err)
+	}
+	return nil
+}
+
+// DeleteNewsletter drops an unfollowed channel from the cache.
+func (cw *AppDatabase) DeleteNewsletter(jid string) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if _, err := cw.db.Exec(query.DeleteNewsletter, jid); err != nil {
+		return fmt.Errorf("failed to delete newsletter %s: %w", jid, err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package wa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"os"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/util/hkdfutil"
+)
+
+// mediaMACLength is the length of the MAC whatsmeow appends to encrypted
+// media.
+const mediaMACLength = 10
+
+// StreamingFile is a whatsmeow.File that also decrypts media while it
+// downloads. whatsmeow only decrypts a file once all of it is in and its
+// MAC checks out; StreamingFile passes the plaintext to out as the
+// ciphertext arrives, so the media can be played early.
+//
+// What reaches out is unverified until the download succeeds, and the last
+// block, which carries the padding, is never streamed: once DownloadToFile
+// returns, the file holds all of the plaintext and out should be completed
+// from it, starting at Streamed.
+type StreamingFile struct {
+	f   *os.File
+	out io.Writer
+
+	block cipher.Block
+	iv    []byte
+	cbc   cipher.BlockMode
+	// pending is ciphertext not yet decrypted: a partial block, or what
+	// may turn out to be the MAC and the padded last block.
+	pending []byte
+
+	// pos is how much plaintext this download attempt has produced and
+	// streamed how much of it reached out; a retried attempt only streams
+	// what the earlier ones didn't.
+	pos, streamed int64
+	streaming     bool
+	rewound       bool
+	err           error
+}
+
+// NewStreamingFile streams msg's plaintext to out while whatsmeow downloads
+// it into f. Media without a key, as in channels, isn't encrypted and is
+// streamed as is.
+func NewStreamingFile(f *os.File, msg whatsmeow.DownloadableMessage, out io.Writer) (*StreamingFile, error) {
+	s := &StreamingFile{f: f, out: out, streaming: true}
+	if mediaKey := msg.GetMediaKey(); len(mediaKey) > 0 {
+		keys := hkdfutil.SHA256(mediaKey, nil, []byte(whatsmeow.GetMediaType(msg)), 112)
+		block, err := aes.NewCipher(keys[16:48])
+		if err != nil {
+			return nil, err
+		}
+		s.block, s.iv = block, keys[:16]
+		s.cbc = cipher.NewCBCDecrypter(block, s.iv)
+	}
+	return s, nil
+}
+
+// Streamed is how much plaintext has been passed to out.
+func (s *StreamingFile) Streamed() int64 {
+	return s.streamed
+}
+
+// Err is the error out failed with, if it did. Streaming stops at the
+// first one.
+func (s *StreamingFile) Err() error {
+	return s.err
+}
+
+func (s *StreamingFile) Write(b []byte) (int, error) {
+	n, err := s.f.Write(b)
+	if s.streaming && n > 0 {
+		if s.rewound {
+			s.restart()
+		}
+		s.feed(b[:n])
+	}
+	return n, err
+}
+
+// restart follows whatsmeow starting the download over.
+func (s *StreamingFile) restart() {
+	s.rewound = false
+	s.pos = 0
+	s.pending = s.pending[:0]
+	if s.block != nil {
+		s.cbc = cipher.NewCBCDecrypter(s.block, s.iv)
+	}
+}
+
+func (s *StreamingFile) feed(b []byte) {
+	if s.cbc == nil {
+		s.emit(b)
+		return
+	}
+	s.pending = append(s.pending, b...)
+	hold := mediaMACLength + aes.BlockSize
+	n := (len(s.pending) - hold) / aes.BlockSize * aes.BlockSize
+	if n <= 0 {
+		return
+	}
+	plain := make([]byte, n)
+	s.cbc.CryptBlocks(plain, s.pending[:n])
+	s.pending = append(s.pending[:0], s.pending[n:]...)
+	s.emit(plain)
+}
+
+func (s *StreamingFile) emit(plain []byte) {
+	start := s.pos
+	s.pos += int64(len(plain))
+	if s.pos <= s.streamed {
+		return
+	}
+	if skip := s.streamed - start; skip > 0 {
+		plain = plain[skip:]
+	}
+	n, err := s.out.Write(plain)
+	s.streamed += int64(n)
+	if err != nil {
+		s.err = err
+		s.streaming = false
+	}
+}
+
+// stop ends streaming once whatsmeow moves on from downloading.
+func (s *StreamingFile) stop() {
+	s.streaming = false
+	s.pending = nil
+}
+
+func (s *StreamingFile) Seek(offset int64, whence int) (int64, error) {
+	// whatsmeow seeks back to the start to retry a failed download, and
+	// to check an unencrypted one once it is done. The next call tells
+	// which.
+	if s.streaming && offset == 0 && whence == io.SeekStart {
+		s.rewound = true
+	}
+	return s.f.Seek(offset, whence)
+}
+
+func (s *StreamingFile) Read(b []byte) (int, error) {
+	s.stop()
+	return s.f.Read(b)
+}
+
+func (s *StreamingFile) ReadAt(b []byte, off int64) (int, error) {
+	s.stop()
+	return s.f.ReadAt(b, off)
+}
+
+func (s *StreamingFile) WriteAt(b []byte, off int64) (int, error) {
+	s.stop()
+	return s.f.WriteAt(b, off)
+}
+
+func (s *StreamingFile) Truncate(size int64) error {
+	s.stop()
+	return s.f.Truncate(size)
+}
+
+func (s *StreamingFile) Stat() (os.FileInfo, error) {
+	return s.f.Stat()
+}
@@ -0,0 +1,87 @@
+package wa
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lugvitc/whats4linux/internal/types"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/util/cbcutil"
+	"go.mau.fi/whatsmeow/util/hkdfutil"
+)
+
+// TestStreamingFileFollowsDownload replays what whatsmeow's DownloadToFile
+// does to the file, including a retry, and checks the streamed plaintext.
+func TestStreamingFileFollowsDownload(t *testing.T) {
+	plaintext := make([]byte, 10_000)
+	mediaKey := make([]byte, 32)
+	rand.Read(plaintext)
+	rand.Read(mediaKey)
+	keys := hkdfutil.SHA256(mediaKey, nil, []byte(whatsmeow.MediaVideo), 112)
+	iv, cipherKey, macKey := keys[:16], keys[16:48], keys[48:80]
+	ciphertext, err := cbcutil.Encrypt(cipherKey, iv, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	download := append(ciphertext, mac.Sum(nil)[:mediaMACLength]...)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "download"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out bytes.Buffer
+	msg := NewMedia("/path", mediaKey, nil, nil, "", "video/mp4", "", 0, 0, 0, types.MediaTypeVideo)
+	s, err := NewStreamingFile(f, msg, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A first attempt breaks off, and the retry starts over.
+	s.Write(download[:3000])
+	s.Seek(0, io.SeekStart)
+	for rest := download; len(rest) > 0; {
+		n := min(777, len(rest))
+		s.Write(rest[:n])
+		rest = rest[n:]
+	}
+	if out.Len() == 0 || out.Len() > len(plaintext) || !bytes.Equal(out.Bytes(), plaintext[:out.Len()]) {
+		t.Fatalf("streamed %d bytes that don't match the plaintext", out.Len())
+	}
+
+	// Then whatsmeow checks the MAC and decrypts in place.
+	size := int64(len(download))
+	got := make([]byte, mediaMACLength)
+	if _, err := s.ReadAt(got, size-mediaMACLength); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Truncate(size - mediaMACLength); err != nil {
+		t.Fatal(err)
+	}
+	s.Seek(0, io.SeekStart)
+	io.Copy(io.Discard, s)
+	s.Seek(0, io.SeekStart)
+	if err := cbcutil.DecryptFile(cipherKey, iv, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Streamed() != int64(out.Len()) {
+		t.Fatalf("Streamed = %d, want %d", s.Streamed(), out.Len())
+	}
+	s.Seek(s.Streamed(), io.SeekStart)
+	if _, err := io.Copy(&out, s); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), plaintext) {
+		t.Fatal("completed stream doesn't match the plaintext")
+	}
+}